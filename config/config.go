@@ -0,0 +1,460 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the server needs at startup. It is loaded once in main
+// and handed to the parts that need it.
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	DB        DBConfig        `json:"db"`
+	Auth      AuthConfig      `json:"auth"`
+	Mail      MailConfig      `json:"mail"`
+	Uploads   UploadConfig    `json:"uploads"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+}
+
+type ServerConfig struct {
+	ListenAddress string   `json:"listen_address"`
+	CORSOrigins   []string `json:"cors_origins"`
+	// Reverse proxies whose X-Forwarded-For is believed, as IPs or CIDRs. Empty means the client
+	// IP is always the address of the connection, so the header can't dodge per-IP rate limits.
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+type AuthConfig struct {
+	// Shorthand for a single HS256 key; its key ID is derived from the secret
+	JWTSecret string `json:"jwt_secret"`
+	// Secrets that signed tokens before the last rotation; tokens signed with them are still accepted
+	PreviousJWTSecrets []string `json:"previous_jwt_secrets"`
+	// Full key set. Every key verifies tokens carrying its ID, only SigningKeyID signs new ones.
+	Keys            []JWTKeyConfig `json:"keys"`
+	SigningKeyID    string         `json:"signing_key_id"`
+	Issuer          string         `json:"issuer"`
+	AccessTokenTTL  Duration       `json:"access_token_ttl"`
+	RefreshTokenTTL Duration       `json:"refresh_token_ttl"`
+	BcryptCost      int            `json:"bcrypt_cost"`
+}
+
+type JWTKeyConfig struct {
+	ID        string `json:"id"`
+	Algorithm string `json:"algorithm"` // HS256, EdDSA or RS256
+	// HS256 only
+	Secret string `json:"secret"`
+	// EdDSA and RS256: a private key is needed to sign, a public key is enough to verify
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKeyFile  string `json:"public_key_file"`
+}
+
+// secretKeyID gives shorthand secrets a stable ID that changes whenever the secret does.
+func secretKeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "hs256-" + hex.EncodeToString(sum[:4])
+}
+
+// resolveKeys turns the JWTSecret shorthand into entries of the key set.
+func (cfg *AuthConfig) resolveKeys() {
+	if cfg.JWTSecret != "" {
+		id := secretKeyID(cfg.JWTSecret)
+		cfg.Keys = append(cfg.Keys, JWTKeyConfig{ID: id, Algorithm: "HS256", Secret: cfg.JWTSecret})
+		if cfg.SigningKeyID == "" {
+			cfg.SigningKeyID = id
+		}
+	}
+	for _, secret := range cfg.PreviousJWTSecrets {
+		cfg.Keys = append(cfg.Keys, JWTKeyConfig{ID: secretKeyID(secret), Algorithm: "HS256", Secret: secret})
+	}
+}
+
+func (cfg *AuthConfig) validateKeys() []string {
+	var problems []string
+	if len(cfg.Keys) == 0 {
+		return []string{"auth.jwt_secret (JWT_SECRET) or auth.keys is required"}
+	}
+
+	seen := map[string]bool{}
+	signingKeyFound := false
+	for i, key := range cfg.Keys {
+		name := fmt.Sprintf("auth.keys[%d]", i)
+		if key.ID == "" {
+			problems = append(problems, name+".id must not be empty")
+		} else if seen[key.ID] {
+			problems = append(problems, fmt.Sprintf("%s.id %q is used by more than one key", name, key.ID))
+		}
+		seen[key.ID] = true
+
+		switch key.Algorithm {
+		case "HS256":
+			if len(key.Secret) < 32 {
+				problems = append(problems, fmt.Sprintf("%s (%s) secret must be at least 32 characters long", name, key.ID))
+			} else if key.Secret == "your_secret_key" {
+				problems = append(problems, fmt.Sprintf("%s (%s) secret still has the example value", name, key.ID))
+			}
+		case "EdDSA", "RS256":
+			if key.PrivateKeyFile == "" && key.PublicKeyFile == "" {
+				problems = append(problems, fmt.Sprintf("%s (%s) needs private_key_file or public_key_file", name, key.ID))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s (%s) algorithm %q must be one of HS256, EdDSA, RS256", name, key.ID, key.Algorithm))
+		}
+
+		if key.ID == cfg.SigningKeyID {
+			signingKeyFound = true
+			if (key.Algorithm == "EdDSA" || key.Algorithm == "RS256") && key.PrivateKeyFile == "" {
+				problems = append(problems, fmt.Sprintf("signing key %q needs private_key_file", key.ID))
+			}
+		}
+	}
+	if !signingKeyFound {
+		problems = append(problems, fmt.Sprintf("auth.signing_key_id (JWT_SIGNING_KEY_ID) %q does not match any key", cfg.SigningKeyID))
+	}
+	return problems
+}
+
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled"`
+	// Token buckets: Requests per Per, refilled evenly
+	Login         RateConfig `json:"login"`          // per IP
+	Register      RateConfig `json:"register"`       // per IP
+	PasswordReset RateConfig `json:"password_reset"` // per IP
+	Post          RateConfig `json:"post"`           // per account
+	Upload        RateConfig `json:"upload"`         // per account
+	Draft         RateConfig `json:"draft"`          // per account, REST and WebSocket saves
+	// Progressive lockout after failed logins: LockoutBase after LockoutThreshold failures
+	// within FailureWindow, doubling with every further failure up to LockoutMax
+	LockoutThreshold int      `json:"lockout_threshold"`
+	LockoutBase      Duration `json:"lockout_base"`
+	LockoutMax       Duration `json:"lockout_max"`
+	FailureWindow    Duration `json:"failure_window"`
+}
+
+type RateConfig struct {
+	Requests int      `json:"requests"`
+	Per      Duration `json:"per"`
+}
+
+type UploadConfig struct {
+	Storage   string `json:"storage"` // only "local" for now
+	Dir       string `json:"dir"`
+	PublicURL string `json:"public_url"`
+	// Files only handed out after a permission check, such as post attachments. Must not be
+	// inside Dir, which is served to everyone.
+	PrivateDir string `json:"private_dir"`
+	// Limits checked before an image is decoded
+	MaxFileSize int `json:"max_file_size"` // bytes
+	MaxWidth    int `json:"max_width"`
+	MaxHeight   int `json:"max_height"`
+	// Square sizes avatars are cropped to, in pixels; entities reference the first one
+	AvatarSizes []int `json:"avatar_sizes"`
+	// Longest side of image thumbnails, in pixels
+	ThumbnailSize int `json:"thumbnail_size"`
+	// Bytes of images one user may have uploaded in total
+	UserQuota int `json:"user_quota"`
+}
+
+// Duration is a time.Duration written as "15m" or "168h" in the config file.
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"15m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			ListenAddress: ":8080",
+		},
+		DB: DBConfig{
+			User:     "user",
+			Password: "password",
+			Host:     "localhost",
+			Port:     "3306",
+			Name:     "cuento",
+		},
+		Auth: AuthConfig{
+			Issuer:          "cuento-backend",
+			AccessTokenTTL:  Duration(24 * time.Hour),
+			RefreshTokenTTL: Duration(7 * 24 * time.Hour),
+			BcryptCost:      14,
+		},
+		Mail: MailConfig{
+			Transport: "none",
+			From:      "noreply@localhost",
+			SMTPHost:  "localhost",
+			SMTPPort:  "25",
+			FileDir:   "./mail",
+			BaseURL:   "http://localhost",
+		},
+		Uploads: UploadConfig{
+			Storage:       "local",
+			Dir:           "./uploads",
+			PrivateDir:    "./private",
+			PublicURL:     "/uploads",
+			MaxFileSize:   5 << 20,
+			MaxWidth:      4096,
+			MaxHeight:     4096,
+			AvatarSizes:   []int{200, 100, 50},
+			ThumbnailSize: 320,
+			UserQuota:     100 << 20,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:          true,
+			Login:            RateConfig{Requests: 10, Per: Duration(time.Minute)},
+			Register:         RateConfig{Requests: 5, Per: Duration(time.Hour)},
+			PasswordReset:    RateConfig{Requests: 5, Per: Duration(time.Hour)},
+			Post:             RateConfig{Requests: 10, Per: Duration(time.Minute)},
+			Upload:           RateConfig{Requests: 30, Per: Duration(time.Hour)},
+			Draft:            RateConfig{Requests: 30, Per: Duration(time.Minute)},
+			LockoutThreshold: 5,
+			LockoutBase:      Duration(time.Minute),
+			LockoutMax:       Duration(time.Hour),
+			FailureWindow:    Duration(time.Hour),
+		},
+	}
+}
+
+// Load builds the config from defaults, then the JSON file at path (if it exists),
+// then environment variables, and validates the result.
+func Load(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+			}
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	cfg.Auth.resolveKeys()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) applyEnv() error {
+	cfg.Server.ListenAddress = getEnv("LISTEN_ADDRESS", cfg.Server.ListenAddress)
+	cfg.Server.CORSOrigins = getEnvList("CORS_ORIGINS", cfg.Server.CORSOrigins)
+	cfg.Server.TrustedProxies = getEnvList("TRUSTED_PROXIES", cfg.Server.TrustedProxies)
+
+	cfg.DB.User = getEnv("DB_USER", cfg.DB.User)
+	cfg.DB.Password = getEnv("DB_PASSWORD", cfg.DB.Password)
+	cfg.DB.Host = getEnv("DB_HOST", cfg.DB.Host)
+	cfg.DB.Port = getEnv("DB_PORT", cfg.DB.Port)
+	cfg.DB.Name = getEnv("DB_NAME", cfg.DB.Name)
+
+	cfg.Auth.JWTSecret = getEnv("JWT_SECRET", cfg.Auth.JWTSecret)
+	cfg.Auth.PreviousJWTSecrets = getEnvList("JWT_PREVIOUS_SECRETS", cfg.Auth.PreviousJWTSecrets)
+	cfg.Auth.SigningKeyID = getEnv("JWT_SIGNING_KEY_ID", cfg.Auth.SigningKeyID)
+	cfg.Auth.Issuer = getEnv("JWT_ISSUER", cfg.Auth.Issuer)
+	var err error
+	if cfg.Auth.AccessTokenTTL, err = getEnvDuration("ACCESS_TOKEN_TTL", cfg.Auth.AccessTokenTTL); err != nil {
+		return err
+	}
+	if cfg.Auth.RefreshTokenTTL, err = getEnvDuration("REFRESH_TOKEN_TTL", cfg.Auth.RefreshTokenTTL); err != nil {
+		return err
+	}
+	if cfg.Auth.BcryptCost, err = getEnvInt("BCRYPT_COST", cfg.Auth.BcryptCost); err != nil {
+		return err
+	}
+
+	cfg.Mail.Transport = getEnv("MAIL_TRANSPORT", cfg.Mail.Transport)
+	cfg.Mail.From = getEnv("MAIL_FROM", cfg.Mail.From)
+	cfg.Mail.SMTPHost = getEnv("SMTP_HOST", cfg.Mail.SMTPHost)
+	cfg.Mail.SMTPPort = getEnv("SMTP_PORT", cfg.Mail.SMTPPort)
+	cfg.Mail.SMTPUser = getEnv("SMTP_USER", cfg.Mail.SMTPUser)
+	cfg.Mail.SMTPPassword = getEnv("SMTP_PASSWORD", cfg.Mail.SMTPPassword)
+	cfg.Mail.FileDir = getEnv("MAIL_FILE_DIR", cfg.Mail.FileDir)
+	cfg.Mail.BaseURL = getEnv("BOARD_BASE_URL", cfg.Mail.BaseURL)
+
+	cfg.Uploads.Dir = getEnv("UPLOAD_DIR", cfg.Uploads.Dir)
+	cfg.Uploads.PrivateDir = getEnv("PRIVATE_UPLOAD_DIR", cfg.Uploads.PrivateDir)
+	cfg.Uploads.PublicURL = getEnv("UPLOAD_PUBLIC_URL", cfg.Uploads.PublicURL)
+	if cfg.Uploads.MaxFileSize, err = getEnvInt("UPLOAD_MAX_FILE_SIZE", cfg.Uploads.MaxFileSize); err != nil {
+		return err
+	}
+	if cfg.Uploads.UserQuota, err = getEnvInt("UPLOAD_USER_QUOTA", cfg.Uploads.UserQuota); err != nil {
+		return err
+	}
+
+	if value, exists := os.LookupEnv("RATE_LIMIT_ENABLED"); exists {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("RATE_LIMIT_ENABLED must be true or false: %w", err)
+		}
+		cfg.RateLimit.Enabled = enabled
+	}
+	return nil
+}
+
+// Validate reports every problem at once so a broken deployment can be fixed in one go.
+func (cfg *Config) Validate() error {
+	var problems []string
+
+	if cfg.Server.ListenAddress == "" {
+		problems = append(problems, "server.listen_address (LISTEN_ADDRESS) must not be empty")
+	}
+	if len(cfg.Server.CORSOrigins) == 0 {
+		problems = append(problems, "server.cors_origins (CORS_ORIGINS) must list the origins the frontend is served from")
+	}
+
+	problems = append(problems, cfg.Auth.validateKeys()...)
+	if cfg.Auth.Issuer == "" {
+		problems = append(problems, "auth.issuer (JWT_ISSUER) must not be empty")
+	}
+	if cfg.Auth.AccessTokenTTL <= 0 {
+		problems = append(problems, "auth.access_token_ttl (ACCESS_TOKEN_TTL) must be positive")
+	}
+	if cfg.Auth.RefreshTokenTTL <= cfg.Auth.AccessTokenTTL {
+		problems = append(problems, "auth.refresh_token_ttl (REFRESH_TOKEN_TTL) must be longer than the access token TTL")
+	}
+	if cfg.Auth.BcryptCost < 10 || cfg.Auth.BcryptCost > 31 {
+		problems = append(problems, "auth.bcrypt_cost (BCRYPT_COST) must be between 10 and 31")
+	}
+
+	if cfg.DB.Host == "" || cfg.DB.Name == "" {
+		problems = append(problems, "db.host (DB_HOST) and db.name (DB_NAME) are required")
+	}
+
+	switch cfg.Mail.Transport {
+	case "smtp", "file", "memory", "none":
+	default:
+		problems = append(problems, fmt.Sprintf("mail.transport (MAIL_TRANSPORT) %q must be one of smtp, file, memory, none", cfg.Mail.Transport))
+	}
+
+	if cfg.RateLimit.Enabled {
+		for name, rate := range map[string]RateConfig{
+			"login":          cfg.RateLimit.Login,
+			"register":       cfg.RateLimit.Register,
+			"password_reset": cfg.RateLimit.PasswordReset,
+			"post":           cfg.RateLimit.Post,
+			"upload":         cfg.RateLimit.Upload,
+			"draft":          cfg.RateLimit.Draft,
+		} {
+			if rate.Requests <= 0 || rate.Per <= 0 {
+				problems = append(problems, fmt.Sprintf("rate_limit.%s needs positive requests and per", name))
+			}
+		}
+		if cfg.RateLimit.LockoutThreshold <= 0 || cfg.RateLimit.LockoutBase <= 0 || cfg.RateLimit.LockoutMax < cfg.RateLimit.LockoutBase || cfg.RateLimit.FailureWindow <= 0 {
+			problems = append(problems, "rate_limit lockout settings need a positive threshold, base and window, and lockout_max >= lockout_base")
+		}
+	}
+
+	if cfg.Uploads.Storage != "local" {
+		problems = append(problems, fmt.Sprintf("uploads.storage %q must be local", cfg.Uploads.Storage))
+	}
+	if cfg.Uploads.Dir == "" {
+		problems = append(problems, "uploads.dir (UPLOAD_DIR) must not be empty")
+	}
+	if cfg.Uploads.PrivateDir == "" {
+		problems = append(problems, "uploads.private_dir (PRIVATE_UPLOAD_DIR) must not be empty")
+	} else if cfg.Uploads.Dir != "" && isWithin(cfg.Uploads.PrivateDir, cfg.Uploads.Dir) {
+		problems = append(problems, "uploads.private_dir (PRIVATE_UPLOAD_DIR) must not be inside uploads.dir, which is served publicly")
+	}
+	if cfg.Uploads.MaxFileSize <= 0 || cfg.Uploads.MaxWidth <= 0 || cfg.Uploads.MaxHeight <= 0 {
+		problems = append(problems, "uploads.max_file_size (UPLOAD_MAX_FILE_SIZE), max_width and max_height must be positive")
+	}
+	if cfg.Uploads.UserQuota < cfg.Uploads.MaxFileSize {
+		problems = append(problems, "uploads.user_quota (UPLOAD_USER_QUOTA) must be at least uploads.max_file_size")
+	}
+	if len(cfg.Uploads.AvatarSizes) == 0 || cfg.Uploads.ThumbnailSize <= 0 {
+		problems = append(problems, "uploads.avatar_sizes needs at least one size and uploads.thumbnail_size must be positive")
+	}
+	for _, size := range cfg.Uploads.AvatarSizes {
+		if size <= 0 || size > 1024 {
+			problems = append(problems, fmt.Sprintf("uploads.avatar_sizes entry %d must be between 1 and 1024", size))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func getEnvList(key string, fallback []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	return n, nil
+}
+
+func getEnvDuration(key string, fallback Duration) (Duration, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be a duration like \"15m\": %w", key, err)
+	}
+	return Duration(d), nil
+}
+
+// isWithin reports whether dir is parent or lies below it.
+func isWithin(dir string, parent string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absParent, absDir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -6,21 +6,11 @@ import (
 )
 
 type DBConfig struct {
-	User     string
-	Password string
-	Host     string
-	Port     string
-	Name     string
-}
-
-func LoadDBConfig() *DBConfig {
-	return &DBConfig{
-		User:     getEnv("DB_USER", "user"),
-		Password: getEnv("DB_PASSWORD", "password"),
-		Host:     getEnv("DB_HOST", "localhost"),
-		Port:     getEnv("DB_PORT", "3306"),
-		Name:     getEnv("DB_NAME", "cuento"),
-	}
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Name     string `json:"name"`
 }
 
 func (cfg *DBConfig) DSN() string {
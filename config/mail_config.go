@@ -0,0 +1,16 @@
+package config
+
+type MailConfig struct {
+	Transport    string `json:"transport"` // smtp, file, memory or none
+	From         string `json:"from"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     string `json:"smtp_port"`
+	SMTPUser     string `json:"smtp_user"`
+	SMTPPassword string `json:"smtp_password"`
+	FileDir      string `json:"file_dir"`
+	BaseURL      string `json:"base_url"`
+}
+
+func (cfg *MailConfig) SMTPAddr() string {
+	return cfg.SMTPHost + ":" + cfg.SMTPPort
+}
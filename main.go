@@ -1,47 +1,118 @@
 package main
 
 import (
+	"cuento-backend/config"
 	"cuento-backend/src/Controllers"
 	"cuento-backend/src/Install"
 	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/RateLimit"
 	"cuento-backend/src/Router"
 	"cuento-backend/src/Services"
 	"cuento-backend/src/Websockets"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	Services.InitDB()
+	configPath := os.Getenv("CUENTO_CONFIG")
+	if configPath == "" {
+		configPath = "config.json"
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keys, err := Middlewares.NewKeySet(&cfg.Auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	Services.InitDB(&cfg.DB)
+	Services.InitMailer(&cfg.Mail)
+	Services.InitUploads(&cfg.Uploads)
+	if err := Services.LoadBBCodeConfig(Services.DB); err != nil {
+		log.Printf("Error loading BBCode config, using the default tag set: %v", err)
+	}
 	Services.RegisterEventHandlers(Services.DB)
 
 	// Start WebSocket Hub
 	go Websockets.MainHub.Run()
 
+	// Start background schedulers
+	go Services.StartInactivityScheduler(Services.DB)
+	go Services.StartDigestScheduler(Services.DB)
+	go Services.StartAttachmentCleanupScheduler(Services.DB)
+	go Services.StartContentRerender(Services.DB)
+
 	r := gin.Default()
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
-	r.Use(cors.New(config))
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid server.trusted_proxies: %v", err)
+	}
+	corsConfig := cors.DefaultConfig()
+	if len(cfg.Server.CORSOrigins) == 1 && cfg.Server.CORSOrigins[0] == "*" {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.Server.CORSOrigins
+	}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	r.Use(cors.New(corsConfig))
 
 	// Apply error middleware globally
 	r.Use(Middlewares.ErrorMiddleware())
 
+	// Locally stored uploads are served by this server unless public_url points elsewhere
+	if strings.HasPrefix(cfg.Uploads.PublicURL, "/") {
+		r.Static(cfg.Uploads.PublicURL, cfg.Uploads.Dir)
+	}
+
+	// Rate limits are declared next to the routes they protect
+	rateLimitStore := RateLimit.NewMemoryStore()
+	limiter := RateLimit.NewLimiter(rateLimitStore, cfg.RateLimit.Enabled)
+	lockout := RateLimit.NewLockout(rateLimitStore, &cfg.RateLimit)
+	loginLimit := RateLimit.PerIP("login", cfg.RateLimit.Login)
+	registerLimit := RateLimit.PerIP("register", cfg.RateLimit.Register)
+	passwordResetLimit := RateLimit.PerIP("password_reset", cfg.RateLimit.PasswordReset)
+	postLimit := RateLimit.PerAccount("post", cfg.RateLimit.Post)
+	uploadLimit := RateLimit.PerAccount("upload", cfg.RateLimit.Upload)
+	draftLimit := RateLimit.PerAccount("draft", cfg.RateLimit.Draft)
+
 	// Public routes
 	publicRouter := Router.NewCustomRouter(r.Group("/"))
+	publicRouter.SetLimiter(limiter)
 
 	// User routes (Public)
-	publicRouter.POST("/register", "Register a new user account", func(c *gin.Context) {
-		Controllers.Register(c, Services.DB)
+	publicRouter.Limit(registerLimit).POST("/register", "Register a new user account", func(c *gin.Context) {
+		Controllers.Register(c, Services.DB, &cfg.Auth)
 	})
-	publicRouter.POST("/login", "Login with user credentials", func(c *gin.Context) {
-		Controllers.Login(c, Services.DB)
+	publicRouter.Limit(loginLimit).POST("/login", "Login with user credentials", lockout.Middleware(RateLimit.LoginUsername), func(c *gin.Context) {
+		Controllers.Login(c, Services.DB, &cfg.Auth, keys)
+	})
+	publicRouter.Limit(loginLimit).POST("/login/2fa", "Finish login with a two-factor code", lockout.Middleware(func(c *gin.Context) string {
+		return Controllers.TwoFactorLoginAccount(c, Services.DB)
+	}), func(c *gin.Context) {
+		Controllers.LoginTwoFactor(c, Services.DB, &cfg.Auth, keys)
 	})
 	publicRouter.POST("/refresh", "Refresh access token", func(c *gin.Context) {
-		Controllers.RefreshToken(c, Services.DB)
+		Controllers.RefreshToken(c, Services.DB, &cfg.Auth, keys)
+	})
+	publicRouter.POST("/email/verify", "Verify email address with a token from the verification email", func(c *gin.Context) {
+		Controllers.VerifyEmail(c, Services.DB)
+	})
+	publicRouter.Limit(passwordResetLimit).POST("/password/forgot", "Request a password reset email", func(c *gin.Context) {
+		Controllers.ForgotPassword(c, Services.DB)
+	})
+	publicRouter.POST("/password/reset", "Set a new password with a token from the reset email", func(c *gin.Context) {
+		Controllers.ResetPassword(c, Services.DB, &cfg.Auth)
+	})
+	publicRouter.POST("/email/change/confirm", "Confirm a new email address with a token from the confirmation email", func(c *gin.Context) {
+		Controllers.ConfirmEmailChange(c, Services.DB)
 	})
 	publicRouter.GET("/board/info", "Get board information", func(c *gin.Context) {
 		Controllers.GetBoard(c, Services.DB)
@@ -49,8 +120,11 @@ func main() {
 
 	// Optional Auth routes (Context populated if token present, otherwise Guest)
 	optionalAuthGroup := r.Group("/")
-	optionalAuthGroup.Use(Middlewares.OptionalAuthMiddleware())
+	optionalAuthGroup.Use(Middlewares.OptionalAuthMiddleware(keys, Services.DB))
 	optionalAuthRouter := Router.NewCustomRouter(optionalAuthGroup)
+	optionalAuthRouter.POST("/logout", "End the current session", func(c *gin.Context) {
+		Controllers.Logout(c, Services.DB)
+	})
 	optionalAuthRouter.GET("/categories/home", "Get home page categories", func(c *gin.Context) {
 		Controllers.GetHomeCategories(c, Services.DB)
 	})
@@ -96,15 +170,37 @@ func main() {
 	optionalAuthRouter.GET("/topic-posts/:id/:page", "Get posts in a topic by page", func(c *gin.Context) {
 		Controllers.GetPostsByTopic(c, Services.DB)
 	})
+	optionalAuthRouter.GET("/bbcode/tags", "Get the BBCode tag set", func(c *gin.Context) {
+		Controllers.GetBBCodeTags(c)
+	})
+	optionalAuthRouter.GET("/post/replies/:id", "Get the posts quoting a post", func(c *gin.Context) {
+		Controllers.GetPostReplies(c, Services.DB)
+	})
+	optionalAuthRouter.GET("/attachment/:id", "Download a post attachment", func(c *gin.Context) {
+		Controllers.ServeAttachment(c, Services.DB, false)
+	})
+	optionalAuthRouter.GET("/attachment/:id/thumbnail", "Get the thumbnail of an image attachment", func(c *gin.Context) {
+		Controllers.ServeAttachment(c, Services.DB, true)
+	})
 	optionalAuthRouter.GET("/users/page/:page_type/:page_id", "Get users currently viewing a page", func(c *gin.Context) {
 		Controllers.GetUsersByPage(c, Services.DB)
 	})
+	optionalAuthRouter.GET("/wanted/get/:id", "Get wanted character by ID", func(c *gin.Context) {
+		Controllers.GetWanted(c, Services.DB)
+	})
+	optionalAuthRouter.POST("/wanted/list", "Get filtered list of wanted characters", func(c *gin.Context) {
+		Controllers.GetWantedList(c, Services.DB)
+	})
+	optionalAuthRouter.GET("/user/:id", "Get public profile of a user", func(c *gin.Context) {
+		Controllers.GetPublicUser(c, Services.DB)
+	})
 
 	// Protected routes
 	protectedGroup := r.Group("/")
-	protectedGroup.Use(Middlewares.AuthMiddleware())
+	protectedGroup.Use(Middlewares.AuthMiddleware(keys, Services.DB))
 	protectedGroup.Use(Middlewares.PermissionsMiddleware(Services.DB))
 	protectedRouter := Router.NewCustomRouter(protectedGroup)
+	protectedRouter.SetLimiter(limiter)
 
 	protectedRouter.GET("/character/get/:id", "Get character details by ID", func(c *gin.Context) {
 		Controllers.GetCharacter(c, Services.DB)
@@ -115,6 +211,30 @@ func main() {
 	protectedRouter.PATCH("/character/update/:id", "Update character by ID", func(c *gin.Context) {
 		Controllers.PatchCharacter(c, Services.DB)
 	})
+	protectedRouter.PATCH("/character-profile/update/:id", "Update character profile by ID", func(c *gin.Context) {
+		Controllers.PatchCharacterProfile(c, Services.DB)
+	})
+	protectedRouter.POST("/character/transfer/offer", "Offer own character to another user", func(c *gin.Context) {
+		Controllers.OfferCharacterTransfer(c, Services.DB)
+	})
+	protectedRouter.POST("/character/transfer/reassign", "Reassign any character to another user", func(c *gin.Context) {
+		Controllers.ReassignCharacter(c, Services.DB)
+	})
+	protectedRouter.POST("/character/transfer/accept/:id", "Accept a character transfer", func(c *gin.Context) {
+		Controllers.AcceptCharacterTransfer(c, Services.DB)
+	})
+	protectedRouter.POST("/character/transfer/decline/:id", "Decline a character transfer", func(c *gin.Context) {
+		Controllers.DeclineCharacterTransfer(c, Services.DB)
+	})
+	protectedRouter.POST("/character/transfer/cancel/:id", "Cancel a character transfer", func(c *gin.Context) {
+		Controllers.CancelCharacterTransfer(c, Services.DB)
+	})
+	protectedRouter.GET("/character/transfers/:id", "Get character ownership history", func(c *gin.Context) {
+		Controllers.GetCharacterTransferHistory(c, Services.DB)
+	})
+	protectedRouter.GET("/user/character-transfers", "Get current user's pending character transfers", func(c *gin.Context) {
+		Controllers.GetUserCharacterTransfers(c, Services.DB)
+	})
 	protectedRouter.GET("/user/characters", "Get current user's characters", func(c *gin.Context) {
 		Controllers.GetUserCharacters(c, Services.DB)
 	})
@@ -132,26 +252,187 @@ func main() {
 	protectedRouter.POST("/template/:type/update", "Update character template by type", func(c *gin.Context) {
 		Controllers.UpdateTemplate(c, Services.DB)
 	})
-	protectedRouter.POST("/episode/create", "Create a new episode", func(c *gin.Context) {
+	protectedRouter.POST("/wanted/create", "Create a wanted character", func(c *gin.Context) {
+		Controllers.CreateWanted(c, Services.DB)
+	})
+	protectedRouter.PATCH("/wanted/update/:id", "Update own wanted character", func(c *gin.Context) {
+		Controllers.PatchWanted(c, Services.DB)
+	})
+	protectedRouter.POST("/wanted/claim/:id", "Claim a wanted character", func(c *gin.Context) {
+		Controllers.ClaimWanted(c, Services.DB)
+	})
+	protectedRouter.GET("/wanted/claims/:id", "Get claims for own wanted character", func(c *gin.Context) {
+		Controllers.GetWantedClaims(c, Services.DB)
+	})
+	protectedRouter.POST("/wanted/claim/accept/:id", "Accept a claim for own wanted character", func(c *gin.Context) {
+		Controllers.AcceptWantedClaim(c, Services.DB)
+	})
+	protectedRouter.POST("/wanted/claim/decline/:id", "Decline a claim for own wanted character", func(c *gin.Context) {
+		Controllers.DeclineWantedClaim(c, Services.DB)
+	})
+	protectedRouter.Limit(postLimit).POST("/episode/create", "Create a new episode", func(c *gin.Context) {
 		Controllers.CreateEpisode(c, Services.DB)
 	})
+	protectedRouter.PATCH("/episode/update/:id", "Update episode by ID", func(c *gin.Context) {
+		Controllers.PatchEpisode(c, Services.DB)
+	})
 	protectedRouter.GET("/permission-matrix/get", "Get permission matrix", func(c *gin.Context) {
 		Controllers.GetPermissionMatrix(c, Services.DB)
 	})
 	protectedRouter.POST("/permission-matrix/update", "Update permission matrix", func(c *gin.Context) {
 		Controllers.UpdatePermissionMatrix(c, Services.DB)
 	})
-	protectedRouter.POST("/post/create", "Create a new post in a topic", func(c *gin.Context) {
+	protectedRouter.Limit(postLimit).POST("/post/create", "Create a new post in a topic", func(c *gin.Context) {
 		Controllers.CreatePost(c, Services.DB)
 	})
+	protectedRouter.Limit(postLimit).POST("/post/update/:id", "Edit a post", func(c *gin.Context) {
+		Controllers.UpdatePost(c, Services.DB)
+	})
+	protectedRouter.POST("/mark-read/subforum/:id", "Mark all topics in a subforum as read", func(c *gin.Context) {
+		Controllers.MarkSubforumRead(c, Services.DB)
+	})
+	protectedRouter.POST("/mark-read/board", "Mark the whole board as read", func(c *gin.Context) {
+		Controllers.MarkBoardRead(c, Services.DB)
+	})
+	protectedRouter.POST("/subscribe/:type/:id", "Subscribe to a topic or subforum", func(c *gin.Context) {
+		Controllers.Subscribe(c, Services.DB)
+	})
+	protectedRouter.POST("/unsubscribe/:type/:id", "Unsubscribe from a topic or subforum", func(c *gin.Context) {
+		Controllers.Unsubscribe(c, Services.DB)
+	})
+	protectedRouter.GET("/user/subscriptions", "Get current user's subscriptions", func(c *gin.Context) {
+		Controllers.GetUserSubscriptions(c, Services.DB)
+	})
+	protectedRouter.POST("/logout/all", "End all sessions of the current user", func(c *gin.Context) {
+		Controllers.LogoutEverywhere(c, Services.DB)
+	})
+	protectedRouter.GET("/user/sessions", "Get current user's active sessions", func(c *gin.Context) {
+		Controllers.GetUserSessions(c, Services.DB)
+	})
+	protectedRouter.POST("/user/sessions/revoke/:id", "End one of current user's sessions", func(c *gin.Context) {
+		Controllers.RevokeUserSession(c, Services.DB)
+	})
+	protectedRouter.GET("/user/2fa/status", "Get current user's two-factor authentication status", func(c *gin.Context) {
+		Controllers.GetTwoFactorStatus(c, Services.DB)
+	})
+	protectedRouter.POST("/user/2fa/enrol", "Start two-factor authentication setup", func(c *gin.Context) {
+		Controllers.EnrolTwoFactor(c, Services.DB)
+	})
+	protectedRouter.POST("/user/2fa/confirm", "Confirm two-factor authentication setup with a code", func(c *gin.Context) {
+		Controllers.ConfirmTwoFactor(c, Services.DB)
+	})
+	protectedRouter.POST("/user/2fa/recovery-codes", "Regenerate two-factor recovery codes", func(c *gin.Context) {
+		Controllers.RegenerateRecoveryCodes(c, Services.DB)
+	})
+	protectedRouter.POST("/user/2fa/disable", "Disable two-factor authentication", func(c *gin.Context) {
+		Controllers.DisableTwoFactor(c, Services.DB)
+	})
+	protectedRouter.POST("/email/verify/request", "Send a new email verification link", func(c *gin.Context) {
+		Controllers.RequestEmailVerification(c, Services.DB)
+	})
+	protectedRouter.Limit(uploadLimit).POST("/upload/image", "Upload an avatar or image", func(c *gin.Context) {
+		Controllers.UploadImage(c, Services.DB)
+	})
+	protectedRouter.GET("/user/uploads", "Get current user's uploads", func(c *gin.Context) {
+		Controllers.GetUserUploads(c, Services.DB)
+	})
+	protectedRouter.POST("/upload/delete/:id", "Delete one of the current user's uploads", func(c *gin.Context) {
+		Controllers.DeleteUpload(c, Services.DB)
+	})
+	protectedRouter.GET("/bbcode/config", "Get BBCode tag configuration", func(c *gin.Context) {
+		Controllers.GetBBCodeConfig(c, Services.DB)
+	})
+	protectedRouter.POST("/bbcode/config/update", "Enable or disable BBCode tags and define custom tags", func(c *gin.Context) {
+		Controllers.UpdateBBCodeConfig(c, Services.DB)
+	})
+	protectedRouter.GET("/drafts", "Get current user's drafts", func(c *gin.Context) {
+		Controllers.GetDrafts(c, Services.DB)
+	})
+	protectedRouter.GET("/draft/:type/:id", "Get a draft to restore", func(c *gin.Context) {
+		Controllers.GetDraft(c, Services.DB)
+	})
+	protectedRouter.Limit(draftLimit).POST("/draft/save/:type/:id", "Save a draft", func(c *gin.Context) {
+		Controllers.SaveDraft(c, Services.DB)
+	})
+	protectedRouter.POST("/draft/delete/:type/:id", "Discard a draft", func(c *gin.Context) {
+		Controllers.DeleteDraft(c, Services.DB)
+	})
+	protectedRouter.Limit(uploadLimit).POST("/attachment/upload/:topic_id", "Upload a file to attach to a post in a topic", func(c *gin.Context) {
+		Controllers.UploadAttachment(c, Services.DB)
+	})
+	protectedRouter.GET("/attachment/pending/:topic_id", "Get current user's unposted attachments for a topic", func(c *gin.Context) {
+		Controllers.GetPendingAttachments(c, Services.DB)
+	})
+	protectedRouter.POST("/attachment/delete/:id", "Delete an unposted attachment", func(c *gin.Context) {
+		Controllers.DeleteAttachment(c, Services.DB)
+	})
+	protectedRouter.POST("/user/settings", "Update current user's avatar, language and timezone", func(c *gin.Context) {
+		Controllers.UpdateUserSettings(c, Services.DB)
+	})
+	protectedRouter.PATCH("/user/fields", "Update current user's custom profile fields", func(c *gin.Context) {
+		Controllers.UpdateUserFields(c, Services.DB)
+	})
+	protectedRouter.POST("/user/password", "Change current user's password", func(c *gin.Context) {
+		Controllers.ChangePassword(c, Services.DB, &cfg.Auth)
+	})
+	protectedRouter.POST("/user/email", "Request a change of current user's email address", func(c *gin.Context) {
+		Controllers.RequestEmailChange(c, Services.DB)
+	})
+	protectedRouter.GET("/user/email-preferences", "Get current user's email notification preferences", func(c *gin.Context) {
+		Controllers.GetEmailPreferences(c, Services.DB)
+	})
+	protectedRouter.POST("/user/email-preferences", "Update current user's email notification preferences", func(c *gin.Context) {
+		Controllers.UpdateEmailPreferences(c, Services.DB)
+	})
+	protectedRouter.GET("/notifications/list/:page", "Get current user's notifications", func(c *gin.Context) {
+		Controllers.GetNotifications(c, Services.DB)
+	})
+	protectedRouter.GET("/notifications/unread-count", "Get current user's unread notification count", func(c *gin.Context) {
+		Controllers.GetUnreadNotificationCount(c, Services.DB)
+	})
+	protectedRouter.POST("/notifications/read/:id", "Mark a notification as read", func(c *gin.Context) {
+		Controllers.MarkNotificationRead(c, Services.DB)
+	})
+	protectedRouter.POST("/notifications/read-all", "Mark all notifications as read", func(c *gin.Context) {
+		Controllers.MarkAllNotificationsRead(c, Services.DB)
+	})
+	protectedRouter.Limit(postLimit).POST("/conversation/create", "Start a private conversation", func(c *gin.Context) {
+		Controllers.CreateConversation(c, Services.DB)
+	})
+	protectedRouter.GET("/conversations/list/:page", "Get current user's conversations", func(c *gin.Context) {
+		Controllers.GetConversations(c, Services.DB)
+	})
+	protectedRouter.GET("/conversation/messages/:id/:page", "Get conversation messages and mark them read", func(c *gin.Context) {
+		Controllers.GetConversationMessages(c, Services.DB)
+	})
+	protectedRouter.Limit(postLimit).POST("/conversation/message/:id", "Send a message to a conversation", func(c *gin.Context) {
+		Controllers.SendMessage(c, Services.DB)
+	})
+	protectedRouter.POST("/conversation/add/:id", "Add participants to a conversation", func(c *gin.Context) {
+		Controllers.AddConversationParticipants(c, Services.DB)
+	})
+	protectedRouter.POST("/conversation/leave/:id", "Leave a conversation", func(c *gin.Context) {
+		Controllers.LeaveConversation(c, Services.DB)
+	})
+	protectedRouter.POST("/conversation/mute/:id", "Mute or unmute a conversation", func(c *gin.Context) {
+		Controllers.MuteConversation(c, Services.DB)
+	})
+	protectedRouter.GET("/inactivity/report", "Get inactivity dry-run report", func(c *gin.Context) {
+		Controllers.GetInactivityReport(c, Services.DB)
+	})
+	protectedRouter.GET("/inactivity/log/:page", "Get automatic status change log", func(c *gin.Context) {
+		Controllers.GetStatusChangeLog(c, Services.DB)
+	})
 
 	// WebSocket route with special authentication
 	wsGroup := r.Group("/")
-	wsGroup.Use(Middlewares.WebSocketAuthMiddleware())
+	wsGroup.Use(Middlewares.WebSocketAuthMiddleware(keys, Services.DB))
 	wsRouter := Router.NewCustomRouter(wsGroup)
 	wsRouter.GET("/ws", "WebSocket connection endpoint", func(c *gin.Context) {
-		Controllers.HandleWebSocket(c, Services.DB)
+		Controllers.HandleWebSocket(c, Services.DB, limiter, draftLimit)
 	})
 
-	r.Run() // listen and serve on 0.0.0.0:8080
+	if err := r.Run(cfg.Server.ListenAddress); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,242 @@
+package BBCode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/frustra/bbcode"
+)
+
+// Context carries what tags may reference but the text alone doesn't contain. Tags whose
+// reference isn't in the context are left as typed.
+type Context struct {
+	Attachments map[int]Attachment
+	Quotes      map[int]QuotedPost
+	Rolls       map[int]Roll
+
+	// Rolls a [dice] tag showed. The others are listed after the text, so a roll can't be hidden
+	// by wrapping its tag in [code] or any other tag that doesn't render it.
+	shownRolls map[int]bool
+}
+
+// Attachment is a file placed with [attachment]id[/attachment].
+type Attachment struct {
+	FileName     string
+	Url          string
+	ThumbnailUrl *string
+}
+
+// QuotedPost attributes a [quote=post_id] block.
+type QuotedPost struct {
+	AuthorName string
+	TopicId    int
+}
+
+// Roll is a dice roll made by the server, shown with [dice=id][/dice].
+type Roll struct {
+	Notation string
+	Results  []int
+	Modifier int
+	Total    int
+}
+
+// RendererVersion must be bumped whenever a change to the tags changes their HTML, so stored
+// HTML rendered by older code is regenerated.
+const RendererVersion = 2
+
+// TagFunc compiles one tag. Returning true appends the compiled children to the tag.
+type TagFunc func(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool)
+
+type builtinTag struct {
+	Description string
+	Compile     TagFunc
+	// Tags that only make sense inside another one, like table cells, are switched off with it
+	Parent string
+}
+
+// Config is what board admins can change: built-in tags to switch off and their own simple tags.
+type Config struct {
+	Disabled   []string    `json:"disabled"`
+	CustomTags []CustomTag `json:"custom_tags"`
+}
+
+// CustomTag wraps its content in an element with a class, e.g. [ooc] -> <span class="bb-ooc ooc">.
+type CustomTag struct {
+	Name        string `json:"name"`
+	Element     string `json:"element"`
+	ClassName   string `json:"class_name"`
+	Description string `json:"description"`
+}
+
+// TagInfo describes a tag for editors and the admin panel.
+type TagInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Custom      bool   `json:"custom"`
+}
+
+var (
+	tagNamePattern   = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+	classNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+( [a-zA-Z0-9_-]+)*$`)
+	customElements   = map[string]bool{
+		"span": true, "div": true, "p": true, "small": true, "strong": true, "em": true,
+		"mark": true, "sup": true, "sub": true, "aside": true, "blockquote": true,
+	}
+)
+
+// Registry holds the tag set. Rendering is safe while the configuration changes.
+type Registry struct {
+	mu       sync.RWMutex
+	builtin  map[string]builtinTag
+	disabled map[string]bool
+	custom   []CustomTag
+	version  string
+}
+
+// Default is the registry used to render posts, messages and custom fields.
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{builtin: builtinTags(), disabled: map[string]bool{}, version: configVersion(Config{})}
+}
+
+// configVersion identifies the HTML a configuration produces: the renderer version plus a hash
+// of the configuration, so HTML stored before a tag set change is known to be stale.
+func configVersion(cfg Config) string {
+	normalized := Config{Disabled: append([]string{}, cfg.Disabled...), CustomTags: append([]CustomTag{}, cfg.CustomTags...)}
+	sort.Strings(normalized.Disabled)
+	raw, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(raw)
+	return fmt.Sprintf("%d-%s", RendererVersion, hex.EncodeToString(sum[:8]))
+}
+
+// Version is stored next to rendered HTML. HTML with another version must be rendered again.
+func (r *Registry) Version() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.version
+}
+
+// Validate checks a configuration without applying it.
+func (r *Registry) Validate(cfg Config) error {
+	var problems []string
+	for _, name := range cfg.Disabled {
+		if _, ok := r.builtin[name]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown tag %q in disabled", name))
+		}
+	}
+	seen := map[string]bool{}
+	for _, tag := range cfg.CustomTags {
+		_, isBuiltin := r.builtin[tag.Name]
+		switch {
+		case !tagNamePattern.MatchString(tag.Name):
+			problems = append(problems, fmt.Sprintf("custom tag name %q must be lowercase letters, digits and underscores", tag.Name))
+		case isBuiltin:
+			problems = append(problems, fmt.Sprintf("custom tag %q clashes with a built-in tag", tag.Name))
+		case seen[tag.Name]:
+			problems = append(problems, fmt.Sprintf("custom tag %q is defined twice", tag.Name))
+		}
+		seen[tag.Name] = true
+		if !customElements[tag.Element] {
+			problems = append(problems, fmt.Sprintf("custom tag %q: element %q is not allowed", tag.Name, tag.Element))
+		}
+		if tag.ClassName != "" && (len(tag.ClassName) > 64 || !classNamePattern.MatchString(tag.ClassName)) {
+			problems = append(problems, fmt.Sprintf("custom tag %q: class_name must be space-separated letters, digits, - and _", tag.Name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Configure validates and applies a configuration.
+func (r *Registry) Configure(cfg Config) error {
+	if err := r.Validate(cfg); err != nil {
+		return err
+	}
+	disabled := make(map[string]bool, len(cfg.Disabled))
+	for _, name := range cfg.Disabled {
+		disabled[name] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disabled = disabled
+	r.custom = append([]CustomTag(nil), cfg.CustomTags...)
+	r.version = configVersion(cfg)
+	return nil
+}
+
+// Tags lists built-in tags by name, then custom tags in their configured order.
+func (r *Registry) Tags() []TagInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tags []TagInfo
+	for name, tag := range r.builtin {
+		tags = append(tags, TagInfo{Name: name, Description: tag.Description, Enabled: r.enabled(name, tag)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	for _, tag := range r.custom {
+		tags = append(tags, TagInfo{Name: tag.Name, Description: tag.Description, Enabled: true, Custom: true})
+	}
+	return tags
+}
+
+// Render compiles BBCode to HTML with the enabled tags. Disabled and unknown tags stay as typed.
+// The output is sanitized whatever the tags produced, see sanitize.
+func (r *Registry) Render(text string, ctx *Context) string {
+	if ctx == nil {
+		ctx = &Context{}
+	}
+	ctx.shownRolls = nil
+
+	compiler := bbcode.NewCompiler(true, true)
+	compiler.SortOutputAttributes = true
+	for name := range bbcode.DefaultTagCompilers {
+		compiler.SetTag(name, nil)
+	}
+
+	r.mu.RLock()
+	for name, tag := range r.builtin {
+		if r.enabled(name, tag) {
+			compile := tag.Compile
+			compiler.SetTag(name, func(node *bbcode.BBCodeNode) (*bbcode.HTMLTag, bool) {
+				return compile(node, ctx)
+			})
+		}
+	}
+	for _, tag := range r.custom {
+		compiler.SetTag(tag.Name, customTagCompiler(tag))
+	}
+	r.mu.RUnlock()
+
+	out := compiler.CompileTree(bbcode.Parse(bbcode.Lex(text)))
+	if hidden := hiddenRolls(ctx); hidden != nil {
+		out.AppendChild(hidden)
+	}
+	sanitize(out)
+	return out.Compile(true)
+}
+
+func (r *Registry) enabled(name string, tag builtinTag) bool {
+	return !r.disabled[name] && (tag.Parent == "" || !r.disabled[tag.Parent])
+}
+
+func customTagCompiler(tag CustomTag) bbcode.TagCompilerFunc {
+	return func(node *bbcode.BBCodeNode) (*bbcode.HTMLTag, bool) {
+		out := bbcode.NewHTMLTag("")
+		out.Name = tag.Element
+		out.Attrs["class"] = strings.TrimSpace("bb-" + tag.Name + " " + tag.ClassName)
+		return out, true
+	}
+}
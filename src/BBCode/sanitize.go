@@ -0,0 +1,98 @@
+package BBCode
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/frustra/bbcode"
+)
+
+// Elements tags may produce and the attributes each may carry. Text and attribute values are
+// always escaped by the compiler, so limiting elements, URLs and styles is enough to keep
+// scripts out whatever a tag (or a future custom tag) emits.
+var allowedAttributes = map[string]map[string]bool{
+	"a":          {"href": true, "class": true, "title": true, "download": true},
+	"img":        {"src": true, "alt": true, "title": true, "class": true},
+	"span":       {"class": true, "style": true, "title": true},
+	"div":        {"class": true, "style": true},
+	"p":          {"class": true},
+	"br":         {},
+	"b":          {},
+	"i":          {},
+	"u":          {},
+	"s":          {},
+	"strong":     {"class": true},
+	"em":         {"class": true},
+	"small":      {"class": true},
+	"mark":       {"class": true},
+	"sup":        {"class": true},
+	"sub":        {"class": true},
+	"aside":      {"class": true},
+	"pre":        {},
+	"blockquote": {"class": true},
+	"cite":       {},
+	"details":    {"class": true},
+	"summary":    {},
+	"table":      {"class": true},
+	"tr":         {},
+	"th":         {},
+	"td":         {},
+}
+
+var (
+	dataAttributePattern = regexp.MustCompile(`^data-[a-z]+(-[a-z]+)*$`)
+	stylePattern         = regexp.MustCompile(`^(color: (#[0-9a-fA-F]{3,8}|[a-zA-Z]+|rgb\(\d{1,3}, ?\d{1,3}, ?\d{1,3}\));|text-align: (left|center|right);)$`)
+	colorPattern         = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]{1,20})$`)
+)
+
+func sanitize(tag *bbcode.HTMLTag) {
+	if tag.Name != "" {
+		allowed, ok := allowedAttributes[tag.Name]
+		if !ok {
+			// Keep the (escaped) text, lose the element
+			tag.Name = ""
+			tag.Attrs = map[string]string{}
+		}
+		for name, value := range tag.Attrs {
+			switch {
+			case name == "href" || name == "src":
+				if allowed[name] && safeURL(value) {
+					continue
+				}
+			case name == "style":
+				if allowed[name] && stylePattern.MatchString(value) {
+					continue
+				}
+			case allowed[name] || dataAttributePattern.MatchString(name):
+				continue
+			}
+			delete(tag.Attrs, name)
+		}
+	}
+	for _, child := range tag.Children {
+		sanitize(child)
+	}
+}
+
+// safeURL allows relative URLs and http(s)/mailto links, which rules out javascript: and data: URLs.
+func safeURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// cleanColor returns a CSS color safe to put in a style attribute, or "".
+func cleanColor(value string) string {
+	value = strings.TrimSpace(value)
+	if colorPattern.MatchString(value) {
+		return value
+	}
+	return ""
+}
@@ -0,0 +1,238 @@
+package BBCode
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/frustra/bbcode"
+)
+
+func builtinTags() map[string]builtinTag {
+	return map[string]builtinTag{
+		"b":          {"Bold text", library("b"), ""},
+		"i":          {"Italic text", library("i"), ""},
+		"u":          {"Underlined text", library("u"), ""},
+		"s":          {"Struck-through text", library("s"), ""},
+		"url":        {"Link: [url]address[/url] or [url=address]text[/url]", library("url"), ""},
+		"img":        {"Image: [img]address[/img]", library("img"), ""},
+		"center":     {"Centered block", library("center"), ""},
+		"color":      {"Colored text: [color=red]text[/color]", library("color"), ""},
+		"size":       {"Text size: [size=1..7]text[/size]", library("size"), ""},
+		"code":       {"Preformatted text, tags inside are not interpreted", library("code"), ""},
+		"quote":      {"Quote: [quote=post_id] credits the post's author, [quote=name] anyone", compileQuote, ""},
+		"spoiler":    {"Collapsed block: [spoiler=title]text[/spoiler]", compileCollapsed("bb-spoiler", "Spoiler"), ""},
+		"hide":       {"Hidden text revealed on click", compileCollapsed("bb-hide", "Hidden text"), ""},
+		"dice":       {"Result of a dice roll made by the server; write [roll]2d6+3[/roll] in a new post", compileDice, ""},
+		"mention":    {"Character mention linking to the sheet: [mention=character_id]name[/mention]", compileMention, ""},
+		"speech":     {"Character speech: [speech=color]words[/speech]", compileSpeech, ""},
+		"table":      {"Table made of [tr] rows", compileTableElement("table", "bb-table"), ""},
+		"tr":         {"Table row made of [th] and [td] cells", compileTableElement("tr", ""), "table"},
+		"th":         {"Table header cell", compileElement("th", ""), "table"},
+		"td":         {"Table cell", compileElement("td", ""), "table"},
+		"attachment": {"Post attachment placed inline: [attachment]id[/attachment]", compileAttachment, ""},
+	}
+}
+
+// library reuses a tag from the bbcode package; its output is sanitized like any other.
+func library(name string) TagFunc {
+	compile := bbcode.DefaultTagCompilers[name]
+	return func(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+		return compile(node)
+	}
+}
+
+func compileElement(element string, class string) TagFunc {
+	return func(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+		out := bbcode.NewHTMLTag("")
+		out.Name = element
+		if class != "" {
+			out.Attrs["class"] = class
+		}
+		return out, true
+	}
+}
+
+// compileTableElement drops the line breaks between rows and cells, which aren't valid inside tables.
+func compileTableElement(element string, class string) TagFunc {
+	return func(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+		out := bbcode.NewHTMLTag("")
+		out.Name = element
+		if class != "" {
+			out.Attrs["class"] = class
+		}
+		for _, child := range node.Children {
+			if child.ID == bbcode.TEXT && len(child.Children) == 0 && strings.TrimSpace(child.Value.(string)) == "" {
+				continue
+			}
+			out.AppendChild(node.Compiler.CompileTree(child))
+		}
+		return out, false
+	}
+}
+
+// tagReference reads the numeric ID of [tag=id][/tag] or [tag]id[/tag].
+func tagReference(node *bbcode.BBCodeNode) (int, bool) {
+	value := node.GetOpeningTag().Value
+	if value == "" {
+		value = bbcode.CompileText(node)
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(value))
+	return id, err == nil
+}
+
+func compileQuote(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+	in := node.GetOpeningTag()
+	out := bbcode.NewHTMLTag("")
+	out.Name = "blockquote"
+	out.Attrs["class"] = "bb-quote"
+	cite := bbcode.NewHTMLTag("")
+	cite.Name = "cite"
+
+	who := in.Value
+	if name, ok := in.Args["name"]; ok && name != "" {
+		who = name
+	}
+	if id, err := strconv.Atoi(in.Value); err == nil {
+		// A post reference is only trusted if it resolves, otherwise anyone could put words in anyone's mouth
+		who = ""
+		if quoted, ok := ctx.Quotes[id]; ok {
+			who = quoted.AuthorName
+			out.Attrs["data-post-id"] = strconv.Itoa(id)
+			out.Attrs["data-topic-id"] = strconv.Itoa(quoted.TopicId)
+		}
+	}
+	if who != "" {
+		cite.AppendChild(bbcode.NewHTMLTag(who + " said:"))
+	} else {
+		cite.AppendChild(bbcode.NewHTMLTag("Quote"))
+	}
+	return out.AppendChild(cite), true
+}
+
+func compileCollapsed(class string, defaultTitle string) TagFunc {
+	return func(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+		out := bbcode.NewHTMLTag("")
+		out.Name = "details"
+		out.Attrs["class"] = class
+		summary := bbcode.NewHTMLTag("")
+		summary.Name = "summary"
+		title := strings.TrimSpace(node.GetOpeningTag().Value)
+		if title == "" {
+			title = defaultTitle
+		}
+		summary.AppendChild(bbcode.NewHTMLTag(title))
+		out.AppendChild(summary)
+
+		body := bbcode.NewHTMLTag("")
+		body.Name = "div"
+		for _, child := range node.Children {
+			body.AppendChild(node.Compiler.CompileTree(child))
+		}
+		return out.AppendChild(body), false
+	}
+}
+
+func compileDice(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+	id, ok := tagReference(node)
+	roll, found := ctx.Rolls[id]
+	if !ok || !found {
+		return bbcode.CompileRaw(node), false
+	}
+	if ctx.shownRolls == nil {
+		ctx.shownRolls = map[int]bool{}
+	}
+	ctx.shownRolls[id] = true
+	return rollElement(id, roll), false
+}
+
+// hiddenRolls lists the context's rolls that no [dice] tag showed, nil if there are none.
+func hiddenRolls(ctx *Context) *bbcode.HTMLTag {
+	var ids []int
+	for id := range ctx.Rolls {
+		if !ctx.shownRolls[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Ints(ids)
+
+	out := bbcode.NewHTMLTag("")
+	out.Name = "div"
+	out.Attrs["class"] = "bb-dice-rolls"
+	for _, id := range ids {
+		out.AppendChild(rollElement(id, ctx.Rolls[id]))
+	}
+	return out
+}
+
+func rollElement(id int, roll Roll) *bbcode.HTMLTag {
+	results := make([]string, len(roll.Results))
+	for i, result := range roll.Results {
+		results[i] = strconv.Itoa(result)
+	}
+	text := roll.Notation + ": " + strings.Join(results, " + ")
+	if roll.Modifier > 0 {
+		text += fmt.Sprintf(" + %d", roll.Modifier)
+	} else if roll.Modifier < 0 {
+		text += fmt.Sprintf(" - %d", -roll.Modifier)
+	}
+	text += fmt.Sprintf(" = %d", roll.Total)
+
+	out := bbcode.NewHTMLTag("")
+	out.Name = "span"
+	out.Attrs["class"] = "bb-dice"
+	out.Attrs["data-roll-id"] = strconv.Itoa(id)
+	out.AppendChild(bbcode.NewHTMLTag(text))
+	return out
+}
+
+func compileMention(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+	id, err := strconv.Atoi(strings.TrimSpace(node.GetOpeningTag().Value))
+	if err != nil {
+		return bbcode.CompileRaw(node), false
+	}
+	out := bbcode.NewHTMLTag("")
+	out.Name = "a"
+	out.Attrs["class"] = "bb-mention"
+	out.Attrs["href"] = fmt.Sprintf("/character/%d", id)
+	out.Attrs["data-character-id"] = strconv.Itoa(id)
+	return out, true
+}
+
+func compileSpeech(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+	out := bbcode.NewHTMLTag("")
+	out.Name = "span"
+	out.Attrs["class"] = "bb-speech"
+	if color := cleanColor(node.GetOpeningTag().Value); color != "" {
+		out.Attrs["style"] = "color: " + color + ";"
+	}
+	return out, true
+}
+
+func compileAttachment(node *bbcode.BBCodeNode, ctx *Context) (*bbcode.HTMLTag, bool) {
+	id, ok := tagReference(node)
+	attachment, found := ctx.Attachments[id]
+	if !ok || !found {
+		return bbcode.CompileRaw(node), false
+	}
+
+	out := bbcode.NewHTMLTag("")
+	out.Name = "a"
+	out.Attrs["href"] = attachment.Url
+	out.Attrs["class"] = "attachment"
+	if attachment.ThumbnailUrl != nil {
+		img := bbcode.NewHTMLTag("")
+		img.Name = "img"
+		img.Attrs["src"] = *attachment.ThumbnailUrl
+		img.Attrs["alt"] = attachment.FileName
+		out.AppendChild(img)
+	} else {
+		out.Attrs["download"] = attachment.FileName
+		out.AppendChild(bbcode.NewHTMLTag(attachment.FileName))
+	}
+	return out, false
+}
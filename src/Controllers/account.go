@@ -0,0 +1,125 @@
+package Controllers
+
+import (
+	"cuento-backend/config"
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func RequestEmailVerification(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var verified bool
+	if err := db.QueryRow("SELECT email_verified FROM users WHERE id = ?", userID).Scan(&verified); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get user: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if verified {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: "Email is already verified"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.SendEmailVerification(userID, db); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, Services.ErrUserEmailNotFound) {
+			code = http.StatusBadRequest
+		}
+		_ = c.Error(&Middlewares.AppError{Code: code, Message: "Failed to send verification email: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+func VerifyEmail(c *gin.Context, db *sql.DB) {
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if _, err := Services.VerifyEmail(req.Token, db); err != nil {
+		if errors.Is(err, Services.ErrInvalidUserToken) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Verification link is invalid or has expired"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to verify email: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+func ForgotPassword(c *gin.Context, db *sql.DB) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	// The response is the same whether the email exists or not, so it can't be used to probe for accounts
+	if err := Services.SendPasswordReset(req.Email, db); err != nil && !errors.Is(err, Services.ErrUserEmailNotFound) {
+		fmt.Printf("Error sending password reset email: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account with this email exists, a reset link has been sent"})
+}
+
+func ResetPassword(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	var user Entities.User
+	if err := user.HashPassword(req.Password, authConfig.BcryptCost); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to hash password"})
+		c.Abort()
+		return
+	}
+
+	if _, err := Services.ResetPassword(req.Token, user.Password, db); err != nil {
+		if errors.Is(err, Services.ErrInvalidUserToken) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Reset link is invalid or has expired"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to reset password: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
@@ -0,0 +1,241 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"cuento-backend/src/Uploads"
+	"database/sql"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// topicSubforumWithPermission resolves the topic's subforum and aborts unless the user holds the
+// subforum permission there. Attachments have no permissions of their own.
+func topicSubforumWithPermission(c *gin.Context, db *sql.DB, topicID int, userID int, permission string) (int, bool) {
+	subforumID, err := Services.GetTopicSubforum(topicID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Topic not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get topic: " + err.Error()})
+		}
+		c.Abort()
+		return 0, false
+	}
+	allowed, err := Services.HasSubforumPermission(userID, permission, subforumID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check permissions: " + err.Error()})
+		c.Abort()
+		return 0, false
+	}
+	if !allowed {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "You don't have access to this topic"})
+		c.Abort()
+		return 0, false
+	}
+	return subforumID, true
+}
+
+func UploadAttachment(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	topicID, err := strconv.Atoi(c.Param("topic_id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid topic ID"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.RequireVerifiedEmail(userID, db); err != nil {
+		if err == Services.ErrEmailNotVerified {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Please verify your email address before posting"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check email verification: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	subforumID, ok := topicSubforumWithPermission(c, db, topicID, userID, "subforum_post")
+	if !ok {
+		return
+	}
+	limits, err := Services.GetAttachmentLimits(subforumID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get attachment limits: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if limits.MaxCount == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: Services.ErrAttachmentsDisabled.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limits.MaxSize)+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusRequestEntityTooLarge, Message: Uploads.ErrFileTooLarge.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "A file field is required: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	if header.Size > int64(limits.MaxSize) {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusRequestEntityTooLarge, Message: Uploads.ErrFileTooLarge.Error()})
+		c.Abort()
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Failed to read file: " + err.Error()})
+		c.Abort()
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(limits.MaxSize)+1))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Failed to read file: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	attachment, err := Services.SaveAttachment(userID, topicID, limits, header.Filename, data, db)
+	if err != nil {
+		switch {
+		case errors.Is(err, Uploads.ErrFileTooLarge), errors.Is(err, Services.ErrPendingQuotaReached):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusRequestEntityTooLarge, Message: err.Error()})
+		case errors.Is(err, Uploads.ErrUnsupportedAttachment), errors.Is(err, Uploads.ErrUnsupportedType):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusUnsupportedMediaType, Message: err.Error()})
+		case errors.Is(err, Uploads.ErrImageTooLarge), errors.Is(err, Services.ErrTooManyAttachments):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error()})
+		case errors.Is(err, Services.ErrAttachmentsDisabled):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		default:
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to save attachment: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+func GetPendingAttachments(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	topicID, err := strconv.Atoi(c.Param("topic_id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid topic ID"})
+		c.Abort()
+		return
+	}
+
+	attachments, err := Services.GetPendingAttachments(userID, topicID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get attachments: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+func DeleteAttachment(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid attachment ID"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.DeletePendingAttachment(id, userID, db); err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Attachment not found or already posted"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to delete attachment: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
+
+// ServeAttachment sends an attachment file to anyone who can read its topic. Pending attachments
+// are only visible to their uploader.
+func ServeAttachment(c *gin.Context, db *sql.DB, thumbnail bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid attachment ID"})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	attachment, err := Services.GetAttachment(id, db)
+	if err == nil && attachment.PostId == nil && attachment.UserId != userID {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Attachment not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get attachment: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	if _, ok := topicSubforumWithPermission(c, db, attachment.TopicId, userID, "subforum_read"); !ok {
+		return
+	}
+
+	data, err := Services.ReadAttachmentFile(id, thumbnail, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Attachment has no thumbnail"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to read attachment: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	contentType := attachment.MimeType
+	disposition := "inline"
+	if thumbnail {
+		contentType = http.DetectContentType(data)
+	} else if !Uploads.IsImageType(contentType) {
+		disposition = "attachment"
+		if contentType == "text/plain" {
+			contentType += "; charset=utf-8"
+		}
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,48 @@
+package Controllers
+
+import (
+	"cuento-backend/src/BBCode"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBBCodeTags lists the tags editors can offer, including disabled ones so admins can switch them back on.
+func GetBBCodeTags(c *gin.Context) {
+	c.JSON(http.StatusOK, BBCode.Default.Tags())
+}
+
+func GetBBCodeConfig(c *gin.Context, db *sql.DB) {
+	cfg, err := Services.GetBBCodeConfig(db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get BBCode config: " + err.Error()})
+		c.Abort()
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+func UpdateBBCodeConfig(c *gin.Context, db *sql.DB) {
+	var cfg BBCode.Config
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if err := BBCode.Default.Validate(cfg); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid BBCode config: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := Services.UpdateBBCodeConfig(cfg, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to save BBCode config: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, BBCode.Default.Tags())
+}
@@ -5,6 +5,7 @@ import (
 	"cuento-backend/src/Middlewares"
 	"cuento-backend/src/Services"
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -27,7 +28,11 @@ func GetCharacter(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	entity, err := Services.GetEntity(int64(id), "character", db)
+	access, err := Services.GetFieldAccess("character", int64(id), Services.GetUserIdFromContext(c), db)
+	var entity interface{}
+	if err == nil {
+		entity, err = Services.GetEntity(int64(id), "character", access, db)
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Character not found"})
@@ -56,69 +61,48 @@ func CreateCharacter(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	tx, err := db.Begin()
-	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
-		c.Abort()
-		return
+	images := []*string{req.Avatar}
+	for _, faction := range req.FactionIDs {
+		if faction.Id < 0 {
+			images = append(images, faction.Icon)
+		}
 	}
-	defer tx.Rollback()
-
-	// Insert Topic (without first post)
-	res, err := tx.Exec("INSERT INTO topics (subforum_id, name, author_user_id, date_created, date_last_post, status, type, post_number, last_post_author_user_id) VALUES (?, ?, ?, NOW(), NOW(), 0, ?, 0, ?)",
-		req.SubforumID, req.Name, userID, Entities.CharacterSheetTopic, userID)
-	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to insert topic: " + err.Error()})
-		c.Abort()
+	if !checkImageURLs(c, db, images...) {
 		return
 	}
-	topicID, err := res.LastInsertId()
+
+	access, err := Services.GetCreatorFieldAccess("character", userID, db)
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get topic ID"})
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
 		c.Abort()
 		return
 	}
 
-	character := Entities.Character{
-		UserId:  userID,
-		TopicId: int(topicID),
-		Name:    req.Name,
-		Avatar:  req.Avatar,
-		CustomFields: Entities.CustomFieldEntity{
-			CustomFields: req.CustomFields,
-		},
-	}
-
-	createdEntity, characterID, err := Services.CreateEntity("character", &character, tx)
+	tx, err := db.Begin()
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create character: " + err.Error()})
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
 		c.Abort()
 		return
 	}
+	defer tx.Rollback()
 
-	// Handle factions
-	for _, faction := range req.FactionIDs {
-		var factionID int
-
-		// If faction ID is negative, create a new faction
-		if faction.Id < 0 {
-			newFactionID, err := Services.CreateFaction(faction, tx)
-			if err != nil {
-				_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create faction: " + err.Error()})
-				c.Abort()
-				return
-			}
-			factionID = int(newFactionID)
+	createdEntity, _, err := Services.CreateCharacterWithSheet(Services.NewCharacter{
+		UserID:       userID,
+		SubforumID:   req.SubforumID,
+		Name:         req.Name,
+		Avatar:       req.Avatar,
+		CustomFields: req.CustomFields,
+		Factions:     req.FactionIDs,
+		Access:       access,
+	}, tx)
+	if err != nil {
+		if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
 		} else {
-			factionID = faction.Id
-		}
-
-		// Add faction to character
-		if err := Services.AddFactionCharacter(factionID, int(characterID), tx); err != nil {
-			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to add faction to character: " + err.Error()})
-			c.Abort()
-			return
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create character: " + err.Error()})
 		}
+		c.Abort()
+		return
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -126,6 +110,7 @@ func CreateCharacter(c *gin.Context, db *sql.DB) {
 		c.Abort()
 		return
 	}
+	discardPublishedDraft(userID, Entities.DraftCharacter, 0, db)
 
 	c.JSON(http.StatusCreated, createdEntity)
 }
@@ -145,14 +130,35 @@ func PatchCharacter(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	updatedEntity, err := Services.PatchEntity(int64(id), "character", jsonMap, db)
+	access, ok := authorizeEntityPatch(c, db, "character", id, jsonMap, "Character not found")
+	if !ok {
+		return
+	}
+
+	patchEntity(c, db, "character", id, jsonMap, access)
+}
+
+func PatchCharacterProfile(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to patch character: " + err.Error()})
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	var jsonMap map[string]interface{}
+	if err := c.ShouldBindJSON(&jsonMap); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
 		c.Abort()
 		return
 	}
 
-	c.JSON(http.StatusOK, updatedEntity)
+	access, ok := authorizeEntityPatch(c, db, "character_profile", id, jsonMap, "Character profile not found")
+	if !ok {
+		return
+	}
+
+	patchEntity(c, db, "character_profile", id, jsonMap, access)
 }
 
 func GetCharacterList(c *gin.Context, db *sql.DB) {
@@ -287,6 +293,15 @@ func GetCharacterProfilesByUser(c *gin.Context, db *sql.DB) {
 	}
 	defer rows.Close()
 
+	staff, err := Services.IsStaff(userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+		c.Abort()
+		return
+	}
+	// All of these profiles belong to the current user
+	access := &Services.FieldAccess{ViewerID: userID, IsOwner: true, IsStaff: staff}
+
 	var profiles []Entities.CharacterProfile
 	for rows.Next() {
 		var id int
@@ -297,7 +312,7 @@ func GetCharacterProfilesByUser(c *gin.Context, db *sql.DB) {
 			continue
 		}
 
-		entity, err := Services.GetEntity(int64(id), "character_profile", db)
+		entity, err := Services.GetEntity(int64(id), "character_profile", access, db)
 		if err != nil {
 			continue
 		}
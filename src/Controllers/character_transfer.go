@@ -0,0 +1,233 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CharacterTransferRequest struct {
+	CharacterID int `json:"character_id" binding:"required"`
+	ToUserID    int `json:"to_user_id" binding:"required"`
+}
+
+func OfferCharacterTransfer(c *gin.Context, db *sql.DB) {
+	createCharacterTransfer(c, db, false)
+}
+
+func ReassignCharacter(c *gin.Context, db *sql.DB) {
+	createCharacterTransfer(c, db, true)
+}
+
+func createCharacterTransfer(c *gin.Context, db *sql.DB, isReassignment bool) {
+	var req CharacterTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	ownerID, err := Services.GetCharacterOwner(req.CharacterID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Character not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get character owner: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	// Offering is reserved for the owner, reassigning is gated by the endpoint permission
+	if !isReassignment && ownerID != userID {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Only the owner can offer a character for transfer"})
+		c.Abort()
+		return
+	}
+
+	if req.ToUserID == ownerID {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Character already belongs to this user"})
+		c.Abort()
+		return
+	}
+
+	var recipientExists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", req.ToUserID).Scan(&recipientExists); err != nil || recipientExists == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Recipient not found"})
+		c.Abort()
+		return
+	}
+
+	transfer, err := Services.CreateCharacterTransfer(req.CharacterID, req.ToUserID, userID, isReassignment, db)
+	if err != nil {
+		if err == Services.ErrTransferAlreadyPending {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: "Character already has a pending transfer"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create transfer: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+		UserID:  transfer.ToUserId,
+		Type:    "character_transfer_offer",
+		Message: fmt.Sprintf("%s offered you the character %s", transfer.InitiatedByUsername, transfer.CharacterName),
+		Data: gin.H{
+			"transfer_id":  transfer.Id,
+			"character_id": transfer.CharacterId,
+		},
+	})
+
+	c.JSON(http.StatusCreated, transfer)
+}
+
+func AcceptCharacterTransfer(c *gin.Context, db *sql.DB) {
+	resolveCharacterTransfer(c, db, Entities.AcceptedTransfer)
+}
+
+func DeclineCharacterTransfer(c *gin.Context, db *sql.DB) {
+	resolveCharacterTransfer(c, db, Entities.DeclinedTransfer)
+}
+
+func CancelCharacterTransfer(c *gin.Context, db *sql.DB) {
+	resolveCharacterTransfer(c, db, Entities.CancelledTransfer)
+}
+
+func resolveCharacterTransfer(c *gin.Context, db *sql.DB, status Entities.CharacterTransferStatus) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	transfer, err := Services.GetCharacterTransfer(id, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Transfer not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get transfer: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	// The recipient accepts or declines, the initiator or the current owner may cancel
+	allowed := false
+	switch status {
+	case Entities.AcceptedTransfer, Entities.DeclinedTransfer:
+		allowed = transfer.ToUserId == userID
+	case Entities.CancelledTransfer:
+		allowed = transfer.InitiatedByUserId == userID || (transfer.FromUserId != nil && *transfer.FromUserId == userID)
+	}
+	if !allowed {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "You cannot change this transfer"})
+		c.Abort()
+		return
+	}
+
+	transfer, err = Services.ResolveCharacterTransfer(id, status, db)
+	if err != nil {
+		if err == Services.ErrTransferNotPending {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: "Transfer is no longer pending"})
+		} else if err == Services.ErrTransferOwnerChanged {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: "The character changed owner since this transfer was offered, it can only be declined or cancelled"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update transfer: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	var message string
+	switch status {
+	case Entities.AcceptedTransfer:
+		message = fmt.Sprintf("%s accepted the character %s", transfer.ToUsername, transfer.CharacterName)
+	case Entities.DeclinedTransfer:
+		message = fmt.Sprintf("%s declined the character %s", transfer.ToUsername, transfer.CharacterName)
+	case Entities.CancelledTransfer:
+		message = fmt.Sprintf("The transfer of the character %s was cancelled", transfer.CharacterName)
+	}
+
+	notified := map[int]bool{userID: true}
+	recipients := []int{transfer.InitiatedByUserId, transfer.ToUserId}
+	if transfer.FromUserId != nil {
+		recipients = append(recipients, *transfer.FromUserId)
+	}
+	for _, recipient := range recipients {
+		if notified[recipient] {
+			continue
+		}
+		notified[recipient] = true
+		Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+			UserID:  recipient,
+			Type:    "character_transfer_update",
+			Message: message,
+			Data: gin.H{
+				"transfer_id":  transfer.Id,
+				"character_id": transfer.CharacterId,
+				"status":       transfer.Status,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+func GetCharacterTransferHistory(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	transfers, err := Services.GetCharacterTransferHistory(id, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get transfer history: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+func GetUserCharacterTransfers(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	transfers, err := Services.GetPendingTransfersForUser(userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get transfers: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
@@ -0,0 +1,340 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateConversationRequest struct {
+	Title              string `json:"title" binding:"required"`
+	ParticipantIDs     []int  `json:"participant_ids" binding:"required"`
+	Content            string `json:"content" binding:"required"`
+	CharacterProfileID *int   `json:"character_profile_id"`
+}
+
+type SendMessageRequest struct {
+	Content            string `json:"content" binding:"required"`
+	CharacterProfileID *int   `json:"character_profile_id"`
+}
+
+type AddParticipantsRequest struct {
+	ParticipantIDs []int `json:"participant_ids" binding:"required"`
+}
+
+type MuteConversationRequest struct {
+	Muted bool `json:"muted"`
+}
+
+// checkSendAs makes sure the user may write as the given character profile.
+func checkSendAs(c *gin.Context, db *sql.DB, userID int, characterProfileID *int) bool {
+	if characterProfileID == nil {
+		return true
+	}
+	ownerID, err := Services.GetCharacterProfileOwner(*characterProfileID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Character profile not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check character owner: " + err.Error()})
+		}
+		c.Abort()
+		return false
+	}
+	if ownerID != userID {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "You do not own this character"})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// requireParticipant resolves the conversation ID from the path and checks the current user takes part in it.
+func requireParticipant(c *gin.Context, db *sql.DB) (int, int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return 0, 0, false
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return 0, 0, false
+	}
+
+	if err := Services.RequireConversationParticipant(id, userID, db); err != nil {
+		if err == Services.ErrNotParticipant {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Conversation not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get conversation: " + err.Error()})
+		}
+		c.Abort()
+		return 0, 0, false
+	}
+	return id, userID, true
+}
+
+// publishMessage pushes a new message to every participant who hasn't left or muted the conversation.
+func publishMessage(db *sql.DB, message *Entities.PrivateMessage) {
+	receivers, err := Services.GetConversationReceivers(message.ConversationId, message.AuthorUserId, false, db)
+	if err != nil || len(receivers) == 0 {
+		return
+	}
+	Events.Publish(db, Events.MessageCreated, Events.MessageCreatedEvent{
+		Type:      "private_message",
+		Message:   *message,
+		Receivers: receivers,
+	})
+}
+
+func CreateConversation(c *gin.Context, db *sql.DB) {
+	var req CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	var participants []int
+	seen := map[int]bool{userID: true}
+	for _, id := range req.ParticipantIDs {
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	if req.Title == "" || len(participants) == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "A conversation needs a title and at least one other participant"})
+		c.Abort()
+		return
+	}
+
+	if !checkSendAs(c, db, userID, req.CharacterProfileID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
+		c.Abort()
+		return
+	}
+	defer tx.Rollback()
+
+	conversationID, err := Services.CreateConversation(userID, req.Title, participants, tx)
+	if err != nil {
+		if errors.Is(err, Services.ErrUnknownParticipant) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create conversation: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	message, err := Services.CreatePrivateMessage(conversationID, userID, req.Content, req.CharacterProfileID, tx)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create message: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to commit transaction"})
+		c.Abort()
+		return
+	}
+
+	publishMessage(db, message)
+
+	conversation, err := Services.GetConversation(conversationID, userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get conversation: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusCreated, conversation)
+}
+
+func GetConversations(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Param("page"))
+	conversations, err := Services.GetUserConversations(userID, page, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get conversations: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, conversations)
+}
+
+func GetConversationMessages(c *gin.Context, db *sql.DB) {
+	conversationID, userID, ok := requireParticipant(c, db)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.Param("page"))
+	messages, err := Services.GetConversationMessages(conversationID, page, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get messages: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	// Opening a page counts as reading everything on it; tell the others so they can show read receipts
+	if len(messages) > 0 {
+		lastID := messages[len(messages)-1].Id
+		moved, err := Services.MarkConversationRead(conversationID, userID, lastID, db)
+		if err == nil && moved {
+			receivers, err := Services.GetConversationReceivers(conversationID, userID, true, db)
+			if err == nil && len(receivers) > 0 {
+				Events.Publish(db, Events.ConversationRead, Events.ConversationReadEvent{
+					Type:              "conversation_read",
+					ConversationID:    conversationID,
+					UserID:            userID,
+					LastReadMessageID: lastID,
+					Receivers:         receivers,
+				})
+			}
+		}
+	}
+
+	conversation, err := Services.GetConversation(conversationID, userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get conversation: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversation": conversation,
+		"messages":     messages,
+	})
+}
+
+func SendMessage(c *gin.Context, db *sql.DB) {
+	conversationID, userID, ok := requireParticipant(c, db)
+	if !ok {
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if !checkSendAs(c, db, userID, req.CharacterProfileID) {
+		return
+	}
+
+	message, err := Services.CreatePrivateMessage(conversationID, userID, req.Content, req.CharacterProfileID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to send message: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	publishMessage(db, message)
+
+	c.JSON(http.StatusCreated, message)
+}
+
+func AddConversationParticipants(c *gin.Context, db *sql.DB) {
+	conversationID, _, ok := requireParticipant(c, db)
+	if !ok {
+		return
+	}
+
+	var req AddParticipantsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := Services.AddConversationParticipants(conversationID, req.ParticipantIDs, db); err != nil {
+		if errors.Is(err, Services.ErrUnknownParticipant) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to add participants: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	participants, err := Services.GetConversationParticipants(conversationID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get participants: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, participants)
+}
+
+func LeaveConversation(c *gin.Context, db *sql.DB) {
+	conversationID, userID, ok := requireParticipant(c, db)
+	if !ok {
+		return
+	}
+
+	if err := Services.LeaveConversation(conversationID, userID, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to leave conversation: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left conversation"})
+}
+
+func MuteConversation(c *gin.Context, db *sql.DB) {
+	conversationID, userID, ok := requireParticipant(c, db)
+	if !ok {
+		return
+	}
+
+	var req MuteConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := Services.SetConversationMuted(conversationID, userID, req.Muted, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update conversation: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"muted": req.Muted})
+}
@@ -0,0 +1,233 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/RateLimit"
+	"cuento-backend/src/Services"
+	"cuento-backend/src/Websockets"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SaveDraftRequest struct {
+	Content string          `json:"content"`
+	Data    json.RawMessage `json:"data"`
+	// Revision the client last saved or loaded, 0 if it has none
+	BaseRevision int `json:"base_revision"`
+	// Lets the saving tab recognise its own draft_saved message
+	TabId string `json:"tab_id"`
+}
+
+// draftMessage is a draft_save or draft_delete message sent over the WebSocket.
+type draftMessage struct {
+	SaveDraftRequest
+	TargetType string `json:"target_type"`
+	TargetId   int    `json:"target_id"`
+}
+
+// draftErrorCode maps draft errors to HTTP status codes.
+func draftErrorCode(err error) int {
+	switch {
+	case errors.Is(err, Services.ErrInvalidDraftTarget), errors.Is(err, Services.ErrInvalidDraftData):
+		return http.StatusBadRequest
+	case errors.Is(err, Services.ErrDraftForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, Services.ErrDraftTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// saveDraft is shared by the REST endpoint and the WebSocket. Other tabs hear about the new
+// revision through the DraftChanged event.
+func saveDraft(userID int, targetType string, targetID int, req SaveDraftRequest, db *sql.DB) (*Entities.Draft, error) {
+	if err := Services.CheckDraftTarget(userID, targetType, targetID, db); err != nil {
+		return nil, err
+	}
+	draft, err := Services.SaveDraft(userID, targetType, targetID, req.Content, req.Data, req.BaseRevision, db)
+	if err != nil {
+		return draft, err
+	}
+	Services.PublishDraftSaved(db, req.TabId, draft)
+	return draft, nil
+}
+
+// discardPublishedDraft empties the draft of something that was just published. Failing to is
+// only logged, the draft expires eventually.
+func discardPublishedDraft(userID int, targetType string, targetID int, db *sql.DB) {
+	if err := Services.MarkDraftPublished(userID, targetType, targetID, db); err != nil {
+		fmt.Printf("Error discarding published draft: %v\n", err)
+	}
+}
+
+// draftTarget reads the :type and :id route parameters.
+func draftTarget(c *gin.Context) (string, int, bool) {
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid target ID"})
+		c.Abort()
+		return "", 0, false
+	}
+	return c.Param("type"), targetID, true
+}
+
+func GetDrafts(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	drafts, err := Services.GetDrafts(userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get drafts: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, drafts)
+}
+
+// GetDraft restores a draft when its form is opened.
+func GetDraft(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	targetType, targetID, ok := draftTarget(c)
+	if !ok {
+		return
+	}
+
+	draft, err := Services.GetDraft(userID, targetType, targetID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "No draft"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get draft: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+func SaveDraft(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	targetType, targetID, ok := draftTarget(c)
+	if !ok {
+		return
+	}
+	var req SaveDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	draft, err := saveDraft(userID, targetType, targetID, req, db)
+	if err != nil {
+		if errors.Is(err, Services.ErrDraftConflict) {
+			// The client needs the stored draft (null if it was posted meanwhile) to resolve the conflict
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "draft": draft})
+			return
+		}
+		_ = c.Error(&Middlewares.AppError{Code: draftErrorCode(err), Message: "Failed to save draft: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+func DeleteDraft(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	targetType, targetID, ok := draftTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := Services.DiscardDraft(userID, targetType, targetID, c.Query("tab_id"), db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to delete draft: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft deleted"})
+}
+
+// handleDraftMessage answers draft_save and draft_delete messages from the WebSocket read loop.
+// Conflicts and errors go back to the sending tab only; successful changes reach every tab.
+// Saves beyond draftLimit are refused with draft_error and retry_after in seconds.
+func handleDraftMessage(client *Websockets.Client, msgType string, raw []byte, db *sql.DB, limiter *RateLimit.Limiter, draftLimit RateLimit.Rule) {
+	var msg draftMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return
+	}
+
+	if msgType == "draft_save" {
+		if allowed, retryAfter := limiter.AllowAccount(draftLimit, client.UserID); !allowed {
+			client.Reply(gin.H{
+				"type":        "draft_error",
+				"tab_id":      msg.TabId,
+				"target_type": msg.TargetType,
+				"target_id":   msg.TargetId,
+				"error":       "Too many draft saves, please try again later",
+				"retry_after": int(math.Ceil(retryAfter.Seconds())),
+			})
+			return
+		}
+	}
+
+	var err error
+	if msgType == "draft_delete" {
+		err = Services.DiscardDraft(client.UserID, msg.TargetType, msg.TargetId, msg.TabId, db)
+	} else {
+		var draft *Entities.Draft
+		draft, err = saveDraft(client.UserID, msg.TargetType, msg.TargetId, msg.SaveDraftRequest, db)
+		if errors.Is(err, Services.ErrDraftConflict) {
+			client.Reply(gin.H{
+				"type":        "draft_conflict",
+				"tab_id":      msg.TabId,
+				"target_type": msg.TargetType,
+				"target_id":   msg.TargetId,
+				"draft":       draft,
+			})
+			return
+		}
+	}
+	if err != nil {
+		if draftErrorCode(err) == http.StatusInternalServerError {
+			fmt.Printf("Error handling %s: %v\n", msgType, err)
+		}
+		client.Reply(gin.H{
+			"type":        "draft_error",
+			"tab_id":      msg.TabId,
+			"target_type": msg.TargetType,
+			"target_id":   msg.TargetId,
+			"error":       err.Error(),
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateEmailPreferencesRequest struct {
+	Mode Entities.EmailMode `json:"mode" binding:"required"`
+}
+
+func GetEmailPreferences(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	prefs, err := Services.GetEmailPreferences(userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get email preferences: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+func UpdateEmailPreferences(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req UpdateEmailPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if !req.Mode.IsValid() {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Mode must be one of: instant, daily, off"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.SetEmailMode(userID, req.Mode, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update email preferences: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	prefs, err := Services.GetEmailPreferences(userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get email preferences: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
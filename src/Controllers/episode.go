@@ -5,7 +5,9 @@ import (
 	"cuento-backend/src/Middlewares"
 	"cuento-backend/src/Services"
 	"database/sql"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -50,6 +52,23 @@ func CreateEpisode(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if err := Services.RequireVerifiedEmail(userID, db); err != nil {
+		if err == Services.ErrEmailNotVerified {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Please verify your email address before posting"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check email verification: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	access, err := Services.GetCreatorFieldAccess("episode", userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+		c.Abort()
+		return
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
@@ -83,9 +102,13 @@ func CreateEpisode(c *gin.Context, db *sql.DB) {
 		},
 	}
 
-	createdEntity, _, err := Services.CreateEntity("episode", &episode, tx)
+	createdEntity, _, err := Services.CreateEntity("episode", &episode, access, tx)
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create episode entity: " + err.Error()})
+		if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create episode entity: " + err.Error()})
+		}
 		c.Abort()
 		return
 	}
@@ -117,15 +140,51 @@ func CreateEpisode(c *gin.Context, db *sql.DB) {
 		}
 	}
 
+	// 4. Subscribe the creator and the players of the episode characters
+	if err := Services.Subscribe(userID, Entities.TopicSubscription, int(topicID), tx); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to subscribe to episode: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if err := Services.SubscribeEpisodeParticipants(topicID, req.CharacterIDs, tx); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to subscribe episode participants: " + err.Error()})
+		c.Abort()
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to commit transaction"})
 		c.Abort()
 		return
 	}
+	discardPublishedDraft(userID, Entities.DraftEpisode, req.SubforumID, db)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Episode created successfully", "episode_id": createdEpisode.Id, "topic_id": topicID})
 }
 
+func PatchEpisode(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	var jsonMap map[string]interface{}
+	if err := c.ShouldBindJSON(&jsonMap); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	access, ok := authorizeEntityPatch(c, db, "episode", id, jsonMap, "Episode not found")
+	if !ok {
+		return
+	}
+
+	patchEntity(c, db, "episode", id, jsonMap, access)
+}
+
 func GetEpisodes(c *gin.Context, db *sql.DB) {
 	var req GetEpisodesRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
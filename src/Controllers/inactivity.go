@@ -0,0 +1,35 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetInactivityReport(c *gin.Context, db *sql.DB) {
+	report, err := Services.BuildInactivityReport(db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to build inactivity report: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func GetStatusChangeLog(c *gin.Context, db *sql.DB) {
+	page, _ := strconv.Atoi(c.Param("page"))
+
+	entries, err := Services.GetStatusChangeLog(page, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get status change log: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
@@ -29,10 +29,18 @@ func GetPermissionMatrix(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	moderationMatrix, err := Services.GetModerationPermissionMatrix(db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get moderation permissions: " + err.Error()})
+		c.Abort()
+		return
+	}
+
 	// Use the numeric PermissionType as the key
 	response := map[Services.PermissionType]interface{}{
-		Services.EndpointPermission: endpointMatrix,
-		Services.SubforumPermission: subforumMatrix,
+		Services.EndpointPermission:   endpointMatrix,
+		Services.SubforumPermission:   subforumMatrix,
+		Services.ModerationPermission: moderationMatrix,
 	}
 
 	c.JSON(http.StatusOK, response)
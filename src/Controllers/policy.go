@@ -0,0 +1,57 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeEntityPatch loads the current user's access to an entity and applies the ownership
+// policy to the update. On failure it aborts with 404, or 403 naming the rule that refused it.
+func authorizeEntityPatch(c *gin.Context, db *sql.DB, className string, id int, updates map[string]interface{}, notFound string) (*Services.FieldAccess, bool) {
+	access, err := Services.GetFieldAccess(className, int64(id), Services.GetUserIdFromContext(c), db)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: notFound})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check access: " + err.Error()})
+		}
+		c.Abort()
+		return nil, false
+	}
+
+	if err := Services.AuthorizeEntityPatch(className, updates, access); err != nil {
+		var violation *Services.PolicyViolation
+		if errors.As(err, &violation) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: violation.Rule})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check access: " + err.Error()})
+		}
+		c.Abort()
+		return nil, false
+	}
+	if avatar, ok := updates["avatar"].(string); ok && !checkImageURLs(c, db, &avatar) {
+		return nil, false
+	}
+	return access, true
+}
+
+// patchEntity runs an authorized patch and writes the updated entity.
+func patchEntity(c *gin.Context, db *sql.DB, className string, id int, updates map[string]interface{}, access *Services.FieldAccess) {
+	updatedEntity, err := Services.PatchEntity(int64(id), className, updates, access, db)
+	if err != nil {
+		if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to patch " + className + ": " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, updatedEntity)
+}
@@ -157,7 +157,18 @@ func GetHomeCategories(c *gin.Context, db *sql.DB) {
 		}
 	}
 
-	// 4. Filter and Group Results
+	// 4. Determine which subforums have unread topics
+	unreadSubforums := map[int]bool{}
+	if userID > 0 {
+		unreadSubforums, err = Services.GetUnreadSubforums(userID, db)
+		if err != nil {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get unread subforums: " + err.Error()})
+			c.Abort()
+			return
+		}
+	}
+
+	// 5. Filter and Group Results
 	categories := []Entities.Category{}
 
 	for _, r := range allRows {
@@ -170,6 +181,7 @@ func GetHomeCategories(c *gin.Context, db *sql.DB) {
 				categories = append(categories, cat)
 			}
 			// Append subforum to the current (last added) category
+			r.Subforum.Unread = unreadSubforums[r.Subforum.Id]
 			categories[len(categories)-1].Subforums = append(categories[len(categories)-1].Subforums, r.Subforum)
 		}
 	}
@@ -308,5 +320,54 @@ func GetSubforum(c *gin.Context, db *sql.DB) {
 		}
 	}
 
+	limits, err := Services.GetAttachmentLimits(id, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get attachment limits: " + err.Error()})
+		c.Abort()
+		return
+	}
+	subforum.AttachmentLimits = &limits
+
 	c.JSON(http.StatusOK, subforum)
 }
+
+func MarkSubforumRead(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid ID"})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.MarkSubforumRead(userID, id, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to mark subforum as read: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subforum marked as read"})
+}
+
+func MarkBoardRead(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.MarkBoardRead(userID, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to mark board as read: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Board marked as read"})
+}
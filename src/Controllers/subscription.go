@@ -0,0 +1,109 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Subscribe(c *gin.Context, db *sql.DB) {
+	targetType, targetID, userID, ok := parseSubscriptionParams(c)
+	if !ok {
+		return
+	}
+
+	if targetType == Entities.TopicSubscription {
+		if _, ok := topicSubforumWithPermission(c, db, targetID, userID, "subforum_read"); !ok {
+			return
+		}
+	} else {
+		var exists int
+		if err := db.QueryRow("SELECT COUNT(*) FROM subforums WHERE id = ?", targetID).Scan(&exists); err != nil || exists == 0 {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Subscription target not found"})
+			c.Abort()
+			return
+		}
+		allowed, err := Services.HasSubforumPermission(userID, "subforum_read", targetID, db)
+		if err != nil {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check permissions: " + err.Error()})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "You don't have access to this subforum"})
+			c.Abort()
+			return
+		}
+	}
+
+	if err := Services.Subscribe(userID, targetType, targetID, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to subscribe: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Subscribed successfully"})
+}
+
+func Unsubscribe(c *gin.Context, db *sql.DB) {
+	targetType, targetID, userID, ok := parseSubscriptionParams(c)
+	if !ok {
+		return
+	}
+
+	if err := Services.Unsubscribe(userID, targetType, targetID, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to unsubscribe: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unsubscribed successfully"})
+}
+
+func GetUserSubscriptions(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	subscriptions, err := Services.GetUserSubscriptions(userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get subscriptions: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+func parseSubscriptionParams(c *gin.Context) (Entities.SubscriptionTarget, int, int, bool) {
+	targetType := c.Param("type")
+	if !Services.IsValidSubscriptionTarget(targetType) {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid subscription type"})
+		c.Abort()
+		return "", 0, 0, false
+	}
+
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return "", 0, 0, false
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return "", 0, 0, false
+	}
+
+	return Entities.SubscriptionTarget(targetType), targetID, userID, true
+}
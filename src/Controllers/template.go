@@ -43,6 +43,26 @@ func UpdateTemplate(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	var customConfig []Entities.CustomFieldConfig
+	err = json.Unmarshal(jsonData, &customConfig)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid config JSON: " + err.Error()})
+		c.Abort()
+		return
+	}
+	for _, field := range customConfig {
+		if !field.Visibility.IsValid() {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid visibility for field " + field.MachineFieldName + ": use public, members, owner or staff"})
+			c.Abort()
+			return
+		}
+		if !field.EditableBy.IsValid() {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid editable_by for field " + field.MachineFieldName + ": use owner or staff"})
+			c.Abort()
+			return
+		}
+	}
+
 	// First, try to insert the config. If it already exists, update it.
 	// This handles the case where the config might not exist yet.
 	_, err = db.Exec("INSERT INTO custom_field_config (entity_type, config) VALUES (?, ?) ON DUPLICATE KEY UPDATE config = ?", entityType, string(jsonData), string(jsonData))
@@ -60,13 +80,6 @@ func UpdateTemplate(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	var customConfig []Entities.CustomFieldConfig
-	err = json.Unmarshal(jsonData, &customConfig)
-	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid config JSON: " + err.Error()})
-		c.Abort()
-		return
-	}
 	customFieldEntity := Entities.CustomFieldEntity{FieldConfig: customConfig}
 
 	if tableExists == 0 {
@@ -7,6 +7,7 @@ import (
 	"cuento-backend/src/Services"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -28,12 +29,17 @@ type ViewforumRow struct {
 	AuthorUsername         string               `json:"author_username"`
 	LastPostAuthorUserId   int                  `json:"last_post_author_user_id"`
 	LastPostAuthorUsername string               `json:"las_post_author_username"`
+	Unread                 bool                 `json:"unread"`
+	FirstUnreadPostId      *int                 `json:"first_unread_post_id"`
+	FirstUnreadPage        *int                 `json:"first_unread_page"`
 }
 
 type CreateTopicRequest struct {
 	SubforumId int    `json:"subforum_id" binding:"required"`
 	Title      string `json:"title" binding:"required"`
 	Content    string `json:"content" binding:"required"`
+	// Posts to quote in the opening post, expanded like in CreatePostRequest
+	QuotedPostIDs []int `json:"quoted_post_ids"`
 }
 
 type CreatePostRequest struct {
@@ -41,8 +47,19 @@ type CreatePostRequest struct {
 	Content             string `json:"content" binding:"required"`
 	UseCharacterProfile bool   `json:"use_character_profile"`
 	CharacterProfileID  *int   `json:"character_profile_id"`
+	// Pending attachments uploaded for this topic, placed inline with [attachment]id[/attachment]
+	AttachmentIDs []int `json:"attachment_ids"`
+	// Posts to quote; each is added as a [quote=post_id] block unless the content already has one
+	QuotedPostIDs []int `json:"quoted_post_ids"`
 }
 
+type UpdatePostRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// Number of posts shown on one topic page
+const postsPerPage = 15
+
 type PostRow struct {
 	Id             int       `json:"id"`
 	AuthorUserId   int       `json:"author_user_id"`
@@ -70,9 +87,19 @@ func GetTopicsBySubforum(c *gin.Context, db *sql.DB) {
 
 	var topics []ViewforumRow
 
+	userID := Services.GetUserIdFromContext(c)
+	var baseline time.Time
+	if userID > 0 {
+		baseline, err = Services.GetUnreadBaseline(userID, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get read markers"})
+			return
+		}
+	}
+
 	limit := 30
-	rows, err := db.Query("SELECT topics.id, status, name, type, date_last_post, post_number, author_user_id, u.username as author_username, last_post_author_user_id, u2.username as las_post_author_username FROM topics JOIN cuento.users u on topics.author_user_id = u.id JOIN cuento.users u2 on topics.last_post_author_user_id = u2.id WHERE subforum_id = ? LIMIT ? OFFSET ?",
-		subforum, limit, page*limit)
+	rows, err := db.Query("SELECT topics.id, status, name, type, date_last_post, post_number, author_user_id, u.username as author_username, last_post_author_user_id, u2.username as las_post_author_username, topics.last_post_id, trm.last_read_post_id, srm.date_read FROM topics JOIN cuento.users u on topics.author_user_id = u.id JOIN cuento.users u2 on topics.last_post_author_user_id = u2.id LEFT JOIN topic_read_markers trm ON trm.topic_id = topics.id AND trm.user_id = ? LEFT JOIN subforum_read_markers srm ON srm.subforum_id = topics.subforum_id AND srm.user_id = ? WHERE topics.subforum_id = ? LIMIT ? OFFSET ?",
+		userID, userID, subforum, limit, page*limit)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get topics"})
@@ -81,14 +108,57 @@ func GetTopicsBySubforum(c *gin.Context, db *sql.DB) {
 
 	defer rows.Close()
 
+	type readState struct {
+		lastPostID     sql.NullInt64
+		lastReadPostID sql.NullInt64
+		subforumRead   sql.NullTime
+	}
+	var states []readState
+
 	for rows.Next() {
 		var topic ViewforumRow
-		err := rows.Scan(&topic.Id, &topic.Status, &topic.Name, &topic.Type, &topic.DateLastPost, &topic.PostNumber, &topic.AuthorUserId, &topic.AuthorUsername, &topic.LastPostAuthorUserId, &topic.LastPostAuthorUsername)
+		var state readState
+		err := rows.Scan(&topic.Id, &topic.Status, &topic.Name, &topic.Type, &topic.DateLastPost, &topic.PostNumber, &topic.AuthorUserId, &topic.AuthorUsername, &topic.LastPostAuthorUserId, &topic.LastPostAuthorUsername, &state.lastPostID, &state.lastReadPostID, &state.subforumRead)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan topics: " + err.Error()})
 			return
 		}
 		topics = append(topics, topic)
+		states = append(states, state)
+	}
+	rows.Close()
+
+	// Unread flags and first unread post links, guests see everything as read
+	if userID > 0 {
+		var cutoffs []Services.UnreadCutoff
+		for i := range topics {
+			state := states[i]
+			since := baseline
+			if state.subforumRead.Valid && state.subforumRead.Time.After(since) {
+				since = state.subforumRead.Time
+			}
+			if topics[i].DateLastPost == nil || !topics[i].DateLastPost.After(since) {
+				continue
+			}
+			if !state.lastPostID.Valid || state.lastPostID.Int64 <= state.lastReadPostID.Int64 {
+				continue
+			}
+
+			topics[i].Unread = true
+			cutoffs = append(cutoffs, Services.UnreadCutoff{TopicID: topics[i].Id, LastReadPostID: int(state.lastReadPostID.Int64), Since: since})
+		}
+
+		firstUnread, err := Services.GetFirstUnreadPosts(cutoffs, postsPerPage, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get first unread posts: " + err.Error()})
+			return
+		}
+		for i := range topics {
+			if first, ok := firstUnread[topics[i].Id]; ok {
+				topics[i].FirstUnreadPostId = &first.PostID
+				topics[i].FirstUnreadPage = &first.Page
+			}
+		}
 	}
 
 	c.JSON(http.StatusOK, topics)
@@ -107,8 +177,31 @@ func CreateTopic(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if err := Services.RequireVerifiedEmail(userID, db); err != nil {
+		if err == Services.ErrEmailNotVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before posting"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification: " + err.Error()})
+		}
+		return
+	}
+
+	content, err := Services.ExpandQuotes(req.Content, req.QuotedPostIDs, userID, db)
+	if err != nil {
+		if errors.Is(err, Services.ErrQuotedPostNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote posts: " + err.Error()})
+		}
+		return
+	}
+	if err := Services.ValidateRolls(content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var username string
-	err := db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	err = db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user details: " + err.Error()})
 		return
@@ -140,7 +233,7 @@ func CreateTopic(c *gin.Context, db *sql.DB) {
 
 	// Insert Post
 	res, err = tx.Exec("INSERT INTO posts (topic_id, author_user_id, content, date_created) VALUES (?, ?, ?, NOW())",
-		topicID, userID, req.Content)
+		topicID, userID, content)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert post: " + err.Error()})
 		return
@@ -150,21 +243,38 @@ func CreateTopic(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get post ID"})
 		return
 	}
+	// Set here rather than by the TopicCreated handler so the new topic shows as unread right away
+	if _, err := tx.Exec("UPDATE topics SET last_post_id = ? WHERE id = ?", postID, topicID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update topic: " + err.Error()})
+		return
+	}
+
+	if err := Services.RollDice(postID, content, tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	quotedPostIDs, err := Services.SaveQuoteReferences(postID, userID, content, tx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quotes: " + err.Error()})
+		return
+	}
 
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
+	discardPublishedDraft(userID, Entities.DraftTopic, req.SubforumId, db)
 
 	// Publish event to update stats asynchronously
 	Events.Publish(db, Events.TopicCreated, Events.TopicCreatedEvent{
-		Type:       "topic_created",
-		TopicID:    topicID,
-		SubforumID: req.SubforumId,
-		Title:      req.Title,
-		PostID:     postID,
-		UserID:     userID,
-		Username:   username,
+		Type:          "topic_created",
+		TopicID:       topicID,
+		SubforumID:    req.SubforumId,
+		Title:         req.Title,
+		PostID:        postID,
+		UserID:        userID,
+		Username:      username,
+		QuotedPostIDs: quotedPostIDs,
 	})
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Topic created successfully", "topic_id": topicID})
@@ -186,7 +296,7 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 		page = 1
 	}
 
-	limit := 15
+	limit := postsPerPage
 	offset := (page - 1) * limit
 
 	// 1. Get custom field columns from the config table
@@ -213,9 +323,10 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 	// 2. Construct the main query
 	query := fmt.Sprintf(`
 		SELECT
-			p.id, p.author_user_id, p.date_created, p.content, p.use_character_profile,
+			p.id, p.author_user_id, p.date_created, p.content, p.content_html, p.content_html_version, p.content_html_quotes, p.use_character_profile,
 			u.username, u.avatar,
 			cp.id as character_profile_id, cp.character_id, cb.name as character_name, cp.avatar as character_avatar,
+			cb.user_id as character_user_id,
 			%s
 		FROM posts p
 		LEFT JOIN users u ON p.author_user_id = u.id
@@ -227,6 +338,21 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 		LIMIT ? OFFSET ?
 	`, strings.Join(flattenedCols, ", "))
 
+	// Profile fields are filtered per post, owners and character moderators see owner-only fields
+	viewerID := Services.GetUserIdFromContext(c)
+	viewerIsStaff, err := Services.IsStaff(viewerID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+		c.Abort()
+		return
+	}
+	viewerIsModerator, err := Services.HasModerationPermission(viewerID, "moderate_characters", db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+		c.Abort()
+		return
+	}
+
 	rows, err := db.Query(query, topicID, limit, offset)
 	if err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get posts: " + err.Error()})
@@ -238,6 +364,7 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 	// 3. Scan and process results
 	cols, _ := rows.Columns()
 	posts := make([]Entities.Post, 0) // Initialize slice
+	profileHtml := Services.NewFieldHtmlBatch("character_profile")
 
 	for rows.Next() {
 		// Scan into a map
@@ -265,7 +392,15 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 		post.AuthorUserId, _ = strconv.Atoi(rowMap["author_user_id"].(string))
 		post.DateCreated, _ = time.Parse("2006-01-02 15:04:05", rowMap["date_created"].(string))
 		post.Content = rowMap["content"].(string)
-		post.ContentHtml = Entities.ParseBBCode(post.Content)
+		if html, ok := rowMap["content_html"]; ok {
+			post.ContentHtml = html.(string)
+		}
+		if version, ok := rowMap["content_html_version"]; ok {
+			post.ContentHtmlVersion = version.(string)
+		}
+		if quotes, ok := rowMap["content_html_quotes"]; ok {
+			post.ContentHtmlQuotes = quotes.(string)
+		}
 		post.UseCharacterProfile, _ = strconv.ParseBool(rowMap["use_character_profile"].(string))
 
 		if post.UseCharacterProfile {
@@ -288,17 +423,22 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 			customFields := make(map[string]Entities.CustomFieldValue)
 			for _, field := range customConfig {
 				if val, ok := rowMap[field.MachineFieldName]; ok {
-					cfValue := Entities.CustomFieldValue{Content: val}
-					if field.FieldType == "text" {
-						if s, ok := val.(string); ok {
-							cfValue.ContentHtml = Entities.ParseBBCode(s)
-						}
-					}
-					customFields[field.MachineFieldName] = cfValue
+					customFields[field.MachineFieldName] = Entities.CustomFieldValue{Content: val}
 				}
 			}
 			charProfile.CustomFields.CustomFields = customFields
 			charProfile.CustomFields.FieldConfig = customConfig // Add this line
+
+			access := &Services.FieldAccess{ViewerID: viewerID, IsModerator: viewerIsModerator, IsStaff: viewerIsStaff}
+			if ownerID, ok := rowMap["character_user_id"]; ok && viewerID != 0 {
+				access.IsOwner = ownerID.(string) == strconv.Itoa(viewerID)
+			}
+			charProfile.CustomFields.FilterFields(access.CanView)
+			for _, field := range charProfile.CustomFields.FieldConfig {
+				if text, ok := customFields[field.MachineFieldName].Content.(string); ok && field.FieldType == "text" {
+					profileHtml.AddField(charProfile.Id, field.MachineFieldName, text, customFields)
+				}
+			}
 			post.CharacterProfile = &charProfile
 		} else {
 			var userProfile Entities.UserProfile
@@ -314,6 +454,33 @@ func GetPostsByTopic(c *gin.Context, db *sql.DB) {
 		posts = append(posts, post)
 	}
 
+	if err := profileHtml.Resolve(db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to render character profiles: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if err := Services.RenderPosts(posts, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to render posts: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	// Move the reader's marker to the last post on this page
+	if userID := Services.GetUserIdFromContext(c); userID > 0 && len(posts) > 0 {
+		lastPostID := 0
+		for _, p := range posts {
+			if p.Id > lastPostID {
+				lastPostID = p.Id
+			}
+		}
+		if err := Services.MarkTopicRead(userID, topicID, lastPostID, db); err != nil {
+			fmt.Printf("Error updating read marker: %v\n", err)
+		}
+		if err := Services.TouchUserLastVisit(userID, db); err != nil {
+			fmt.Printf("Error updating last visit: %v\n", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, posts)
 }
 
@@ -363,7 +530,14 @@ func GetTopic(c *gin.Context, db *sql.DB) {
 			return
 		}
 
-		entity, err := Services.GetEntity(int64(episodeID), "episode", db)
+		access, err := Services.GetFieldAccess("episode", int64(episodeID), Services.GetUserIdFromContext(c), db)
+		if err != nil {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+			c.Abort()
+			return
+		}
+
+		entity, err := Services.GetEntity(int64(episodeID), "episode", access, db)
 		if err != nil {
 			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get episode entity: " + err.Error()})
 			c.Abort()
@@ -398,7 +572,13 @@ func GetTopic(c *gin.Context, db *sql.DB) {
 				// c.Abort()
 			}
 		} else {
-			entity, err := Services.GetEntity(int64(characterID), "character", db)
+			access, err := Services.GetFieldAccess("character", int64(characterID), Services.GetUserIdFromContext(c), db)
+			if err != nil {
+				_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+				c.Abort()
+				return
+			}
+			entity, err := Services.GetEntity(int64(characterID), "character", access, db)
 			if err != nil {
 				_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get character entity: " + err.Error()})
 				c.Abort()
@@ -427,6 +607,46 @@ func CreatePost(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	if err := Services.RequireVerifiedEmail(userID, db); err != nil {
+		if err == Services.ErrEmailNotVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before posting"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification: " + err.Error()})
+		}
+		return
+	}
+
+	content, err := Services.ExpandQuotes(req.Content, req.QuotedPostIDs, userID, db)
+	if err != nil {
+		if errors.Is(err, Services.ErrQuotedPostNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote posts: " + err.Error()})
+		}
+		return
+	}
+	if err := Services.ValidateRolls(content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Posting as a character requires owning it, so transferred characters follow their new owner
+	if req.UseCharacterProfile && req.CharacterProfileID != nil {
+		ownerID, err := Services.GetCharacterProfileOwner(*req.CharacterProfileID, db)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Character profile not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get character profile owner: " + err.Error()})
+			}
+			return
+		}
+		if ownerID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not own this character"})
+			return
+		}
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
@@ -436,7 +656,7 @@ func CreatePost(c *gin.Context, db *sql.DB) {
 
 	// Insert Post
 	res, err := tx.Exec("INSERT INTO posts (topic_id, author_user_id, content, date_created, use_character_profile, character_profile_id) VALUES (?, ?, ?, NOW(), ?, ?)",
-		req.TopicID, userID, req.Content, req.UseCharacterProfile, req.CharacterProfileID)
+		req.TopicID, userID, content, req.UseCharacterProfile, req.CharacterProfileID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert post: " + err.Error()})
 		return
@@ -446,11 +666,48 @@ func CreatePost(c *gin.Context, db *sql.DB) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get post ID"})
 		return
 	}
+	// Episodes and character sheets start without a post, their first one is created here.
+	// Set in the transaction so the topic shows as unread before the PostCreated handlers run.
+	if _, err := tx.Exec("UPDATE topics SET last_post_id = ? WHERE id = ?", postID, req.TopicID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update topic: " + err.Error()})
+		return
+	}
+
+	if err := Services.RollDice(postID, content, tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := Services.SaveQuoteReferences(postID, userID, content, tx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save quotes: " + err.Error()})
+		return
+	}
+
+	if len(req.AttachmentIDs) > 0 {
+		subforumID, err := Services.GetTopicSubforum(req.TopicID, tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get topic: " + err.Error()})
+			return
+		}
+		limits, err := Services.GetAttachmentLimits(subforumID, tx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment limits: " + err.Error()})
+			return
+		}
+		if err := Services.AttachToPost(postID, req.TopicID, userID, req.AttachmentIDs, limits, tx); err != nil {
+			if errors.Is(err, Services.ErrInvalidAttachment) || errors.Is(err, Services.ErrTooManyAttachments) || errors.Is(err, Services.ErrAttachmentsDisabled) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to attach files: " + err.Error()})
+			}
+			return
+		}
+	}
 
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
 		return
 	}
+	discardPublishedDraft(userID, Entities.DraftPost, req.TopicID, db)
 
 	// Handle Mentions
 	// Regex to find @username (assuming alphanumeric + underscore)
@@ -523,3 +780,133 @@ func CreatePost(c *gin.Context, db *sql.DB) {
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Post created successfully", "post_id": postID})
 }
+
+// UpdatePost edits a post's text. Authors need subforum_edit_own_post, anyone else
+// subforum_edit_others_post in the topic's subforum.
+func UpdatePost(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid post ID"})
+		c.Abort()
+		return
+	}
+	if err := Services.RequireVerifiedEmail(userID, db); err != nil {
+		if err == Services.ErrEmailNotVerified {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Please verify your email address before posting"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check email verification: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	var req UpdatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	authorID, topicID, err := Services.GetPostAuthor(postID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Post not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get post: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	permission := "subforum_edit_others_post"
+	if authorID == userID {
+		permission = "subforum_edit_own_post"
+	}
+	if _, ok := topicSubforumWithPermission(c, db, topicID, userID, permission); !ok {
+		return
+	}
+
+	// The rolls are checked against the text being replaced, which changes together with its recorded
+	// quotes, so reply lookups never see a half-made edit
+	tx, err := db.Begin()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
+		c.Abort()
+		return
+	}
+	defer tx.Rollback()
+
+	if err := Services.CheckRollsKept(postID, req.Content, tx); err != nil {
+		if errors.Is(err, Services.ErrRollInEdit) || errors.Is(err, Services.ErrRollRemoved) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check dice rolls: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	if err := Services.UpdatePostContent(postID, req.Content, tx); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update post: " + err.Error()})
+		c.Abort()
+		return
+	}
+	// Checked against the author, whose name the post carries, not a moderator editing it
+	if _, err := Services.SaveQuoteReferences(int64(postID), authorID, req.Content, tx); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to save quotes: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to commit transaction"})
+		c.Abort()
+		return
+	}
+
+	post, err := Services.GetPostById(postID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get post: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// GetPostReplies lists the posts that quote a post.
+func GetPostReplies(c *gin.Context, db *sql.DB) {
+	postID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid post ID"})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	_, topicID, err := Services.GetPostAuthor(postID, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Post not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get post: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	if _, ok := topicSubforumWithPermission(c, db, topicID, userID, "subforum_read"); !ok {
+		return
+	}
+
+	replies, err := Services.GetPostReplies(postID, userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get replies: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, replies)
+}
@@ -0,0 +1,287 @@
+package Controllers
+
+import (
+	"cuento-backend/config"
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/RateLimit"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func twoFactorError(c *gin.Context, err error) {
+	switch err {
+	case Services.ErrInvalidTwoFactorCode:
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Invalid two-factor code"})
+	case Services.ErrTwoFactorNotEnrolled:
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Two-factor authentication is not set up"})
+	case Services.ErrTwoFactorAlreadyEnabled:
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: "Two-factor authentication is already enabled"})
+	default:
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Two-factor authentication failed: " + err.Error()})
+	}
+	c.Abort()
+}
+
+// TwoFactorLoginAccount names the account of a /login/2fa request for the lockout, so wrong codes
+// count against the user however many IPs and challenges they come from. It is keyed by user ID
+// apart from the username key of /login, which every correct password clears.
+func TwoFactorLoginAccount(c *gin.Context, db *sql.DB) string {
+	var payload struct {
+		ChallengeToken string `json:"challenge_token"`
+	}
+	RateLimit.PeekJSON(c, &payload)
+	if payload.ChallengeToken == "" {
+		return ""
+	}
+	userID, err := Services.FindUserToken(payload.ChallengeToken, Services.TwoFactorChallengeToken, db)
+	if err != nil {
+		return ""
+	}
+	return "2fa:" + strconv.Itoa(userID)
+}
+
+// LoginTwoFactor is the second login step: it trades a challenge token and a code for a session.
+func LoginTwoFactor(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig, keys *Middlewares.KeySet) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	// A right code uses the challenge up, so it opens one session only. Wrong codes are counted
+	// and the challenge stops working after TwoFactorChallengeMaxFailures of them.
+	userID, err := Services.FindUserToken(req.ChallengeToken, Services.TwoFactorChallengeToken, db)
+	if err != nil {
+		if err == Services.ErrInvalidUserToken {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Login challenge is invalid or has expired, please log in again"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check login challenge: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	if err := Services.VerifyTwoFactor(userID, req.Code, req.RecoveryCode, db); err != nil {
+		if err == Services.ErrInvalidTwoFactorCode {
+			if err := Services.RecordUserTokenFailure(req.ChallengeToken, Services.TwoFactorChallengeToken, Services.TwoFactorChallengeMaxFailures, db); err != nil {
+				twoFactorError(c, err)
+				return
+			}
+		}
+		twoFactorError(c, err)
+		return
+	}
+
+	if _, err := Services.ConsumeUserToken(req.ChallengeToken, Services.TwoFactorChallengeToken, db); err != nil {
+		if err == Services.ErrInvalidUserToken {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Login challenge is invalid or has expired, please log in again"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to use login challenge: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	var user Entities.User
+	err = db.QueryRow("SELECT id, username, avatar, email FROM users WHERE id = ?", userID).Scan(&user.Id, &user.Username, &user.Avatar, &user.Email)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Database error"})
+		c.Abort()
+		return
+	}
+
+	completeLogin(c, db, authConfig, keys, user)
+}
+
+func GetTwoFactorStatus(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	enabled, err := Services.HasTwoFactor(userID, db)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	required, err := Services.UserRequiresTwoFactor(userID, db)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	codesLeft, err := Services.CountUnusedRecoveryCodes(userID, db)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":             enabled,
+		"required":            required,
+		"recovery_codes_left": codesLeft,
+	})
+}
+
+func EnrolTwoFactor(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	enrolment, err := Services.EnrolTwoFactor(userID, db)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrolment)
+}
+
+func ConfirmTwoFactor(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "A code from the authenticator app is required"})
+		c.Abort()
+		return
+	}
+
+	// 2FA is only switched on together with the recovery codes the user gets back
+	tx, err := db.Begin()
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := Services.ConfirmTwoFactor(userID, req.Code, tx)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	// Sessions opened with only a password shouldn't outlive the switch to 2FA
+	sessionID := Services.GetSessionIdFromContext(c)
+	if err := Services.RevokeOtherSessions(userID, sessionID, tx); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	// Requests checked while the transaction ran may have cached the old state again
+	Services.ForgetTwoFactorState(userID)
+	Services.ForgetOtherSessions(userID, sessionID)
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "A code from the authenticator app is required"})
+		c.Abort()
+		return
+	}
+
+	// The old codes are only replaced once all new ones are stored
+	tx, err := db.Begin()
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := Services.VerifyTwoFactor(userID, req.Code, "", tx); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	codes, err := Services.RegenerateRecoveryCodes(userID, tx)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func DisableTwoFactor(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "A code or a recovery code is required"})
+		c.Abort()
+		return
+	}
+
+	required, err := Services.UserRequiresTwoFactor(userID, db)
+	if err != nil {
+		twoFactorError(c, err)
+		return
+	}
+	if required {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Two-factor authentication is required for your role and can't be disabled"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.VerifyTwoFactor(userID, req.Code, req.RecoveryCode, db); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	if err := Services.DisableTwoFactor(userID, db); err != nil {
+		twoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
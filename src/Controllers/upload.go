@@ -0,0 +1,156 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"cuento-backend/src/Uploads"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Room for the multipart envelope around the file itself
+const multipartOverhead = 64 << 10
+
+func UploadImage(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	limits := Services.UploadLimits()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limits.MaxFileSize)+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusRequestEntityTooLarge, Message: Uploads.ErrFileTooLarge.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "A file field is required: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+	kind := Entities.UploadKind(c.DefaultPostForm("kind", string(Entities.ImageUpload)))
+	if !kind.IsValid() {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Kind must be avatar or image"})
+		c.Abort()
+		return
+	}
+	if header.Size > int64(limits.MaxFileSize) {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusRequestEntityTooLarge, Message: Uploads.ErrFileTooLarge.Error()})
+		c.Abort()
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Failed to read file: " + err.Error()})
+		c.Abort()
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(limits.MaxFileSize)+1))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Failed to read file: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	upload, err := Services.SaveImageUpload(userID, kind, header.Filename, data, db)
+	if err != nil {
+		switch {
+		case errors.Is(err, Uploads.ErrFileTooLarge), errors.Is(err, Services.ErrUploadQuotaReached):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusRequestEntityTooLarge, Message: err.Error()})
+		case errors.Is(err, Uploads.ErrUnsupportedType):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusUnsupportedMediaType, Message: err.Error()})
+		case errors.Is(err, Uploads.ErrImageTooLarge):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error()})
+		default:
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to save upload: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusCreated, upload)
+}
+
+func GetUserUploads(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	kind := Entities.UploadKind(c.DefaultQuery("kind", string(Entities.AvatarUpload)))
+	if !kind.IsValid() {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Kind must be avatar or image"})
+		c.Abort()
+		return
+	}
+
+	uploads, err := Services.GetUserUploads(userID, kind, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get uploads: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, uploads)
+}
+
+func DeleteUpload(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid upload ID"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.DeleteUpload(id, userID, db); err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Upload not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to delete upload: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Upload deleted"})
+}
+
+// checkImageURLs aborts with 400 if any of the image URLs breaks the require_uploaded_images setting.
+func checkImageURLs(c *gin.Context, db *sql.DB, urls ...*string) bool {
+	for _, url := range urls {
+		if url == nil {
+			continue
+		}
+		if err := Services.CheckImageURL(*url, db); err != nil {
+			if errors.Is(err, Services.ErrExternalImage) {
+				_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error() + ", use POST /upload/image"})
+			} else {
+				_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check image: " + err.Error()})
+			}
+			c.Abort()
+			return false
+		}
+	}
+	return true
+}
@@ -1,10 +1,12 @@
 package Controllers
 
 import (
+	"cuento-backend/config"
 	"cuento-backend/src/Entities"
 	"cuento-backend/src/Middlewares"
 	"cuento-backend/src/Services"
 	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -12,24 +14,16 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("your_secret_key") // In production, use environment variable
-
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
-type Claims struct {
-	Username string `json:"username"`
-	UserID   int    `json:"user_id"`
-	jwt.RegisteredClaims
-}
-
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
-func Register(c *gin.Context, db *sql.DB) {
+func Register(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig) {
 	var user Entities.User
 	if err := c.ShouldBindJSON(&user); err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
@@ -37,7 +31,7 @@ func Register(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	if err := user.HashPassword(user.Password); err != nil {
+	if err := user.HashPassword(user.Password, authConfig.BcryptCost); err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to hash password"})
 		c.Abort()
 		return
@@ -76,13 +70,18 @@ func Register(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Registration succeeds even if the mail can't be sent, the user can ask for another link later
+	if err := Services.SendEmailVerification(user.Id, db); err != nil {
+		fmt.Printf("Error sending verification email: %v\n", err)
+	}
+
 	user.Password = "" // Don't return password
 	user.Roles = []Entities.Role{{Id: defaultRoleID, Name: "user"}}
 
 	c.JSON(http.StatusCreated, user)
 }
 
-func Login(c *gin.Context, db *sql.DB) {
+func Login(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig, keys *Middlewares.KeySet) {
 	var creds Credentials
 	if err := c.ShouldBindJSON(&creds); err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
@@ -103,91 +102,125 @@ func Login(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Fetch user roles from many-to-many relationship
-	rolesQuery := `
-		SELECT r.id, r.name
-		FROM roles r
-		INNER JOIN user_role ur ON r.id = ur.role_id
-		WHERE ur.user_id = ?`
-	rows, err := db.Query(rolesQuery, user.Id)
-	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to fetch user roles: " + err.Error()})
+	if err := user.CheckPassword(creds.Password); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Invalid credentials: " + err.Error()})
 		c.Abort()
 		return
 	}
-	defer rows.Close()
 
-	user.Roles = []Entities.Role{}
-	for rows.Next() {
-		var role Entities.Role
-		if err := rows.Scan(&role.Id, &role.Name); err != nil {
-			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to scan role: " + err.Error()})
+	// With 2FA enabled the password only earns a short-lived, single-use challenge token for POST /login/2fa
+	hasTwoFactor, err := Services.HasTwoFactor(user.Id, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check two-factor authentication: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if hasTwoFactor {
+		challenge, err := Services.CreateUserToken(user.Id, Services.TwoFactorChallengeToken, Services.TwoFactorChallengeTokenTTL, db)
+		if err != nil {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to generate challenge token"})
 			c.Abort()
 			return
 		}
-		user.Roles = append(user.Roles, role)
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+		return
 	}
 
-	// Check for errors during iteration
-	if err := rows.Err(); err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Error iterating roles: " + err.Error()})
+	completeLogin(c, db, authConfig, keys, user)
+}
+
+// completeLogin starts a new session for the authenticated user and responds with its tokens.
+func completeLogin(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig, keys *Middlewares.KeySet, user Entities.User) {
+	roles, err := Services.GetUserRoles(user.Id, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to fetch user roles: " + err.Error()})
 		c.Abort()
 		return
 	}
+	user.Roles = roles
 
-	if err := user.CheckPassword(creds.Password); err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Invalid credentials: " + err.Error()})
+	sessionID, err := Services.NewSessionID()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start session"})
+		c.Abort()
+		return
+	}
+
+	tokenString, refreshTokenString, err := issueTokenPair(c, db, authConfig, keys, user.Id, user.Username, sessionID, time.Now())
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to generate tokens: " + err.Error()})
 		c.Abort()
 		return
 	}
 
-	// Generate Access Token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: user.Username,
-		UserID:   user.Id,
+	// Staff on a board that requires 2FA can still log in, but only to set it up
+	setupRequired := false
+	if required, err := Services.UserRequiresTwoFactor(user.Id, db); err == nil && required {
+		hasTwoFactor, _ := Services.HasTwoFactor(user.Id, db)
+		setupRequired = !hasTwoFactor
+	}
+
+	user.Password = "" // Don't return password
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":              tokenString,
+		"refresh_token":             refreshTokenString,
+		"user":                      user,
+		"two_factor_setup_required": setupRequired,
+	})
+}
+
+// issueTokenPair signs an access token and a refresh token for the session and stores the refresh token.
+func issueTokenPair(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig, keys *Middlewares.KeySet, userID int, username string, sessionID string, sessionStarted time.Time) (string, string, error) {
+	expirationTime := time.Now().Add(authConfig.AccessTokenTTL.Std())
+	claims := &Middlewares.Claims{
+		Username:  username,
+		UserID:    userID,
+		TokenType: Middlewares.AccessTokenType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "cuento-backend",
+			Issuer:    authConfig.Issuer,
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	accessToken, err := keys.Sign(claims)
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to generate token"})
-		c.Abort()
-		return
+		return "", "", err
 	}
 
-	// Generate Refresh Token
-	refreshExpirationTime := time.Now().Add(7 * 24 * time.Hour)
-	refreshClaims := &Claims{
-		Username: user.Username,
-		UserID:   user.Id,
+	// The random ID makes every refresh token unique even when two are issued in the same second
+	tokenID, err := Services.NewSessionID()
+	if err != nil {
+		return "", "", err
+	}
+	refreshExpirationTime := time.Now().Add(authConfig.RefreshTokenTTL.Std())
+	refreshClaims := &Middlewares.Claims{
+		Username:  username,
+		UserID:    userID,
+		TokenType: Middlewares.RefreshTokenType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(refreshExpirationTime),
-			Issuer:    "cuento-backend",
+			Issuer:    authConfig.Issuer,
 		},
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(jwtKey)
+	refreshToken, err := keys.Sign(refreshClaims)
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to generate refresh token"})
-		c.Abort()
-		return
+		return "", "", err
 	}
 
-	user.Password = "" // Don't return password
-
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  tokenString,
-		"refresh_token": refreshTokenString,
-		"user":          user,
-	})
+	err = Services.StoreRefreshToken(userID, sessionID, refreshToken, refreshExpirationTime, sessionStarted, c.Request.UserAgent(), c.ClientIP(), db)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
 }
 
-func RefreshToken(c *gin.Context, db *sql.DB) {
+func RefreshToken(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig, keys *Middlewares.KeySet) {
 	var req RefreshTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
@@ -195,41 +228,124 @@ func RefreshToken(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(req.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
+	claims, err := keys.Parse(req.RefreshToken)
+	if err != nil || claims.TokenType != Middlewares.RefreshTokenType {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Invalid refresh token"})
 		c.Abort()
 		return
 	}
 
-	// Generate new Access Token
-	expirationTime := time.Now().Add(24 * time.Hour)
-	newClaims := &Claims{
-		Username: claims.Username,
-		UserID:   claims.UserID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "cuento-backend",
-		},
+	// Every refresh token works once; the response carries its replacement
+	used, err := Services.UseRefreshToken(req.RefreshToken, db)
+	if err != nil {
+		switch err {
+		case Services.ErrRefreshTokenReused:
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Refresh token was already used, the session has been ended"})
+		case Services.ErrRefreshTokenInvalid:
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Invalid refresh token"})
+		default:
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check refresh token: " + err.Error()})
+		}
+		c.Abort()
+		return
 	}
 
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
-	newTokenString, err := newToken.SignedString(jwtKey)
+	newTokenString, newRefreshTokenString, err := issueTokenPair(c, db, authConfig, keys, used.UserID, claims.Username, used.SessionID, used.SessionStarted)
 	if err != nil {
-		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to generate new access token"})
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to generate new tokens: " + err.Error()})
 		c.Abort()
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"access_token": newTokenString,
+		"access_token":  newTokenString,
+		"refresh_token": newRefreshTokenString,
 	})
 }
 
+// Logout ends the current session. The refresh token may be sent instead when the access token has expired.
+func Logout(c *gin.Context, db *sql.DB) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	userID := Services.GetUserIdFromContext(c)
+	sessionID := Services.GetSessionIdFromContext(c)
+	if req.RefreshToken != "" {
+		tokenUserID, tokenSessionID, err := Services.FindRefreshTokenSession(req.RefreshToken, db)
+		if err == nil && (userID == 0 || userID == tokenUserID) {
+			userID, sessionID = tokenUserID, tokenSessionID
+		}
+	}
+
+	if userID == 0 || sessionID == "" {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "No session to log out of"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.RevokeSession(userID, sessionID, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to log out: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func LogoutEverywhere(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.RevokeAllUserSessions(userID, db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to log out: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+func GetUserSessions(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	sessions, err := Services.GetUserSessions(userID, Services.GetSessionIdFromContext(c), db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get sessions: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+func RevokeUserSession(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if err := Services.RevokeSession(userID, c.Param("id"), db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to end session: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session ended"})
+}
+
 func GetUsersByPage(c *gin.Context, db *sql.DB) {
 	pageType := c.Param("page_type")
 	pageId := c.Param("page_id")
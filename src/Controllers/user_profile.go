@@ -0,0 +1,212 @@
+package Controllers
+
+import (
+	"cuento-backend/config"
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	Password string `json:"password" binding:"required"`
+	NewEmail string `json:"new_email" binding:"required,email"`
+}
+
+func GetPublicUser(c *gin.Context, db *sql.DB) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid user ID"})
+		c.Abort()
+		return
+	}
+
+	user, err := Services.GetPublicUser(userID, Services.GetUserIdFromContext(c), db)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "User not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get user: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func UpdateUserSettings(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var settings Entities.UserSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := Services.UpdateUserSettings(userID, settings, db); err != nil {
+		if errors.Is(err, Services.ErrInvalidLanguage) || errors.Is(err, Services.ErrInvalidTimezone) || errors.Is(err, Services.ErrExternalImage) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update settings: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Settings updated"})
+}
+
+func UpdateUserFields(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req struct {
+		CustomFields map[string]interface{} `json:"custom_fields" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	fields, err := Services.UpdateUserFields(userID, req.CustomFields, db)
+	if err != nil {
+		if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update profile fields: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, fields)
+}
+
+// checkCurrentPassword makes sensitive account changes re-confirm the password even with a valid token
+func checkCurrentPassword(c *gin.Context, db *sql.DB, userID int, password string) bool {
+	var user Entities.User
+	if err := db.QueryRow("SELECT password FROM users WHERE id = ?", userID).Scan(&user.Password); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get user: " + err.Error()})
+		c.Abort()
+		return false
+	}
+	if err := user.CheckPassword(password); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Current password is incorrect"})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+func ChangePassword(c *gin.Context, db *sql.DB, authConfig *config.AuthConfig) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if !checkCurrentPassword(c, db, userID, req.OldPassword) {
+		return
+	}
+
+	var user Entities.User
+	if err := user.HashPassword(req.NewPassword, authConfig.BcryptCost); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to hash password"})
+		c.Abort()
+		return
+	}
+	// Other devices have to log in again with the new password
+	if err := Services.ChangePassword(userID, user.Password, Services.GetSessionIdFromContext(c), db); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to change password: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+func RequestEmailChange(c *gin.Context, db *sql.DB) {
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if !checkCurrentPassword(c, db, userID, req.Password) {
+		return
+	}
+
+	if err := Services.RequestEmailChange(userID, req.NewEmail, db); err != nil {
+		if errors.Is(err, Services.ErrEmailTaken) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to request email change: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Confirmation link sent to the new address"})
+}
+
+func ConfirmEmailChange(c *gin.Context, db *sql.DB) {
+	var req TokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if _, err := Services.ConfirmEmailChange(req.Token, db); err != nil {
+		switch {
+		case errors.Is(err, Services.ErrInvalidUserToken):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Confirmation link is invalid or has expired"})
+		case errors.Is(err, Services.ErrEmailTaken):
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: err.Error()})
+		default:
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to change email: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email changed"})
+}
@@ -0,0 +1,442 @@
+package Controllers
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/Services"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateWantedRequest struct {
+	Name         string                               `json:"name" binding:"required"`
+	Avatar       *string                              `json:"avatar"`
+	CustomFields map[string]Entities.CustomFieldValue `json:"custom_fields"`
+	FactionIDs   []int                                `json:"faction_ids"`
+}
+
+type ClaimWantedRequest struct {
+	SubforumID   int                                  `json:"subforum_id" binding:"required"`
+	Avatar       *string                              `json:"avatar"`
+	Message      *string                              `json:"message"`
+	CustomFields map[string]Entities.CustomFieldValue `json:"custom_fields"`
+}
+
+// Keys of a wanted character patch that are written through PatchEntity
+var wantedPatchableFields = map[string]bool{
+	"name":          true,
+	"avatar":        true,
+	"wanted_status": true,
+	"custom_fields": true,
+}
+
+func CreateWanted(c *gin.Context, db *sql.DB) {
+	var req CreateWantedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if !checkImageURLs(c, db, req.Avatar) {
+		return
+	}
+
+	access, err := Services.GetCreatorFieldAccess("wanted_character", userID, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
+		c.Abort()
+		return
+	}
+	defer tx.Rollback()
+
+	wanted := Entities.WantedCharacter{
+		AuthorUserId: userID,
+		Name:         req.Name,
+		Avatar:       req.Avatar,
+		WantedStatus: Entities.OpenWanted,
+		CustomFields: Entities.CustomFieldEntity{
+			CustomFields: req.CustomFields,
+		},
+	}
+
+	_, wantedID, err := Services.CreateEntity("wanted_character", &wanted, access, tx)
+	if err != nil {
+		if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to create wanted character: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	if err := Services.SetWantedFactions(int(wantedID), req.FactionIDs, tx); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to add factions: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to commit transaction"})
+		c.Abort()
+		return
+	}
+
+	created, err := Services.GetWantedCharacter(int(wantedID), Services.GetUserIdFromContext(c), db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get wanted character: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func GetWanted(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	wanted, err := Services.GetWantedCharacter(id, Services.GetUserIdFromContext(c), db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Wanted character not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get wanted character: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, wanted)
+}
+
+func GetWantedList(c *gin.Context, db *sql.DB) {
+	var filter Services.WantedFilter
+	if err := c.ShouldBindJSON(&filter); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	items, err := Services.ListWantedCharacters(filter, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get wanted characters: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+func PatchWanted(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	var jsonMap map[string]interface{}
+	if err := c.ShouldBindJSON(&jsonMap); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	if !requireWantedAuthor(c, db, id) {
+		return
+	}
+
+	updates := make(map[string]interface{})
+	for key, val := range jsonMap {
+		if wantedPatchableFields[key] {
+			updates[key] = val
+		}
+	}
+	if avatar, ok := updates["avatar"].(string); ok && !checkImageURLs(c, db, &avatar) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to start transaction"})
+		c.Abort()
+		return
+	}
+	defer tx.Rollback()
+
+	access, err := Services.GetFieldAccess("wanted_character", int64(id), Services.GetUserIdFromContext(c), tx)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to check field access: " + err.Error()})
+		c.Abort()
+		return
+	}
+	if _, err := Services.PatchEntity(int64(id), "wanted_character", updates, access, tx); err != nil {
+		if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to patch wanted character: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	if rawFactions, ok := jsonMap["faction_ids"].([]interface{}); ok {
+		var factionIDs []int
+		for _, raw := range rawFactions {
+			if f, ok := raw.(float64); ok {
+				factionIDs = append(factionIDs, int(f))
+			}
+		}
+		if err := Services.SetWantedFactions(id, factionIDs, tx); err != nil {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to update factions: " + err.Error()})
+			c.Abort()
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to commit transaction"})
+		c.Abort()
+		return
+	}
+
+	wanted, err := Services.GetWantedCharacter(id, Services.GetUserIdFromContext(c), db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get wanted character: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, wanted)
+}
+
+func ClaimWanted(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	var req ClaimWantedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	userID := Services.GetUserIdFromContext(c)
+	if userID == 0 {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
+		c.Abort()
+		return
+	}
+
+	if !checkImageURLs(c, db, req.Avatar) {
+		return
+	}
+
+	claim, err := Services.CreateWantedClaim(Entities.WantedClaim{
+		WantedCharacterId: id,
+		UserId:            userID,
+		SubforumId:        req.SubforumID,
+		Avatar:            req.Avatar,
+		Message:           req.Message,
+		CustomFields:      req.CustomFields,
+	}, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Wanted character not found"})
+		} else if err == Services.ErrWantedNotOpen {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: "Wanted character is not open for claims"})
+		} else if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to claim wanted character: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	var authorID int
+	var name string
+	if err := db.QueryRow("SELECT author_user_id, name FROM wanted_character_base WHERE id = ?", id).Scan(&authorID, &name); err == nil && authorID != userID {
+		Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+			UserID:  authorID,
+			Type:    "wanted_claim",
+			Message: fmt.Sprintf("%s wants to claim %s", claim.Username, name),
+			Data: gin.H{
+				"wanted_character_id": id,
+				"claim_id":            claim.Id,
+			},
+		})
+	}
+
+	c.JSON(http.StatusCreated, claim)
+}
+
+func GetWantedClaims(c *gin.Context, db *sql.DB) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return
+	}
+
+	if !requireWantedAuthor(c, db, id) {
+		return
+	}
+
+	claims, err := Services.GetWantedClaims(id, db)
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get claims: " + err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.JSON(http.StatusOK, claims)
+}
+
+func AcceptWantedClaim(c *gin.Context, db *sql.DB) {
+	claim := loadWantedClaimForAuthor(c, db)
+	if claim == nil {
+		return
+	}
+
+	claim, character, declinedUserIDs, err := Services.AcceptWantedClaim(claim.Id, db)
+	if err != nil {
+		if err == Services.ErrClaimNotPending || err == Services.ErrWantedNotOpen {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: err.Error()})
+		} else if errors.Is(err, Services.ErrFieldNotEditable) {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "The claim sets a field its claimant can't: " + err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to accept claim: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+		UserID:  claim.UserId,
+		Type:    "wanted_claim_accepted",
+		Message: "Your claim was accepted, your character is now pending approval",
+		Data: gin.H{
+			"wanted_character_id": claim.WantedCharacterId,
+			"character_id":        claim.CharacterId,
+		},
+	})
+	for _, userID := range declinedUserIDs {
+		Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+			UserID:  userID,
+			Type:    "wanted_claim_declined",
+			Message: "Your claim was declined, another claim for this character was accepted",
+			Data: gin.H{
+				"wanted_character_id": claim.WantedCharacterId,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"claim": claim, "character": character})
+}
+
+func DeclineWantedClaim(c *gin.Context, db *sql.DB) {
+	claim := loadWantedClaimForAuthor(c, db)
+	if claim == nil {
+		return
+	}
+
+	claim, err := Services.DeclineWantedClaim(claim.Id, db)
+	if err != nil {
+		if err == Services.ErrClaimNotPending {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusConflict, Message: err.Error()})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to decline claim: " + err.Error()})
+		}
+		c.Abort()
+		return
+	}
+
+	Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+		UserID:  claim.UserId,
+		Type:    "wanted_claim_declined",
+		Message: "Your claim was declined",
+		Data: gin.H{
+			"wanted_character_id": claim.WantedCharacterId,
+		},
+	})
+
+	c.JSON(http.StatusOK, claim)
+}
+
+func loadWantedClaimForAuthor(c *gin.Context, db *sql.DB) *Entities.WantedClaim {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusBadRequest, Message: "Invalid Id"})
+		c.Abort()
+		return nil
+	}
+
+	claim, err := Services.GetWantedClaim(id, db)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Claim not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get claim: " + err.Error()})
+		}
+		c.Abort()
+		return nil
+	}
+
+	if !requireWantedAuthor(c, db, claim.WantedCharacterId) {
+		return nil
+	}
+	return claim
+}
+
+// requireWantedAuthor aborts the request unless the current user wrote the wanted character.
+func requireWantedAuthor(c *gin.Context, db *sql.DB, wantedID int) bool {
+	var authorID int
+	err := db.QueryRow("SELECT author_user_id FROM wanted_character_base WHERE id = ?", wantedID).Scan(&authorID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusNotFound, Message: "Wanted character not found"})
+		} else {
+			_ = c.Error(&Middlewares.AppError{Code: http.StatusInternalServerError, Message: "Failed to get wanted character: " + err.Error()})
+		}
+		c.Abort()
+		return false
+	}
+
+	if authorID != Services.GetUserIdFromContext(c) {
+		_ = c.Error(&Middlewares.AppError{Code: http.StatusForbidden, Message: "Only the author can manage this wanted character"})
+		c.Abort()
+		return false
+	}
+	return true
+}
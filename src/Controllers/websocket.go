@@ -2,6 +2,7 @@ package Controllers
 
 import (
 	"cuento-backend/src/Middlewares"
+	"cuento-backend/src/RateLimit"
 	"cuento-backend/src/Services"
 	"cuento-backend/src/Websockets"
 	"database/sql"
@@ -14,6 +15,9 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// Messages from clients are small except draft autosaves, which carry a whole post
+const maxSocketMessage = 256 << 10
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -22,7 +26,9 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func HandleWebSocket(c *gin.Context, db *sql.DB) {
+// HandleWebSocket serves a user's connection. Draft saves sent over it count against draftLimit
+// like saves over REST.
+func HandleWebSocket(c *gin.Context, db *sql.DB, limiter *RateLimit.Limiter, draftLimit RateLimit.Rule) {
 	userID := Services.GetUserIdFromContext(c)
 	if userID == 0 {
 		_ = c.Error(&Middlewares.AppError{Code: http.StatusUnauthorized, Message: "Unauthorized"})
@@ -56,6 +62,9 @@ func HandleWebSocket(c *gin.Context, db *sql.DB) {
 
 	Websockets.MainHub.Register(client)
 	Services.ActivityStorage.AddUser(userID, username)
+	if err := Services.TouchUserLastVisit(userID, db); err != nil {
+		fmt.Printf("Error updating last visit: %v\n", err)
+	}
 
 	// Read loop to keep connection alive and detect disconnects
 	go func() {
@@ -66,7 +75,7 @@ func HandleWebSocket(c *gin.Context, db *sql.DB) {
 		}()
 
 		// Set up Ping/Pong handlers to keep connection alive
-		conn.SetReadLimit(512)
+		conn.SetReadLimit(maxSocketMessage)
 		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 		conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(60 * time.Second)); return nil })
 
@@ -82,7 +91,9 @@ func HandleWebSocket(c *gin.Context, db *sql.DB) {
 				PageId   interface{} `json:"page_id"`
 			}
 			if err := json.Unmarshal(p, &msg); err == nil {
-				if msg.Type == "page_change" {
+				if msg.Type == "draft_save" || msg.Type == "draft_delete" {
+					handleDraftMessage(client, msg.Type, p, db, limiter, draftLimit)
+				} else if msg.Type == "page_change" {
 					var pageIdStr string
 					switch v := msg.PageId.(type) {
 					case string:
@@ -0,0 +1,28 @@
+package Entities
+
+import "time"
+
+type CharacterTransferStatus int
+
+const (
+	PendingTransfer   CharacterTransferStatus = 0
+	AcceptedTransfer  CharacterTransferStatus = 1
+	DeclinedTransfer  CharacterTransferStatus = 2
+	CancelledTransfer CharacterTransferStatus = 3
+)
+
+type CharacterTransfer struct {
+	Id                  int                     `json:"id"`
+	CharacterId         int                     `json:"character_id"`
+	CharacterName       string                  `json:"character_name"`
+	FromUserId          *int                    `json:"from_user_id"`
+	FromUsername        *string                 `json:"from_username"`
+	ToUserId            int                     `json:"to_user_id"`
+	ToUsername          string                  `json:"to_username"`
+	InitiatedByUserId   int                     `json:"initiated_by_user_id"`
+	InitiatedByUsername string                  `json:"initiated_by_username"`
+	IsReassignment      bool                    `json:"is_reassignment"`
+	Status              CharacterTransferStatus `json:"status"`
+	DateCreated         time.Time               `json:"date_created"`
+	DateResolved        *time.Time              `json:"date_resolved"`
+}
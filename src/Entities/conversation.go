@@ -0,0 +1,39 @@
+package Entities
+
+import "time"
+
+type Conversation struct {
+	Id                int                       `json:"id"`
+	Title             string                    `json:"title"`
+	CreatedByUserId   int                       `json:"created_by_user_id"`
+	DateCreated       time.Time                 `json:"date_created"`
+	DateLastMessage   *time.Time                `json:"date_last_message"`
+	UnreadCount       int                       `json:"unread_count"`
+	IsMuted           bool                      `json:"is_muted"`
+	Participants      []ConversationParticipant `json:"participants"`
+	LastReadMessageId int                       `json:"last_read_message_id"`
+}
+
+type ConversationParticipant struct {
+	UserId            int        `json:"user_id"`
+	Username          string     `json:"username"`
+	Avatar            *string    `json:"avatar"`
+	LastReadMessageId int        `json:"last_read_message_id"`
+	DateLastRead      *time.Time `json:"date_last_read"`
+	HasLeft           bool       `json:"has_left"`
+}
+
+type PrivateMessage struct {
+	Id                 int       `json:"id"`
+	ConversationId     int       `json:"conversation_id"`
+	AuthorUserId       int       `json:"author_user_id"`
+	AuthorUsername     string    `json:"author_username"`
+	AuthorAvatar       *string   `json:"author_avatar"`
+	CharacterProfileId *int      `json:"character_profile_id"`
+	CharacterId        *int      `json:"character_id"`
+	CharacterName      *string   `json:"character_name"`
+	CharacterAvatar    *string   `json:"character_avatar"`
+	Content            string    `json:"content"`
+	ContentHtml        string    `json:"content_html"`
+	DateCreated        time.Time `json:"date_created"`
+}
@@ -1,10 +1,10 @@
 package Entities
 
 import (
+	"cuento-backend/src/BBCode"
 	"database/sql"
 	"fmt"
-
-	"github.com/frustra/bbcode"
+	"strings"
 )
 
 type CustomField struct {
@@ -13,11 +13,39 @@ type CustomField struct {
 }
 
 type CustomFieldConfig struct {
-	MachineFieldName string `json:"machine_field_name"`
-	HumanFieldName   string `json:"human_field_name"`
-	FieldType        string `json:"field_type"`
-	ContentFieldType string `json:"content_field_type"`
-	Order            int    `json:"order"`
+	MachineFieldName string          `json:"machine_field_name"`
+	HumanFieldName   string          `json:"human_field_name"`
+	FieldType        string          `json:"field_type"`
+	ContentFieldType string          `json:"content_field_type"`
+	Order            int             `json:"order"`
+	Visibility       FieldVisibility `json:"visibility,omitempty"`
+	EditableBy       FieldEditor     `json:"editable_by,omitempty"`
+}
+
+// FieldVisibility says who can see a custom field. Empty means public. Staff see every field.
+type FieldVisibility string
+
+const (
+	FieldVisibilityPublic  FieldVisibility = "public"
+	FieldVisibilityMembers FieldVisibility = "members"
+	FieldVisibilityOwner   FieldVisibility = "owner"
+	FieldVisibilityStaff   FieldVisibility = "staff"
+)
+
+func (v FieldVisibility) IsValid() bool {
+	return v == "" || v == FieldVisibilityPublic || v == FieldVisibilityMembers || v == FieldVisibilityOwner || v == FieldVisibilityStaff
+}
+
+// FieldEditor says who can change a custom field. Empty means the owner, staff can always edit.
+type FieldEditor string
+
+const (
+	FieldEditorOwner FieldEditor = "owner"
+	FieldEditorStaff FieldEditor = "staff"
+)
+
+func (e FieldEditor) IsValid() bool {
+	return e == "" || e == FieldEditorOwner || e == FieldEditorStaff
 }
 
 type CustomFieldData struct {
@@ -36,12 +64,23 @@ type CustomFieldEntity struct {
 	FieldConfig  []CustomFieldConfig         `json:"field_config"`
 }
 
-// Compile-time check or global compiler initialization
-var compiler = bbcode.NewCompiler(true, true)
+// FilterFields drops the values and config of fields for which keep returns false.
+func (e *CustomFieldEntity) FilterFields(keep func(CustomFieldConfig) bool) {
+	config := make([]CustomFieldConfig, 0, len(e.FieldConfig))
+	for _, field := range e.FieldConfig {
+		if keep(field) {
+			config = append(config, field)
+		} else {
+			delete(e.CustomFields, field.MachineFieldName)
+		}
+	}
+	e.FieldConfig = config
+}
 
+// ParseBBCode renders text with the board's tag set. Tags that reference posts, attachments or
+// rolls need a context, see BBCode.Registry.Render.
 func ParseBBCode(text string) string {
-	// You can customize tags here if needed
-	return compiler.Compile(text)
+	return BBCode.Default.Render(text, nil)
 }
 
 func GenerateEntityTables(entity CustomFieldEntity, entityName string, db *sql.DB) error {
@@ -170,6 +209,21 @@ func UpdateFlattenedTable(entity CustomFieldEntity, entityName string, db *sql.D
 		}
 	}
 
+	// 4. Drop the cached HTML of fields that were removed or are no longer text
+	textFields := []interface{}{entityName}
+	for _, config := range entity.FieldConfig {
+		if config.FieldType == "text" {
+			textFields = append(textFields, config.MachineFieldName)
+		}
+	}
+	pruneSQL := "DELETE FROM custom_field_html WHERE entity_type = ?"
+	if len(textFields) > 1 {
+		pruneSQL += " AND field_machine_name NOT IN (?" + strings.Repeat(",?", len(textFields)-2) + ")"
+	}
+	if _, err := db.Exec(pruneSQL, textFields...); err != nil {
+		return fmt.Errorf("failed to remove cached field HTML: %w", err)
+	}
+
 	return UpdateTriggers(entity, entityName, db)
 }
 
@@ -217,6 +271,8 @@ func UpdateTriggers(entity CustomFieldEntity, entityName string, db *sql.DB) err
 	}
 
 	// Create DELETE Trigger
+	// The cached HTML of a value goes with it, whether the field or the whole entity was removed
+	deleteTriggerBody += fmt.Sprintf("DELETE FROM custom_field_html WHERE entity_type = '%s' AND entity_id = OLD.entity_id AND field_machine_name = OLD.field_machine_name; ", entityName)
 	deleteSQL := fmt.Sprintf("CREATE TRIGGER %s_main_after_delete AFTER DELETE ON %s_main FOR EACH ROW BEGIN %s END", entityName, entityName, deleteTriggerBody)
 	if _, err := db.Exec(deleteSQL); err != nil {
 		return fmt.Errorf("failed to create delete trigger: %w", err)
@@ -0,0 +1,16 @@
+package Entities
+
+import "time"
+
+// DiceRoll is a roll the server made for a [roll] tag when the post was created. Rolls are never
+// changed afterwards; Seed reproduces Results for anyone auditing them.
+type DiceRoll struct {
+	Id          int       `json:"id"`
+	PostId      int       `json:"post_id"`
+	Notation    string    `json:"notation"`
+	Results     []int     `json:"results"`
+	Modifier    int       `json:"modifier"`
+	Total       int       `json:"total"`
+	Seed        uint64    `json:"seed,string"`
+	DateCreated time.Time `json:"date_created"`
+}
@@ -0,0 +1,30 @@
+package Entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Draft targets: a reply in a topic, or a new topic, episode or character sheet
+const (
+	DraftPost      = "post"      // TargetId is the topic
+	DraftTopic     = "topic"     // TargetId is the subforum
+	DraftEpisode   = "episode"   // TargetId is the subforum
+	DraftCharacter = "character" // TargetId is 0
+)
+
+// Draft is unsent text a user is writing, one per user and target. Revision goes up with every
+// save; a save based on an older revision is a conflict with another tab. Publishing empties the
+// draft and sets Published, keeping the revision so saves still in flight conflict instead of
+// bringing it back.
+type Draft struct {
+	Id          int             `json:"id"`
+	UserId      int             `json:"user_id"`
+	TargetType  string          `json:"target_type"`
+	TargetId    int             `json:"target_id"`
+	Content     string          `json:"content"`
+	Data        json.RawMessage `json:"data"` // the rest of the form as the client keeps it: title, custom fields, attachment IDs
+	Revision    int             `json:"revision"`
+	Published   bool            `json:"published"`
+	DateUpdated time.Time       `json:"date_updated"`
+}
@@ -0,0 +1,21 @@
+package Entities
+
+import "time"
+
+type EmailMode string
+
+const (
+	EmailModeInstant EmailMode = "instant"
+	EmailModeDaily   EmailMode = "daily"
+	EmailModeOff     EmailMode = "off"
+)
+
+func (m EmailMode) IsValid() bool {
+	return m == EmailModeInstant || m == EmailModeDaily || m == EmailModeOff
+}
+
+type EmailPreferences struct {
+	UserId         int        `json:"user_id"`
+	Mode           EmailMode  `json:"mode"`
+	DateLastDigest *time.Time `json:"date_last_digest"`
+}
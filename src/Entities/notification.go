@@ -0,0 +1,17 @@
+package Entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Notification struct {
+	Id          int64           `json:"id"`
+	UserId      int             `json:"user_id"`
+	Type        string          `json:"type"`
+	Message     string          `json:"message"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	IsRead      bool            `json:"is_read"`
+	DateCreated time.Time       `json:"date_created"`
+	DateRead    *time.Time      `json:"date_read"`
+}
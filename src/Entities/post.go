@@ -10,7 +10,22 @@ type Post struct {
 	DateCreated         time.Time         `json:"date_created"`
 	Content             string            `json:"content"`
 	ContentHtml         string            `json:"content_html"`
+	ContentHtmlVersion  string            `json:"-"` // renderer version ContentHtml was stored with
+	ContentHtmlQuotes   string            `json:"-"` // hash of the quote attributions ContentHtml was stored with
 	CharacterProfile    *CharacterProfile `json:"character_profile"`
 	UserProfile         *UserProfile      `json:"user_profile"`
 	UseCharacterProfile bool              `json:"use_character_profile"`
+	Attachments         []PostAttachment  `json:"attachments"`
+	Rolls               []DiceRoll        `json:"rolls"`
+	QuotedPostIds       []int             `json:"quoted_post_ids"`
+}
+
+// PostReply is a post that quotes another one.
+type PostReply struct {
+	PostId       int       `json:"post_id"`
+	TopicId      int       `json:"topic_id"`
+	TopicName    string    `json:"topic_name"`
+	AuthorUserId int       `json:"author_user_id"`
+	AuthorName   string    `json:"author_name"` // the character for in-character posts
+	DateCreated  time.Time `json:"date_created"`
 }
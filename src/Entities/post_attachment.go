@@ -0,0 +1,25 @@
+package Entities
+
+import "time"
+
+// PostAttachment is a file uploaded for a topic. It is pending (PostId nil) while the post is
+// being written and belongs to the post once it is created. Files are kept outside the public
+// upload directory and only reachable through Url, which checks that the viewer can read the topic.
+type PostAttachment struct {
+	Id           int       `json:"id"`
+	UserId       int       `json:"user_id"`
+	TopicId      int       `json:"topic_id"`
+	PostId       *int      `json:"post_id"`
+	FileName     string    `json:"file_name"`
+	MimeType     string    `json:"mime_type"`
+	SizeBytes    int       `json:"size_bytes"`
+	Url          string    `json:"url"`
+	ThumbnailUrl *string   `json:"thumbnail_url"`
+	DateCreated  time.Time `json:"date_created"`
+}
+
+// AttachmentLimits apply per post and per file in one subforum. MaxCount 0 disables attachments.
+type AttachmentLimits struct {
+	MaxCount int `json:"max_count"`
+	MaxSize  int `json:"max_size"` // bytes
+}
@@ -0,0 +1,14 @@
+package Entities
+
+import "time"
+
+// Session is a chain of rotated refresh tokens that started with one login.
+type Session struct {
+	Id           string    `json:"id"`
+	UserAgent    string    `json:"user_agent"`
+	IpAddress    string    `json:"ip_address"`
+	DateCreated  time.Time `json:"date_created"`
+	DateLastUsed time.Time `json:"date_last_used"`
+	DateExpires  time.Time `json:"date_expires"`
+	IsCurrent    bool      `json:"is_current"`
+}
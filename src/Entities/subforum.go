@@ -14,6 +14,8 @@ type Subform struct {
 	DateLastPost       *string              `json:"date_last_post"`
 	LastPostAuthorName *string              `json:"last_post_author_name"`
 	Permissions        *SubforumPermissions `json:"permissions"`
+	Unread             bool                 `json:"unread"`
+	AttachmentLimits   *AttachmentLimits    `json:"attachment_limits"`
 }
 
 type ShortSubform struct {
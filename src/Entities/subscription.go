@@ -0,0 +1,17 @@
+package Entities
+
+import "time"
+
+type SubscriptionTarget string
+
+const (
+	TopicSubscription    SubscriptionTarget = "topic"
+	SubforumSubscription SubscriptionTarget = "subforum"
+)
+
+type Subscription struct {
+	TargetType  SubscriptionTarget `json:"target_type"`
+	TargetId    int                `json:"target_id"`
+	TargetName  string             `json:"target_name"`
+	DateCreated time.Time          `json:"date_created"`
+}
@@ -15,6 +15,7 @@ type TopicStatus int
 const (
 	ActiveTopic   TopicStatus = 0
 	InactiveTopic TopicStatus = 1
+	OnHoldTopic   TopicStatus = 2
 )
 
 type Topic struct {
@@ -0,0 +1,30 @@
+package Entities
+
+import "time"
+
+type UploadKind string
+
+const (
+	AvatarUpload UploadKind = "avatar"
+	ImageUpload  UploadKind = "image"
+)
+
+func (k UploadKind) IsValid() bool {
+	return k == AvatarUpload || k == ImageUpload
+}
+
+// Upload is a stored image. Url is the address entities should reference: the largest avatar
+// size for avatars, the original for images.
+type Upload struct {
+	Id           int               `json:"id"`
+	UserId       int               `json:"user_id"`
+	Kind         UploadKind        `json:"kind"`
+	OriginalName string            `json:"original_name"`
+	MimeType     string            `json:"mime_type"`
+	SizeBytes    int               `json:"size_bytes"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	Url          string            `json:"url"`
+	Variants     map[string]string `json:"variants"` // variant name -> URL
+	DateCreated  time.Time         `json:"date_created"`
+}
@@ -1,6 +1,8 @@
 package Entities
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -24,8 +26,37 @@ type UserProfile struct {
 	Avatar   string `json:"avatar"`
 }
 
-func (u *User) HashPassword(password string) error {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// PublicUser is what anyone can see on a user's profile page.
+type PublicUser struct {
+	Id             int                `json:"id"`
+	Username       string             `json:"username"`
+	Avatar         *string            `json:"avatar"`
+	DateRegistered *time.Time         `json:"date_registered"`
+	DateLastVisit  *time.Time         `json:"date_last_visit"`
+	PostCount      int                `json:"post_count"`
+	Roles          []Role             `json:"roles"`
+	Characters     []ShortCharacter   `json:"characters"`
+	CustomFields   *CustomFieldEntity `json:"custom_fields,omitempty"`
+}
+
+// UserEntity is a user as loaded by the custom field engine. Only the public
+// columns of users are exposed here, credentials never go through it.
+type UserEntity struct {
+	Id             int               `json:"id"`
+	Username       string            `json:"username"`
+	Avatar         *string           `json:"avatar"`
+	DateRegistered *string           `json:"date_registered"`
+	CustomFields   CustomFieldEntity `json:"custom_fields" db:"-"`
+}
+
+type UserSettings struct {
+	Avatar            *string `json:"avatar"`
+	InterfaceLanguage *string `json:"interface_language"`
+	InterfaceTimezone *string `json:"interface_timezone"`
+}
+
+func (u *User) HashPassword(password string, cost int) error {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,50 @@
+package Entities
+
+import "time"
+
+type WantedCharacter struct {
+	Id             int               `json:"id"`
+	AuthorUserId   int               `json:"author_user_id"`
+	Name           string            `json:"name"`
+	Avatar         *string           `json:"avatar"`
+	WantedStatus   WantedStatus      `json:"wanted_status"`
+	DateCreated    *string           `json:"date_created"`
+	CustomFields   CustomFieldEntity `json:"custom_fields" db:"-"`
+	Factions       []Faction         `json:"factions" db:"-"`
+	AuthorUsername string            `json:"author_username" db:"-"`
+}
+
+func (w *WantedCharacter) GetBaseFields() []string {
+	return []string{"author_user_id", "name", "avatar", "wanted_status"}
+}
+
+type WantedStatus int
+
+const (
+	OpenWanted    WantedStatus = 0
+	ClaimedWanted WantedStatus = 1
+	ClosedWanted  WantedStatus = 2
+)
+
+type WantedClaimStatus int
+
+const (
+	PendingClaim  WantedClaimStatus = 0
+	AcceptedClaim WantedClaimStatus = 1
+	DeclinedClaim WantedClaimStatus = 2
+)
+
+type WantedClaim struct {
+	Id                int                         `json:"id"`
+	WantedCharacterId int                         `json:"wanted_character_id"`
+	UserId            int                         `json:"user_id"`
+	Username          string                      `json:"username"`
+	SubforumId        int                         `json:"subforum_id"`
+	Avatar            *string                     `json:"avatar"`
+	Message           *string                     `json:"message"`
+	CustomFields      map[string]CustomFieldValue `json:"custom_fields"`
+	Status            WantedClaimStatus           `json:"status"`
+	CharacterId       *int                        `json:"character_id"`
+	DateCreated       time.Time                   `json:"date_created"`
+	DateResolved      *time.Time                  `json:"date_resolved"`
+}
@@ -13,6 +13,9 @@ const (
 	PostCreated         EventType = "PostCreated"
 	NotificationCreated EventType = "NotificationCreated"
 	UserReadingTopic    EventType = "UserReadingTopic"
+	MessageCreated      EventType = "MessageCreated"
+	ConversationRead    EventType = "ConversationRead"
+	DraftChanged        EventType = "DraftChanged"
 )
 
 type EventData interface{}
@@ -25,6 +28,8 @@ type TopicCreatedEvent struct {
 	PostID     int64
 	UserID     int
 	Username   string
+	// Posts the opening post quotes, as recorded in post_quotes
+	QuotedPostIDs []int
 }
 
 type PostCreatedEvent struct {
@@ -35,6 +40,7 @@ type PostCreatedEvent struct {
 }
 
 type NotificationEvent struct {
+	Id      int64       `json:"id,omitempty"` // Set once the notification is stored in the inbox
 	UserID  int         `json:"user_id"`
 	Type    string      `json:"type"` // e.g., "info", "success", "error"
 	Message string      `json:"message"`
@@ -45,6 +51,31 @@ type UserReadingTopicEvent struct {
 	TopicID string `json:"topic_id"`
 }
 
+type MessageCreatedEvent struct {
+	Type      string                  `json:"type"`
+	Message   Entities.PrivateMessage `json:"message"`
+	Receivers []int                   `json:"-"`
+}
+
+type ConversationReadEvent struct {
+	Type              string `json:"type"`
+	ConversationID    int    `json:"conversation_id"`
+	UserID            int    `json:"user_id"`
+	LastReadMessageID int    `json:"last_read_message_id"`
+	Receivers         []int  `json:"-"`
+}
+
+// DraftChangedEvent tells a user's other tabs that a draft was saved or discarded. TabId is the
+// tab that made the change, so it can ignore its own echo.
+type DraftChangedEvent struct {
+	Type       string          `json:"type"` // "draft_saved" or "draft_deleted"
+	TabId      string          `json:"tab_id,omitempty"`
+	UserID     int             `json:"-"`
+	TargetType string          `json:"target_type"`
+	TargetId   int             `json:"target_id"`
+	Draft      *Entities.Draft `json:"draft,omitempty"`
+}
+
 type EventHandler func(db *sql.DB, data EventData)
 
 var (
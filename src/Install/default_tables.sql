@@ -10,6 +10,9 @@ create table users
     date_last_visit    datetime     null,
     interface_language varchar(50)  null,
     interface_timezone varchar(50)  null,
+    email_verified     tinyint(1)   default 0 not null,
+    pending_email      varchar(255) null,
+    date_marked_read   datetime     null,
     constraint users_pk_2
         unique (username),
     constraint users_pk_3
@@ -61,6 +64,8 @@ CREATE TABLE subforums (
     position INT NULL,
     topic_number INT NULL,
     post_number INT NULL,
+    attachment_max_count INT NULL,
+    attachment_max_size INT NULL,
     last_post_topic_id bigint unsigned null;
     last_post_topic_name varchar(255) null;
     last_post_id bigint unsigned null;
@@ -131,6 +136,9 @@ CREATE TABLE posts (
                        author_user_id INT NOT NULL,
                        date_created DATETIME DEFAULT CURRENT_TIMESTAMP,
                        content TEXT NOT NULL,
+                       content_html MEDIUMTEXT NULL,
+                       content_html_version VARCHAR(32) NULL,
+                       content_html_quotes CHAR(64) NULL COMMENT 'hash of the quote attributions content_html was rendered with',
                        character_profile_id BIGINT UNSIGNED,
                        use_character_profile BOOLEAN DEFAULT FALSE,
                        CONSTRAINT fk_posts_topic
@@ -221,4 +229,462 @@ create table role_permission
         primary key (role_id, permission),
     constraint role_permission_roles_id_fk
         foreign key (role_id) references roles (id)
-);
\ No newline at end of file
+);
+
+create table inactivity_warnings
+(
+    entity_type varchar(50)     not null,
+    entity_id   bigint unsigned not null,
+    date_warned datetime        not null,
+    constraint inactivity_warnings_pk
+        primary key (entity_type, entity_id)
+);
+
+create table status_change_log
+(
+    id           bigint unsigned auto_increment primary key,
+    entity_type  varchar(50)     not null,
+    entity_id    bigint unsigned not null,
+    old_status   int             not null,
+    new_status   int             not null,
+    reason       varchar(255)    null,
+    date_created datetime default CURRENT_TIMESTAMP
+);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('inactivity_enabled', 'false'),
+       ('inactivity_check_interval_minutes', '60'),
+       ('inactivity_character_warning_days', '21'),
+       ('inactivity_character_inactive_days', '30'),
+       ('inactivity_episode_warning_days', '45'),
+       ('inactivity_episode_on_hold_days', '60');
+
+
+create table character_transfers
+(
+    id                   bigint unsigned auto_increment primary key,
+    character_id         bigint unsigned not null,
+    from_user_id         int             null,
+    to_user_id           int             not null,
+    initiated_by_user_id int             not null,
+    is_reassignment      boolean default FALSE not null,
+    status               int default 0   not null,
+    date_created         datetime default CURRENT_TIMESTAMP,
+    date_resolved        datetime        null,
+    constraint character_transfers_character_base_id_fk
+        foreign key (character_id) references character_base (id) ON DELETE CASCADE,
+    constraint character_transfers_to_user_id_fk
+        foreign key (to_user_id) references users (id),
+    constraint character_transfers_initiated_by_user_id_fk
+        foreign key (initiated_by_user_id) references users (id)
+);
+
+create table wanted_character_base
+(
+    id             bigint unsigned auto_increment primary key,
+    author_user_id int          not null,
+    name           varchar(255) not null,
+    avatar         varchar(255) null,
+    wanted_status  int default 0 not null,
+    date_created   datetime default CURRENT_TIMESTAMP,
+    constraint wanted_character_base_users_id_fk
+        foreign key (author_user_id) references users (id)
+);
+
+create table wanted_character_main
+(
+    entity_id          int            null,
+    field_machine_name varchar(255)   null,
+    field_type         varchar(10)    null,
+    value_int          int            null,
+    value_decimal      decimal(10, 2) null,
+    value_string       varchar(255)   null,
+    value_text         text           null,
+    value_date         datetime       null
+);
+
+create table wanted_character_flattened
+(
+    entity_id int primary key
+);
+
+INSERT INTO custom_field_config (entity_type, config) VALUES ('wanted_character', '[]')
+
+create table wanted_character_faction
+(
+    wanted_character_id bigint unsigned not null,
+    faction_id          int             not null,
+    constraint wanted_character_faction_pk
+        primary key (wanted_character_id, faction_id),
+    constraint wanted_character_faction_wanted_id_fk
+        foreign key (wanted_character_id) references wanted_character_base (id) ON DELETE CASCADE,
+    constraint wanted_character_faction_factions_id_fk
+        foreign key (faction_id) references factions (id)
+);
+
+create table wanted_character_claims
+(
+    id                  bigint unsigned auto_increment primary key,
+    wanted_character_id bigint unsigned not null,
+    user_id             int             not null,
+    subforum_id         bigint unsigned not null,
+    avatar              varchar(255)    null,
+    message             text            null,
+    custom_fields       json            null,
+    status              int default 0   not null,
+    character_id        bigint unsigned null,
+    date_created        datetime default CURRENT_TIMESTAMP,
+    date_resolved       datetime        null,
+    constraint wanted_character_claims_wanted_id_fk
+        foreign key (wanted_character_id) references wanted_character_base (id) ON DELETE CASCADE,
+    constraint wanted_character_claims_users_id_fk
+        foreign key (user_id) references users (id),
+    constraint wanted_character_claims_character_id_fk
+        foreign key (character_id) references character_base (id) ON DELETE SET NULL
+);
+
+create table notifications
+(
+    id           bigint unsigned auto_increment primary key,
+    user_id      int          not null,
+    type         varchar(50)  not null,
+    message      varchar(512) not null,
+    data         json         null,
+    is_read      boolean default FALSE not null,
+    date_created datetime default CURRENT_TIMESTAMP,
+    date_read    datetime     null,
+    date_emailed datetime     null,
+    constraint notifications_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_is_read_index
+    ON notifications (user_id, is_read);
+
+create table subscriptions
+(
+    user_id      int             not null,
+    target_type  varchar(20)     not null,
+    target_id    bigint unsigned not null,
+    date_created datetime default CURRENT_TIMESTAMP,
+    constraint subscriptions_pk
+        primary key (user_id, target_type, target_id),
+    constraint subscriptions_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX subscriptions_target_index
+    ON subscriptions (target_type, target_id);
+
+create table topic_read_markers
+(
+    user_id           int             not null,
+    topic_id          bigint unsigned not null,
+    last_read_post_id bigint unsigned not null,
+    date_read         datetime        not null,
+    constraint topic_read_markers_pk
+        primary key (user_id, topic_id),
+    constraint topic_read_markers_topics_id_fk
+        foreign key (topic_id) references topics (id) ON DELETE CASCADE
+);
+
+create table subforum_read_markers
+(
+    user_id     int             not null,
+    subforum_id bigint unsigned not null,
+    date_read   datetime        not null,
+    constraint subforum_read_markers_pk
+        primary key (user_id, subforum_id)
+);
+
+CREATE INDEX topics_date_last_post_index
+    ON topics (date_last_post);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('unread_window_days', '30');
+
+create table conversations
+(
+    id                 int auto_increment
+        primary key,
+    title              varchar(255) not null,
+    created_by_user_id int          not null,
+    date_created       datetime     not null,
+    date_last_message  datetime     null,
+    constraint conversations_users_id_fk
+        foreign key (created_by_user_id) references users (id)
+);
+
+create table conversation_participants
+(
+    conversation_id      int                  not null,
+    user_id              int                  not null,
+    last_read_message_id int        default 0 not null,
+    date_last_read       datetime             null,
+    is_muted             tinyint(1) default 0 not null,
+    has_left             tinyint(1) default 0 not null,
+    date_joined          datetime             not null,
+    constraint conversation_participants_pk
+        primary key (conversation_id, user_id),
+    constraint conversation_participants_conversations_id_fk
+        foreign key (conversation_id) references conversations (id) ON DELETE CASCADE,
+    constraint conversation_participants_users_id_fk
+        foreign key (user_id) references users (id)
+);
+
+CREATE INDEX conversation_participants_user_index
+    ON conversation_participants (user_id, has_left);
+
+create table messages
+(
+    id                   int auto_increment
+        primary key,
+    conversation_id      int             not null,
+    author_user_id       int             not null,
+    character_profile_id bigint unsigned null,
+    content              text            not null,
+    date_created         datetime        not null,
+    constraint messages_conversations_id_fk
+        foreign key (conversation_id) references conversations (id) ON DELETE CASCADE,
+    constraint messages_users_id_fk
+        foreign key (author_user_id) references users (id),
+    constraint messages_character_profile_base_id_fk
+        foreign key (character_profile_id) references character_profile_base (id) ON DELETE SET NULL
+);
+
+CREATE INDEX messages_conversation_index
+    ON messages (conversation_id, id);
+
+create table user_email_preferences
+(
+    user_id          int                           not null
+        primary key,
+    email_mode       varchar(20) default 'daily'   not null,
+    date_last_digest datetime                      null,
+    constraint user_email_preferences_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('email_digest_interval_minutes', '60');
+
+create table user_tokens
+(
+    id           int auto_increment
+        primary key,
+    user_id      int         not null,
+    purpose      varchar(30) not null,
+    token_hash   char(64)    not null,
+    bound_hash   char(64)    null comment 'hash of the value the token is only good for, e.g. the new email',
+    failures     int         default 0 not null comment 'wrong codes entered with the token, for 2fa challenges',
+    date_created datetime    not null,
+    date_expires datetime    not null,
+    date_used    datetime    null,
+    constraint user_tokens_token_hash_uindex
+        unique (token_hash),
+    constraint user_tokens_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('require_email_verification_to_post', 'false');
+
+create table refresh_tokens
+(
+    id                   bigint unsigned auto_increment
+        primary key,
+    user_id              int          not null,
+    session_id           char(32)     not null,
+    token_hash           char(64)     not null,
+    user_agent           varchar(512) null,
+    ip_address           varchar(64)  null,
+    date_session_started datetime     not null,
+    date_created         datetime     not null,
+    date_expires         datetime     not null,
+    date_used            datetime     null,
+    date_revoked         datetime     null,
+    constraint refresh_tokens_token_hash_uindex
+        unique (token_hash),
+    constraint refresh_tokens_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX refresh_tokens_user_session_index
+    ON refresh_tokens (user_id, session_id);
+
+create table user_totp
+(
+    user_id        int                  not null
+        primary key,
+    secret         varchar(64)          not null,
+    date_created   datetime             not null,
+    date_confirmed datetime             null,
+    last_used_step bigint     default 0 not null,
+    constraint user_totp_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+create table user_recovery_codes
+(
+    id        int auto_increment
+        primary key,
+    user_id   int      not null,
+    code_hash char(64) not null,
+    date_used datetime null,
+    constraint user_recovery_codes_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX user_recovery_codes_user_index
+    ON user_recovery_codes (user_id, code_hash);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('require_staff_2fa', 'false');
+
+create table user_main
+(
+    entity_id          int            null,
+    field_machine_name varchar(255)   null,
+    field_type         varchar(10)    null,
+    value_int          int            null,
+    value_decimal      decimal(10, 2) null,
+    value_string       varchar(255)   null,
+    value_text         text           null,
+    value_date         datetime       null
+);
+
+create table user_flattened
+(
+    entity_id int primary key
+);
+
+INSERT INTO custom_field_config (entity_type, config) VALUES ('user', '[]')
+
+create table uploads
+(
+    id            int auto_increment
+        primary key,
+    user_id       int          not null,
+    kind          varchar(16)  not null,
+    original_name varchar(255) not null,
+    mime_type     varchar(64)  not null,
+    size_bytes    int          not null,
+    content_hash  char(64)     not null comment 'sha256 of the uploaded file, which its storage keys are made from',
+    width         int          not null,
+    height        int          not null,
+    variants      json         not null,
+    date_created  datetime     not null,
+    constraint uploads_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX uploads_user_id_kind_index
+    ON uploads (user_id, kind);
+
+CREATE INDEX uploads_content_hash_index
+    ON uploads (content_hash);
+
+create table post_attachments
+(
+    id            int auto_increment
+        primary key,
+    user_id       int             not null,
+    topic_id      bigint unsigned not null,
+    post_id       bigint unsigned null,
+    file_name     varchar(255)    not null,
+    mime_type     varchar(64)     not null,
+    size_bytes    int             not null,
+    storage_key   varchar(255)    not null,
+    thumbnail_key varchar(255)    null,
+    date_created  datetime        not null,
+    constraint post_attachments_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE,
+    constraint post_attachments_topics_id_fk
+        foreign key (topic_id) references topics (id) ON DELETE CASCADE,
+    constraint post_attachments_posts_id_fk
+        foreign key (post_id) references posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_attachments_post_id_index
+    ON post_attachments (post_id);
+
+CREATE INDEX post_attachments_pending_index
+    ON post_attachments (user_id, topic_id, post_id);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('attachment_max_count', '5'),
+       ('attachment_orphan_hours', '24'),
+       ('attachment_pending_quota', '52428800')
+
+create table bbcode_config
+(
+    id     int  not null
+        primary key,
+    config json not null
+);
+
+INSERT INTO bbcode_config (id, config) VALUES (1, '{"disabled": [], "custom_tags": []}')
+
+create table custom_field_html
+(
+    entity_type        varchar(64)  not null,
+    entity_id          int          not null,
+    field_machine_name varchar(255) not null,
+    source_hash        char(64)     not null,
+    render_version     varchar(32)  not null,
+    html               mediumtext   not null,
+    primary key (entity_type, entity_id, field_machine_name)
+);
+
+create table post_dice_rolls
+(
+    id           int auto_increment
+        primary key,
+    post_id      bigint unsigned not null,
+    notation     varchar(32)     not null,
+    results      json            not null,
+    modifier     int             not null,
+    total        int             not null,
+    seed         bigint unsigned not null,
+    date_created datetime        not null,
+    constraint post_dice_rolls_posts_id_fk
+        foreign key (post_id) references posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_dice_rolls_post_id_index
+    ON post_dice_rolls (post_id);
+
+create table post_quotes
+(
+    post_id        bigint unsigned not null,
+    quoted_post_id bigint unsigned not null,
+    primary key (post_id, quoted_post_id),
+    constraint post_quotes_posts_id_fk
+        foreign key (post_id) references posts (id) ON DELETE CASCADE,
+    constraint post_quotes_quoted_posts_id_fk
+        foreign key (quoted_post_id) references posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_quotes_quoted_post_id_index
+    ON post_quotes (quoted_post_id);
+
+create table drafts
+(
+    id           int auto_increment
+        primary key,
+    user_id      int         not null,
+    target_type  varchar(16) not null,
+    target_id    int         not null,
+    content      mediumtext  not null,
+    data         json        not null,
+    revision     int         not null,
+    published    tinyint(1)  not null default 0,
+    date_updated datetime    not null,
+    constraint drafts_users_id_fk
+        foreign key (user_id) references users (id) ON DELETE CASCADE,
+    constraint drafts_user_target_uindex
+        unique (user_id, target_type, target_id)
+);
+
+INSERT INTO global_settings (setting_name, setting_value)
+VALUES ('draft_expiry_days', '30')
@@ -0,0 +1,26 @@
+package Mail
+
+// Mailer renders templates and hands them to the configured transport.
+type Mailer struct {
+	Transport Transport
+	BaseURL   string
+}
+
+func NewMailer(transport Transport, baseURL string) *Mailer {
+	return &Mailer{Transport: transport, BaseURL: baseURL}
+}
+
+// Send renders the named template for the recipient's language and delivers it.
+// BaseURL is added to the template data automatically.
+func (m *Mailer) Send(to string, language string, name string, data map[string]interface{}) error {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["BaseURL"] = m.BaseURL
+
+	message, err := Render(name, language, to, data)
+	if err != nil {
+		return err
+	}
+	return m.Transport.Send(message)
+}
@@ -0,0 +1,171 @@
+package Mail
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const DefaultLanguage = "en"
+
+type mailTemplate struct {
+	Subject string
+	Body    string
+}
+
+// Templates are keyed by language and then by template name.
+// Missing languages or templates fall back to DefaultLanguage.
+var templates = map[string]map[string]mailTemplate{
+	"en": {
+		"notification": {
+			Subject: "New notification",
+			Body: `Hello, {{.Username}}!
+
+{{.Message}}
+
+Open the board: {{.BaseURL}}
+
+You can change how often you receive these emails in your settings.`,
+		},
+		"digest": {
+			Subject: "You have {{len .Notifications}} unread notifications",
+			Body: `Hello, {{.Username}}!
+
+Here is what happened while you were away:
+{{range .Notifications}}
+- {{.Message}} ({{.DateCreated.Format "2006-01-02 15:04"}})
+{{- end}}
+
+Open the board: {{.BaseURL}}
+
+You can change how often you receive these emails in your settings.`,
+		},
+		"email_verification": {
+			Subject: "Confirm your email address",
+			Body: `Hello, {{.Username}}!
+
+Please confirm your email address by opening this link:
+{{.BaseURL}}/verify-email?token={{.Token}}
+
+If you didn't register on the board, just ignore this email.`,
+		},
+		"email_change": {
+			Subject: "Confirm your new email address",
+			Body: `Hello, {{.Username}}!
+
+You asked to use this address for your account. Confirm it by opening this link:
+{{.BaseURL}}/confirm-email-change?token={{.Token}}
+
+Until then your old address stays in use. If you didn't ask for this, just ignore this email.`,
+		},
+		"password_reset": {
+			Subject: "Password reset",
+			Body: `Hello, {{.Username}}!
+
+Someone asked to reset the password of your account. To choose a new password open this link within an hour:
+{{.BaseURL}}/reset-password?token={{.Token}}
+
+If it wasn't you, just ignore this email. Your password stays the same.`,
+		},
+	},
+	"es": {
+		"notification": {
+			Subject: "Nueva notificación",
+			Body: `¡Hola, {{.Username}}!
+
+{{.Message}}
+
+Abre el foro: {{.BaseURL}}
+
+Puedes cambiar la frecuencia de estos correos en tu configuración.`,
+		},
+		"digest": {
+			Subject: "Tienes {{len .Notifications}} notificaciones sin leer",
+			Body: `¡Hola, {{.Username}}!
+
+Esto es lo que ocurrió mientras no estabas:
+{{range .Notifications}}
+- {{.Message}} ({{.DateCreated.Format "2006-01-02 15:04"}})
+{{- end}}
+
+Abre el foro: {{.BaseURL}}
+
+Puedes cambiar la frecuencia de estos correos en tu configuración.`,
+		},
+		"email_verification": {
+			Subject: "Confirma tu dirección de correo",
+			Body: `¡Hola, {{.Username}}!
+
+Confirma tu dirección de correo abriendo este enlace:
+{{.BaseURL}}/verify-email?token={{.Token}}
+
+Si no te registraste en el foro, ignora este correo.`,
+		},
+		"email_change": {
+			Subject: "Confirma tu nueva dirección de correo",
+			Body: `¡Hola, {{.Username}}!
+
+Pediste usar esta dirección para tu cuenta. Confírmala abriendo este enlace:
+{{.BaseURL}}/confirm-email-change?token={{.Token}}
+
+Hasta entonces se seguirá usando tu dirección anterior. Si no lo pediste, ignora este correo.`,
+		},
+		"password_reset": {
+			Subject: "Restablecer contraseña",
+			Body: `¡Hola, {{.Username}}!
+
+Alguien pidió restablecer la contraseña de tu cuenta. Para elegir una nueva abre este enlace en la próxima hora:
+{{.BaseURL}}/reset-password?token={{.Token}}
+
+Si no fuiste tú, ignora este correo. Tu contraseña no cambiará.`,
+		},
+	},
+}
+
+// normalizeLanguage turns values like "es-ES" or "ES_es" into "es".
+func normalizeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	return language
+}
+
+func findTemplate(name string, language string) (mailTemplate, bool) {
+	if localized, ok := templates[normalizeLanguage(language)]; ok {
+		if tmpl, ok := localized[name]; ok {
+			return tmpl, true
+		}
+	}
+	tmpl, ok := templates[DefaultLanguage][name]
+	return tmpl, ok
+}
+
+func execute(text string, data interface{}) (string, error) {
+	tmpl, err := template.New("mail").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Render builds a message from the named template in the requested language.
+func Render(name string, language string, to string, data interface{}) (Message, error) {
+	tmpl, ok := findTemplate(name, language)
+	if !ok {
+		return Message{}, fmt.Errorf("unknown mail template %q", name)
+	}
+	subject, err := execute(tmpl.Subject, data)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to render subject of %q: %w", name, err)
+	}
+	body, err := execute(tmpl.Body, data)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to render body of %q: %w", name, err)
+	}
+	return Message{To: to, Subject: subject, Body: body}, nil
+}
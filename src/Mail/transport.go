@@ -0,0 +1,122 @@
+package Mail
+
+import (
+	"cuento-backend/config"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Transport delivers rendered messages. Implementations must be safe for concurrent use.
+type Transport interface {
+	Send(message Message) error
+}
+
+// NewTransport builds the transport selected in the mail config.
+func NewTransport(cfg *config.MailConfig) (Transport, error) {
+	switch cfg.Transport {
+	case "smtp":
+		return &SMTPTransport{Addr: cfg.SMTPAddr(), Host: cfg.SMTPHost, User: cfg.SMTPUser, Password: cfg.SMTPPassword, From: cfg.From}, nil
+	case "file":
+		return &FileTransport{Dir: cfg.FileDir, From: cfg.From}, nil
+	case "memory":
+		return &MemoryTransport{}, nil
+	case "none", "":
+		return NoopTransport{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+	}
+}
+
+// formatMessage encodes the subject as an RFC 2047 word and the body as quoted-printable,
+// so translated templates reach servers that only accept ASCII.
+func formatMessage(from string, message Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + message.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	b.WriteString("\r\n")
+	// Line breaks become CRLF in the writer
+	body := quotedprintable.NewWriter(&b)
+	_, _ = body.Write([]byte(message.Body))
+	_ = body.Close()
+	return []byte(b.String())
+}
+
+type SMTPTransport struct {
+	Addr     string
+	Host     string
+	User     string
+	Password string
+	From     string
+}
+
+func (t *SMTPTransport) Send(message Message) error {
+	var auth smtp.Auth
+	if t.User != "" {
+		auth = smtp.PlainAuth("", t.User, t.Password, t.Host)
+	}
+	return smtp.SendMail(t.Addr, auth, t.From, []string{message.To}, formatMessage(t.From, message))
+}
+
+// FileTransport writes every message as an .eml file, useful for local development.
+type FileTransport struct {
+	Dir  string
+	From string
+	mu   sync.Mutex
+	seq  int
+}
+
+func (t *FileTransport) Send(message Message) error {
+	t.mu.Lock()
+	t.seq++
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), t.seq)
+	t.mu.Unlock()
+
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.Dir, name), formatMessage(t.From, message), 0644)
+}
+
+// MemoryTransport keeps sent messages in memory so they can be inspected.
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (t *MemoryTransport) Send(message Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, message)
+	return nil
+}
+
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Message(nil), t.messages...)
+}
+
+// NoopTransport drops every message. It is used when mail is not configured.
+type NoopTransport struct{}
+
+func (NoopTransport) Send(message Message) error {
+	return nil
+}
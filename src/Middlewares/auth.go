@@ -1,6 +1,9 @@
 package Middlewares
 
 import (
+	"cuento-backend/src/Services"
+	"database/sql"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -8,7 +11,8 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts access tokens of sessions that weren't ended, see Services.IsSessionActive.
+func AuthMiddleware(keys *KeySet, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -24,13 +28,9 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
-		})
-
+		claims, err := keys.Parse(tokenString)
 		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
+			if errors.Is(err, jwt.ErrSignatureInvalid) || errors.Is(err, jwt.ErrTokenSignatureInvalid) {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token signature"})
 				c.Abort()
 				return
@@ -40,14 +40,27 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if !token.Valid {
+		if claims.TokenType != AccessTokenType {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		active, err := Services.IsSessionActive(claims.UserID, claims.SessionID, db)
+		if err != nil {
+			_ = c.Error(&AppError{Code: http.StatusInternalServerError, Message: "Failed to check session"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended"})
+			c.Abort()
+			return
+		}
+
 		c.Set("username", claims.Username)
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
@@ -16,6 +16,11 @@ func (e *AppError) Error() string {
 	return e.Message
 }
 
+// StatusCode lets middlewares outside this package read the status before ErrorMiddleware writes it.
+func (e *AppError) StatusCode() int {
+	return e.Code
+}
+
 // ErrorMiddleware catches errors added to the context and sends a JSON response.
 func ErrorMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -1,14 +1,180 @@
 package Middlewares
 
-import "github.com/golang-jwt/jwt/v5"
+import (
+	"crypto"
+	"cuento-backend/config"
+	"errors"
+	"fmt"
+	"os"
 
-// JwtKey is the secret key for signing JWT tokens.
-// TODO: Load this from an environment variable in a real application.
-var JwtKey = []byte("your_secret_key")
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types carried in the token_type claim. Only access tokens are accepted by the auth middlewares,
+// refresh tokens are only good for POST /refresh.
+const (
+	AccessTokenType  = "access"
+	RefreshTokenType = "refresh"
+)
+
+var ErrUnknownKeyID = errors.New("token was signed with an unknown key")
 
 // Claims defines the structure of the JWT claims.
 type Claims struct {
-	Username string `json:"username"`
-	UserID   int    `json:"user_id"`
+	Username  string `json:"username"`
+	UserID    int    `json:"user_id"`
+	TokenType string `json:"token_type"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
+
+type jwtKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet signs tokens with the current key and verifies them with any key it knows,
+// picked by the kid header. Each key is pinned to its algorithm.
+type KeySet struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+	methods []string
+	issuer  string
+}
+
+// NewKeySet loads the keys described in the auth config, reading PEM files for asymmetric keys.
+func NewKeySet(cfg *config.AuthConfig) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*jwtKey{}, issuer: cfg.Issuer}
+	methods := map[string]bool{}
+
+	for _, keyConfig := range cfg.Keys {
+		key, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT key %q: %w", keyConfig.ID, err)
+		}
+		ks.keys[key.id] = key
+		if !methods[key.method.Alg()] {
+			methods[key.method.Alg()] = true
+			ks.methods = append(ks.methods, key.method.Alg())
+		}
+	}
+
+	ks.signing = ks.keys[cfg.SigningKeyID]
+	if ks.signing == nil || ks.signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q is missing or has no private key", cfg.SigningKeyID)
+	}
+	return ks, nil
+}
+
+func loadKey(cfg config.JWTKeyConfig) (*jwtKey, error) {
+	key := &jwtKey{id: cfg.ID}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		key.method = jwt.SigningMethodHS256
+		key.signKey = []byte(cfg.Secret)
+		key.verifyKey = []byte(cfg.Secret)
+		return key, nil
+	case "EdDSA":
+		key.method = jwt.SigningMethodEdDSA
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	if cfg.PrivateKeyFile != "" {
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var private crypto.Signer
+		if cfg.Algorithm == "EdDSA" {
+			k, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			private = k.(crypto.Signer)
+		} else {
+			k, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			private = k
+		}
+		key.signKey = private
+		key.verifyKey = private.Public()
+	}
+
+	if cfg.PublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Algorithm == "EdDSA" {
+			key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(pem)
+		} else {
+			key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Sign issues a token with the current signing key and records its ID in the kid header.
+func (ks *KeySet) Sign(claims *Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse verifies the token with the key named in its kid header. The algorithm must match the one
+// configured for that key and the issuer must be ours. Tokens without a kid predate key IDs and are
+// tried against every key of their algorithm, the signing key first, so they keep working while
+// the key that signed them is still in the set.
+func (ks *KeySet) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			return ks.keysFor(token.Method.Alg())
+		}
+		key := ks.keys[kid]
+		if key == nil {
+			return nil, ErrUnknownKeyID
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), key.id)
+		}
+		return key.verifyKey, nil
+	},
+		jwt.WithValidMethods(ks.methods),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// keysFor lists the verification keys for an algorithm, the signing key first.
+func (ks *KeySet) keysFor(alg string) (jwt.VerificationKeySet, error) {
+	var set jwt.VerificationKeySet
+	if ks.signing.method.Alg() == alg {
+		set.Keys = append(set.Keys, ks.signing.verifyKey)
+	}
+	for _, key := range ks.keys {
+		if key != ks.signing && key.method.Alg() == alg && key.verifyKey != nil {
+			set.Keys = append(set.Keys, key.verifyKey)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return set, fmt.Errorf("no key for signing method %s", alg)
+	}
+	return set, nil
+}
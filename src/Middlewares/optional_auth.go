@@ -1,13 +1,14 @@
 package Middlewares
 
 import (
+	"cuento-backend/src/Services"
+	"database/sql"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func OptionalAuthMiddleware() gin.HandlerFunc {
+func OptionalAuthMiddleware(keys *KeySet, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -22,19 +23,21 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := keys.Parse(tokenString)
+		if err != nil || claims.TokenType != AccessTokenType {
 			// Token invalid, treat as unauthenticated
 			c.Next()
 			return
 		}
+		if active, err := Services.IsSessionActive(claims.UserID, claims.SessionID, db); err != nil || !active {
+			// Session ended, treat as unauthenticated
+			c.Next()
+			return
+		}
 
 		c.Set("username", claims.Username)
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"cuento-backend/src/Services"
 	"database/sql"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -47,6 +48,21 @@ func PermissionsMiddleware(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Staff who must use 2FA can only reach the endpoints needed to set it up until they do
+		if !strings.HasPrefix(endpointPath, "/user/2fa/") && !strings.HasPrefix(endpointPath, "/logout") {
+			pending, err := Services.TwoFactorSetupPending(userID, db)
+			if err != nil {
+				_ = c.Error(&AppError{Code: http.StatusInternalServerError, Message: "Failed to check two-factor requirement"})
+				c.Abort()
+				return
+			}
+			if pending {
+				_ = c.Error(&AppError{Code: http.StatusForbidden, Message: "Your role requires two-factor authentication, set it up at /user/2fa/enrol first"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Next()
 	}
 }
@@ -54,6 +70,7 @@ func PermissionsMiddleware(db *sql.DB) gin.HandlerFunc {
 type PermissionType int
 
 const (
-	EndpointPermission PermissionType = 0
-	SubforumPermission PermissionType = 1
+	EndpointPermission   PermissionType = 0
+	SubforumPermission   PermissionType = 1
+	ModerationPermission PermissionType = 2
 )
@@ -1,15 +1,16 @@
 package Middlewares
 
 import (
+	"cuento-backend/src/Services"
+	"database/sql"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // WebSocketAuthMiddleware extracts the JWT from the "token" query parameter for WebSocket connections.
-func WebSocketAuthMiddleware() gin.HandlerFunc {
+func WebSocketAuthMiddleware(keys *KeySet, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.Query("token")
 		if tokenString == "" {
@@ -19,16 +20,17 @@ func WebSocketAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := keys.Parse(tokenString)
+		if err != nil || claims.TokenType != AccessTokenType {
 			fmt.Printf("WebSocket Auth Failed: %v\n", err)
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
+		if active, err := Services.IsSessionActive(claims.UserID, claims.SessionID, db); err != nil || !active {
+			fmt.Printf("WebSocket Auth Failed: session ended (%v)\n", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
 
 		c.Set("user_id", claims.UserID)
 		c.Next()
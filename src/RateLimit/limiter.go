@@ -0,0 +1,100 @@
+package RateLimit
+
+import (
+	"cuento-backend/config"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Scope string
+
+const (
+	ScopeIP      Scope = "ip"
+	ScopeAccount Scope = "account"
+)
+
+// Rule is a token bucket of Requests tokens refilled evenly over Per.
+type Rule struct {
+	Name     string
+	Scope    Scope
+	Requests int
+	Per      time.Duration
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s: %d per %s per %s", r.Name, r.Requests, r.Per, r.Scope)
+}
+
+func PerIP(name string, rate config.RateConfig) Rule {
+	return Rule{Name: name, Scope: ScopeIP, Requests: rate.Requests, Per: rate.Per.Std()}
+}
+
+// PerAccount limits logged-in users by user ID. Guests fall back to their IP.
+func PerAccount(name string, rate config.RateConfig) Rule {
+	return Rule{Name: name, Scope: ScopeAccount, Requests: rate.Requests, Per: rate.Per.Std()}
+}
+
+type Limiter struct {
+	store   Store
+	enabled bool
+}
+
+func NewLimiter(store Store, enabled bool) *Limiter {
+	return &Limiter{store: store, enabled: enabled}
+}
+
+func (l *Limiter) Store() Store {
+	return l.store
+}
+
+func accountKey(rule Rule, userID int) string {
+	return "rl:" + rule.Name + ":user:" + strconv.Itoa(userID)
+}
+
+func ruleKey(c *gin.Context, rule Rule) string {
+	if rule.Scope == ScopeAccount {
+		if id, exists := c.Get("user_id"); exists {
+			if userID, ok := id.(int); ok && userID > 0 {
+				return accountKey(rule, userID)
+			}
+		}
+	}
+	return "rl:" + rule.Name + ":ip:" + c.ClientIP()
+}
+
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// AllowAccount takes a token from an account rule outside of a request, for messages arriving
+// over an open WebSocket. It shares the bucket with the rule's routes.
+func (l *Limiter) AllowAccount(rule Rule, userID int) (bool, time.Duration) {
+	if !l.enabled {
+		return true, 0
+	}
+	return l.store.Take(accountKey(rule, userID), rule.Requests, rule.Per/time.Duration(rule.Requests), time.Now())
+}
+
+// Middleware enforces the rule. Account rules must run after the auth middleware.
+func (l *Limiter) Middleware(rule Rule) gin.HandlerFunc {
+	refillEvery := rule.Per / time.Duration(rule.Requests)
+	return func(c *gin.Context) {
+		if !l.enabled {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := l.store.Take(ruleKey(c, rule), rule.Requests, refillEvery, time.Now())
+		if !allowed {
+			tooManyRequests(c, retryAfter, "Too many requests, please try again later")
+			return
+		}
+		c.Next()
+	}
+}
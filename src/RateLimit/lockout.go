@@ -0,0 +1,136 @@
+package RateLimit
+
+import (
+	"bytes"
+	"cuento-backend/config"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Lockout blocks an account or IP after repeated failed logins. The first lock lasts base,
+// every further failure doubles it up to max. A successful login clears the record.
+type Lockout struct {
+	store     Store
+	enabled   bool
+	threshold int
+	base      time.Duration
+	max       time.Duration
+	window    time.Duration
+}
+
+func NewLockout(store Store, cfg *config.RateLimitConfig) *Lockout {
+	return &Lockout{
+		store:     store,
+		enabled:   cfg.Enabled,
+		threshold: cfg.LockoutThreshold,
+		base:      cfg.LockoutBase.Std(),
+		max:       cfg.LockoutMax.Std(),
+		window:    cfg.FailureWindow.Std(),
+	}
+}
+
+func (l *Lockout) lockedFor(keys []string, now time.Time) time.Duration {
+	var longest time.Duration
+	for _, key := range keys {
+		if until := l.store.LockedUntil(key, now); until.Sub(now) > longest {
+			longest = until.Sub(now)
+		}
+	}
+	return longest
+}
+
+func (l *Lockout) failure(keys []string, now time.Time) {
+	for _, key := range keys {
+		count := l.store.AddFailure(key, l.window, now)
+		if count < l.threshold {
+			continue
+		}
+		duration := l.base
+		for i := l.threshold; i < count && duration < l.max; i++ {
+			duration *= 2
+		}
+		if duration > l.max {
+			duration = l.max
+		}
+		l.store.Lock(key, now.Add(duration))
+	}
+}
+
+func (l *Lockout) success(keys []string) {
+	for _, key := range keys {
+		l.store.ResetFailures(key)
+	}
+}
+
+// AccountFunc names the account a login request is for, or returns "" when it can't tell.
+type AccountFunc func(c *gin.Context) string
+
+// PeekJSON decodes a JSON body into v without consuming it, so the handler can still bind it.
+func PeekJSON(c *gin.Context, v interface{}) {
+	if c.Request.Body == nil {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<16))
+	if err != nil {
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	_ = json.Unmarshal(body, v)
+}
+
+// LoginUsername takes the account from the username in the body.
+func LoginUsername(c *gin.Context) string {
+	var payload struct {
+		Username string `json:"username"`
+	}
+	PeekJSON(c, &payload)
+	return strings.ToLower(strings.TrimSpace(payload.Username))
+}
+
+// responseStatus returns the status the request will end with. Handlers report errors through
+// c.Error and the error middleware only writes them once the whole chain has returned.
+func responseStatus(c *gin.Context) int {
+	if len(c.Errors) > 0 {
+		if coded, ok := c.Errors.Last().Err.(interface{ StatusCode() int }); ok {
+			return coded.StatusCode()
+		}
+		return http.StatusInternalServerError
+	}
+	return c.Writer.Status()
+}
+
+// Middleware wraps a login endpoint. A 401 from the handler counts as a failure for the IP and,
+// when account names one, the account; a 2xx clears both.
+func (l *Lockout) Middleware(account AccountFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.enabled {
+			c.Next()
+			return
+		}
+
+		keys := []string{"lockout:ip:" + c.ClientIP()}
+		if name := account(c); name != "" {
+			keys = append(keys, "lockout:account:"+name)
+		}
+
+		now := time.Now()
+		if remaining := l.lockedFor(keys, now); remaining > 0 {
+			tooManyRequests(c, remaining, "Too many failed login attempts, please try again later")
+			return
+		}
+
+		c.Next()
+
+		switch status := responseStatus(c); {
+		case status == http.StatusUnauthorized:
+			l.failure(keys, time.Now())
+		case status >= 200 && status < 300:
+			l.success(keys)
+		}
+	}
+}
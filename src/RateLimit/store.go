@@ -0,0 +1,134 @@
+package RateLimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Store keeps bucket, failure and lock state. MemoryStore works for a single instance;
+// several instances behind a load balancer need an implementation backed by a shared store.
+type Store interface {
+	// Take removes one token from the bucket, creating it full if it doesn't exist.
+	// It returns false and the time until the next token when the bucket is empty.
+	Take(key string, capacity int, refillEvery time.Duration, now time.Time) (bool, time.Duration)
+	// AddFailure records a failure and returns how many happened within the window.
+	AddFailure(key string, window time.Duration, now time.Time) int
+	ResetFailures(key string)
+	Lock(key string, until time.Time)
+	LockedUntil(key string, now time.Time) time.Time
+}
+
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+	expires    time.Time
+}
+
+type failures struct {
+	count   int
+	expires time.Time
+}
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	failures  map[string]*failures
+	locks     map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failures),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Take(key string, capacity int, refillEvery time.Duration, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(capacity), lastRefill: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.lastRefill)
+	b.tokens += float64(elapsed) / float64(refillEvery)
+	if b.tokens > float64(capacity) {
+		b.tokens = float64(capacity)
+	}
+	b.lastRefill = now
+	// A bucket that has had time to fill up again is the same as a missing one
+	b.expires = now.Add(refillEvery * time.Duration(capacity))
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(refillEvery))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (s *MemoryStore) AddFailure(key string, window time.Duration, now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[key]
+	if !ok || now.After(f.expires) {
+		f = &failures{}
+		s.failures[key] = f
+	}
+	f.count++
+	f.expires = now.Add(window)
+	return f.count
+}
+
+func (s *MemoryStore) ResetFailures(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, key)
+	delete(s.locks, key)
+}
+
+func (s *MemoryStore) Lock(key string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.locks[key] = until
+}
+
+func (s *MemoryStore) LockedUntil(key string, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.locks[key]
+	if !ok || now.After(until) {
+		return time.Time{}
+	}
+	return until
+}
+
+// sweep drops expired entries once a minute so the maps don't grow without bound.
+// Must be called with the mutex held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.After(b.expires) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if now.After(f.expires) {
+			delete(s.failures, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package Router
 
 import (
+	"cuento-backend/src/RateLimit"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
@@ -10,11 +11,15 @@ type RouteDefinition struct {
 	Method     string
 	Path       string
 	Definition string
+	RateLimits []RateLimit.Rule
 }
 
 type CustomRouter struct {
 	router      *gin.RouterGroup
 	definitions []RouteDefinition
+	parent      *CustomRouter
+	limiter     *RateLimit.Limiter
+	limits      []RateLimit.Rule
 }
 
 var AllRoutes []RouteDefinition
@@ -26,67 +31,81 @@ func NewCustomRouter(router *gin.RouterGroup) *CustomRouter {
 	}
 }
 
-func (cr *CustomRouter) GET(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
-	route := RouteDefinition{
-		Method:     "GET",
-		Path:       relativePath,
-		Definition: definition,
+// SetLimiter sets the limiter that enforces rules declared with Limit.
+func (cr *CustomRouter) SetLimiter(limiter *RateLimit.Limiter) {
+	cr.limiter = limiter
+}
+
+// Limit returns a router whose routes are also subject to the given rate limits, e.g.
+// publicRouter.Limit(registerLimit).POST("/register", ...). Routes are still listed on the original router.
+func (cr *CustomRouter) Limit(rules ...RateLimit.Rule) *CustomRouter {
+	return &CustomRouter{
+		router:  cr.router,
+		parent:  cr,
+		limiter: cr.limiter,
+		limits:  append(append([]RateLimit.Rule{}, cr.limits...), rules...),
 	}
-	cr.definitions = append(cr.definitions, route)
-	AllRoutes = append(AllRoutes, route)
-	return cr.router.GET(relativePath, handlers...)
 }
 
-func (cr *CustomRouter) POST(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
-	route := RouteDefinition{
-		Method:     "POST",
-		Path:       relativePath,
-		Definition: definition,
+func (cr *CustomRouter) root() *CustomRouter {
+	root := cr
+	for root.parent != nil {
+		root = root.parent
 	}
-	cr.definitions = append(cr.definitions, route)
-	AllRoutes = append(AllRoutes, route)
-	return cr.router.POST(relativePath, handlers...)
+	return root
 }
 
-func (cr *CustomRouter) PATCH(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
+// register records the route and puts the rate limit middlewares in front of its handlers.
+func (cr *CustomRouter) register(method string, relativePath string, definition string, handlers []gin.HandlerFunc) []gin.HandlerFunc {
 	route := RouteDefinition{
-		Method:     "PATCH",
+		Method:     method,
 		Path:       relativePath,
 		Definition: definition,
+		RateLimits: cr.limits,
 	}
-	cr.definitions = append(cr.definitions, route)
+	root := cr.root()
+	root.definitions = append(root.definitions, route)
 	AllRoutes = append(AllRoutes, route)
-	return cr.router.PATCH(relativePath, handlers...)
+
+	if cr.limiter == nil || len(cr.limits) == 0 {
+		return handlers
+	}
+	chain := make([]gin.HandlerFunc, 0, len(cr.limits)+len(handlers))
+	for _, rule := range cr.limits {
+		chain = append(chain, cr.limiter.Middleware(rule))
+	}
+	return append(chain, handlers...)
+}
+
+func (cr *CustomRouter) GET(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return cr.router.GET(relativePath, cr.register("GET", relativePath, definition, handlers)...)
+}
+
+func (cr *CustomRouter) POST(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return cr.router.POST(relativePath, cr.register("POST", relativePath, definition, handlers)...)
+}
+
+func (cr *CustomRouter) PATCH(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return cr.router.PATCH(relativePath, cr.register("PATCH", relativePath, definition, handlers)...)
 }
 
 func (cr *CustomRouter) PUT(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
-	route := RouteDefinition{
-		Method:     "PUT",
-		Path:       relativePath,
-		Definition: definition,
-	}
-	cr.definitions = append(cr.definitions, route)
-	AllRoutes = append(AllRoutes, route)
-	return cr.router.PUT(relativePath, handlers...)
+	return cr.router.PUT(relativePath, cr.register("PUT", relativePath, definition, handlers)...)
 }
 
 func (cr *CustomRouter) DELETE(relativePath string, definition string, handlers ...gin.HandlerFunc) gin.IRoutes {
-	route := RouteDefinition{
-		Method:     "DELETE",
-		Path:       relativePath,
-		Definition: definition,
-	}
-	cr.definitions = append(cr.definitions, route)
-	AllRoutes = append(AllRoutes, route)
-	return cr.router.DELETE(relativePath, handlers...)
+	return cr.router.DELETE(relativePath, cr.register("DELETE", relativePath, definition, handlers)...)
 }
 
 func (cr *CustomRouter) PrintRoutes() {
 	for _, def := range cr.definitions {
 		fmt.Printf("%s - %s - %s\n", def.Path, def.Method, def.Definition)
+		for _, rule := range def.RateLimits {
+			fmt.Printf("    rate limit %s\n", rule)
+		}
 	}
 }
 
 func (cr *CustomRouter) GetRoutes() []RouteDefinition {
-	return cr.definitions
+	return cr.root().definitions
 }
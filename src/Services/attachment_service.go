@@ -0,0 +1,394 @@
+package Services
+
+import (
+	"crypto/rand"
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Uploads"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAttachmentsDisabled = errors.New("attachments are disabled in this subforum")
+	ErrTooManyAttachments  = errors.New("too many attachments")
+	ErrInvalidAttachment   = errors.New("attachments must be your own pending uploads for this topic")
+	ErrPendingQuotaReached = errors.New("too many unposted attachments, post or delete some first")
+)
+
+// GetTopicSubforum returns the subforum a topic lives in, attachments inherit its permissions.
+func GetTopicSubforum(topicID int, db DBExecutor) (int, error) {
+	var subforumID int
+	err := db.QueryRow("SELECT subforum_id FROM topics WHERE id = ?", topicID).Scan(&subforumID)
+	return subforumID, err
+}
+
+// GetAttachmentLimits returns the attachment limits of a subforum. Empty columns fall back to the
+// attachment_max_count setting and the configured upload size, which is also the hard cap on size.
+func GetAttachmentLimits(subforumID int, db DBExecutor) (Entities.AttachmentLimits, error) {
+	var maxCount, maxSize sql.NullInt64
+	err := db.QueryRow("SELECT attachment_max_count, attachment_max_size FROM subforums WHERE id = ?", subforumID).Scan(&maxCount, &maxSize)
+	if err != nil {
+		return Entities.AttachmentLimits{}, err
+	}
+
+	limits := Entities.AttachmentLimits{MaxSize: uploadConfig.MaxFileSize}
+	if maxCount.Valid {
+		limits.MaxCount = int(maxCount.Int64)
+	} else if limits.MaxCount, err = GetGlobalSettingInt("attachment_max_count", 5, db); err != nil {
+		return limits, err
+	}
+	if maxSize.Valid && int(maxSize.Int64) < limits.MaxSize {
+		limits.MaxSize = int(maxSize.Int64)
+	}
+	if limits.MaxCount < 0 {
+		limits.MaxCount = 0
+	}
+	return limits, nil
+}
+
+// SaveAttachment stores a file as a pending attachment of the topic in PrivateStorage. Images are re-encoded and get
+// a thumbnail, other files are stored as uploaded. A user's pending files may add up to
+// attachment_pending_quota bytes. Keys are random so stored files can't be found
+// from their content, they are only handed out through the permission-checked attachment endpoint.
+func SaveAttachment(userID int, topicID int, limits Entities.AttachmentLimits, fileName string, data []byte, db DBExecutor) (*Entities.PostAttachment, error) {
+	if limits.MaxCount == 0 {
+		return nil, ErrAttachmentsDisabled
+	}
+	if len(data) > limits.MaxSize {
+		return nil, Uploads.ErrFileTooLarge
+	}
+
+	var pending int
+	err := db.QueryRow("SELECT COUNT(*) FROM post_attachments WHERE user_id = ? AND topic_id = ? AND post_id IS NULL", userID, topicID).Scan(&pending)
+	if err != nil {
+		return nil, err
+	}
+	if pending >= limits.MaxCount {
+		return nil, fmt.Errorf("%w: at most %d per post", ErrTooManyAttachments, limits.MaxCount)
+	}
+
+	// Pending files of all topics count, so spreading uploads over topics doesn't get around it
+	quota, err := GetGlobalSettingInt("attachment_pending_quota", 50<<20, db)
+	if err != nil {
+		return nil, err
+	}
+	var pendingBytes int
+	err = db.QueryRow("SELECT COALESCE(SUM(size_bytes), 0) FROM post_attachments WHERE user_id = ? AND post_id IS NULL", userID).Scan(&pendingBytes)
+	if err != nil {
+		return nil, err
+	}
+	if pendingBytes+len(data) > quota {
+		return nil, ErrPendingQuotaReached
+	}
+
+	mimeType, ext, err := Uploads.DetectAttachmentType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	baseKey := "attachments/" + hex.EncodeToString(token)
+
+	fileData := data
+	var thumbnail *Uploads.Variant
+	if Uploads.IsImageType(mimeType) {
+		img, err := Uploads.DecodeImage(data, Uploads.Limits{MaxFileSize: limits.MaxSize, MaxWidth: uploadConfig.MaxWidth, MaxHeight: uploadConfig.MaxHeight})
+		if err != nil {
+			return nil, err
+		}
+		original, err := img.Original()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode image: %w", err)
+		}
+		fileData, ext = original.Data, original.Ext
+		if thumbnail, err = img.Thumbnail(uploadConfig.ThumbnailSize); err != nil {
+			return nil, fmt.Errorf("failed to create thumbnail: %w", err)
+		}
+	}
+
+	storageKey := fmt.Sprintf("%s/file.%s", baseKey, ext)
+	if err := PrivateStorage.Put(storageKey, fileData); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	var thumbnailKey *string
+	if thumbnail != nil {
+		key := fmt.Sprintf("%s/%s.%s", baseKey, thumbnail.Name, thumbnail.Ext)
+		if err := PrivateStorage.Put(key, thumbnail.Data); err != nil {
+			deleteAttachmentFiles(storageKey, nil)
+			return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+		}
+		thumbnailKey = &key
+	}
+
+	if len(fileName) > 255 {
+		fileName = fileName[:255]
+	}
+	res, err := db.Exec("INSERT INTO post_attachments (user_id, topic_id, file_name, mime_type, size_bytes, storage_key, thumbnail_key, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, NOW())",
+		userID, topicID, fileName, mimeType, len(fileData), storageKey, thumbnailKey)
+	if err != nil {
+		deleteAttachmentFiles(storageKey, thumbnailKey)
+		return nil, fmt.Errorf("failed to record attachment: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetAttachment(int(id), db)
+}
+
+const attachmentSelect = "SELECT id, user_id, topic_id, post_id, file_name, mime_type, size_bytes, thumbnail_key IS NOT NULL, date_created FROM post_attachments"
+
+func scanAttachment(row interface{ Scan(...interface{}) error }) (*Entities.PostAttachment, error) {
+	var attachment Entities.PostAttachment
+	var hasThumbnail bool
+	if err := row.Scan(&attachment.Id, &attachment.UserId, &attachment.TopicId, &attachment.PostId, &attachment.FileName,
+		&attachment.MimeType, &attachment.SizeBytes, &hasThumbnail, &attachment.DateCreated); err != nil {
+		return nil, err
+	}
+	attachment.Url = fmt.Sprintf("/attachment/%d", attachment.Id)
+	if hasThumbnail {
+		thumbnailURL := attachment.Url + "/thumbnail"
+		attachment.ThumbnailUrl = &thumbnailURL
+	}
+	return &attachment, nil
+}
+
+func GetAttachment(id int, db DBExecutor) (*Entities.PostAttachment, error) {
+	return scanAttachment(db.QueryRow(attachmentSelect+" WHERE id = ?", id))
+}
+
+// GetPendingAttachments lists what the user has uploaded for a topic but not posted yet.
+func GetPendingAttachments(userID int, topicID int, db DBExecutor) ([]Entities.PostAttachment, error) {
+	rows, err := db.Query(attachmentSelect+" WHERE user_id = ? AND topic_id = ? AND post_id IS NULL ORDER BY id", userID, topicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Entities.PostAttachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// GetPostAttachments loads the attachments of several posts at once, keyed by post ID.
+func GetPostAttachments(postIDs []int, db DBExecutor) (map[int][]Entities.PostAttachment, error) {
+	result := make(map[int][]Entities.PostAttachment)
+	if len(postIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(attachmentSelect+" WHERE post_id IN (?"+strings.Repeat(",?", len(postIDs)-1)+") ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[*attachment.PostId] = append(result[*attachment.PostId], *attachment)
+	}
+	return result, rows.Err()
+}
+
+// ReadAttachmentFile returns the stored file, or its thumbnail. sql.ErrNoRows means there is no such file.
+func ReadAttachmentFile(id int, thumbnail bool, db DBExecutor) ([]byte, error) {
+	var storageKey string
+	var thumbnailKey sql.NullString
+	if err := db.QueryRow("SELECT storage_key, thumbnail_key FROM post_attachments WHERE id = ?", id).Scan(&storageKey, &thumbnailKey); err != nil {
+		return nil, err
+	}
+	if thumbnail {
+		if !thumbnailKey.Valid {
+			return nil, sql.ErrNoRows
+		}
+		storageKey = thumbnailKey.String
+	}
+	return PrivateStorage.Get(storageKey)
+}
+
+// AttachToPost moves the listed pending attachments onto a newly created post.
+func AttachToPost(postID int64, topicID int, userID int, attachmentIDs []int, limits Entities.AttachmentLimits, db DBExecutor) error {
+	seen := make(map[int]bool)
+	var args []interface{}
+	args = append(args, postID)
+	for _, id := range attachmentIDs {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	if len(seen) > limits.MaxCount {
+		if limits.MaxCount == 0 {
+			return ErrAttachmentsDisabled
+		}
+		return fmt.Errorf("%w: at most %d per post", ErrTooManyAttachments, limits.MaxCount)
+	}
+	args = append(args, userID, topicID)
+
+	res, err := db.Exec("UPDATE post_attachments SET post_id = ? WHERE id IN (?"+strings.Repeat(",?", len(seen)-1)+") AND user_id = ? AND topic_id = ? AND post_id IS NULL", args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(affected) != len(seen) {
+		return ErrInvalidAttachment
+	}
+	return nil
+}
+
+// DeletePendingAttachment removes one of the user's attachments that hasn't been posted.
+// sql.ErrNoRows means there is no such pending attachment.
+func DeletePendingAttachment(id int, userID int, db DBExecutor) error {
+	var storageKey string
+	var thumbnailKey *string
+	err := db.QueryRow("SELECT storage_key, thumbnail_key FROM post_attachments WHERE id = ? AND user_id = ? AND post_id IS NULL", id, userID).Scan(&storageKey, &thumbnailKey)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM post_attachments WHERE id = ?", id); err != nil {
+		return err
+	}
+	deleteAttachmentFiles(storageKey, thumbnailKey)
+	return nil
+}
+
+// DeletePostAttachments removes the attachments of a post that is about to be deleted. Deleting
+// the post drops the rows through the foreign key, but not the stored files.
+func DeletePostAttachments(postID int, db DBExecutor) error {
+	rows, err := db.Query("SELECT storage_key, thumbnail_key FROM post_attachments WHERE post_id = ?", postID)
+	if err != nil {
+		return err
+	}
+	type storedFile struct {
+		storageKey   string
+		thumbnailKey *string
+	}
+	var files []storedFile
+	for rows.Next() {
+		var f storedFile
+		if err := rows.Scan(&f.storageKey, &f.thumbnailKey); err != nil {
+			rows.Close()
+			return err
+		}
+		files = append(files, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM post_attachments WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	for _, f := range files {
+		deleteAttachmentFiles(f.storageKey, f.thumbnailKey)
+	}
+	return nil
+}
+
+func deleteAttachmentFiles(storageKey string, thumbnailKey *string) {
+	if err := PrivateStorage.Delete(storageKey); err != nil {
+		fmt.Printf("Error deleting attachment file %s: %v\n", storageKey, err)
+	}
+	if thumbnailKey != nil {
+		if err := PrivateStorage.Delete(*thumbnailKey); err != nil {
+			fmt.Printf("Error deleting attachment file %s: %v\n", *thumbnailKey, err)
+		}
+	}
+}
+
+// CleanupOrphanedAttachments deletes uploads that were never posted after attachment_orphan_hours.
+func CleanupOrphanedAttachments(db *sql.DB) (int, error) {
+	hours, err := GetGlobalSettingInt("attachment_orphan_hours", 24, db)
+	if err != nil {
+		return 0, err
+	}
+
+	// Files of a reply someone still has a draft for are kept until the draft expires
+	rows, err := db.Query(`
+		SELECT a.id, a.storage_key, a.thumbnail_key
+		FROM post_attachments a
+		WHERE a.post_id IS NULL AND a.date_created < NOW() - INTERVAL ? HOUR
+			AND NOT EXISTS (SELECT 1 FROM drafts d WHERE d.user_id = a.user_id AND d.target_type = ? AND d.target_id = a.topic_id AND d.published = 0)`,
+		hours, Entities.DraftPost)
+	if err != nil {
+		return 0, err
+	}
+	type orphan struct {
+		id           int
+		storageKey   string
+		thumbnailKey *string
+	}
+	var orphans []orphan
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.id, &o.storageKey, &o.thumbnailKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orphans = append(orphans, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, o := range orphans {
+		// Only delete if it is still unattached, the author may have posted it in the meantime
+		res, err := db.Exec("DELETE FROM post_attachments WHERE id = ? AND post_id IS NULL", o.id)
+		if err != nil {
+			return removed, err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			continue
+		}
+		deleteAttachmentFiles(o.storageKey, o.thumbnailKey)
+		removed++
+	}
+	return removed, nil
+}
+
+// StartAttachmentCleanupScheduler removes expired drafts and orphaned attachments once an hour for
+// the lifetime of the process.
+func StartAttachmentCleanupScheduler(db *sql.DB) {
+	for {
+		if removed, err := CleanupExpiredDrafts(db); err != nil {
+			fmt.Printf("Error cleaning up drafts: %v\n", err)
+		} else if removed > 0 {
+			fmt.Printf("Removed %d expired drafts\n", removed)
+		}
+		if removed, err := CleanupOrphanedAttachments(db); err != nil {
+			fmt.Printf("Error cleaning up attachments: %v\n", err)
+		} else if removed > 0 {
+			fmt.Printf("Removed %d orphaned attachments\n", removed)
+		}
+		time.Sleep(time.Hour)
+	}
+}
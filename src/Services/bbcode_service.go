@@ -0,0 +1,49 @@
+package Services
+
+import (
+	"cuento-backend/src/BBCode"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// GetBBCodeConfig reads the board's tag configuration, empty if it was never saved.
+func GetBBCodeConfig(db DBExecutor) (BBCode.Config, error) {
+	cfg := BBCode.Config{Disabled: []string{}, CustomTags: []BBCode.CustomTag{}}
+	var raw []byte
+	err := db.QueryRow("SELECT config FROM bbcode_config WHERE id = 1").Scan(&raw)
+	if err == sql.ErrNoRows {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse bbcode config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadBBCodeConfig applies the saved tag configuration to the renderer.
+func LoadBBCodeConfig(db DBExecutor) error {
+	cfg, err := GetBBCodeConfig(db)
+	if err != nil {
+		return err
+	}
+	return BBCode.Default.Configure(cfg)
+}
+
+// UpdateBBCodeConfig validates, saves and applies a new tag configuration.
+func UpdateBBCodeConfig(cfg BBCode.Config, db DBExecutor) error {
+	if err := BBCode.Default.Validate(cfg); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("INSERT INTO bbcode_config (id, config) VALUES (1, ?) ON DUPLICATE KEY UPDATE config = VALUES(config)", string(raw)); err != nil {
+		return err
+	}
+	return BBCode.Default.Configure(cfg)
+}
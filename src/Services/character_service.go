@@ -0,0 +1,72 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"fmt"
+)
+
+type NewCharacter struct {
+	UserID       int
+	SubforumID   int
+	Name         string
+	Avatar       *string
+	Status       Entities.CharacterStatus
+	CustomFields map[string]Entities.CustomFieldValue
+	Factions     []Entities.Faction
+	// Decides which custom fields may be set and which are returned, nil for internal creation
+	Access *FieldAccess
+}
+
+// CreateCharacterWithSheet creates the character sheet topic, the character entity and its faction links.
+// Factions with a negative ID are created on the fly. The caller owns the transaction.
+func CreateCharacterWithSheet(newCharacter NewCharacter, tx DBExecutor) (interface{}, int64, error) {
+	// Insert Topic (without first post)
+	res, err := tx.Exec("INSERT INTO topics (subforum_id, name, author_user_id, date_created, date_last_post, status, type, post_number, last_post_author_user_id) VALUES (?, ?, ?, NOW(), NOW(), 0, ?, 0, ?)",
+		newCharacter.SubforumID, newCharacter.Name, newCharacter.UserID, Entities.CharacterSheetTopic, newCharacter.UserID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to insert topic: %w", err)
+	}
+	topicID, err := res.LastInsertId()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get topic ID: %w", err)
+	}
+
+	character := Entities.Character{
+		UserId:          newCharacter.UserID,
+		TopicId:         int(topicID),
+		Name:            newCharacter.Name,
+		Avatar:          newCharacter.Avatar,
+		CharacterStatus: newCharacter.Status,
+		CustomFields: Entities.CustomFieldEntity{
+			CustomFields: newCharacter.CustomFields,
+		},
+	}
+
+	createdEntity, characterID, err := CreateEntity("character", &character, newCharacter.Access, tx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create character entity: %w", err)
+	}
+
+	// Handle factions
+	for _, faction := range newCharacter.Factions {
+		var factionID int
+
+		// If faction ID is negative, create a new faction
+		if faction.Id < 0 {
+			newFactionID, err := CreateFaction(faction, tx)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to create faction: %w", err)
+			}
+			factionID = int(newFactionID)
+		} else {
+			factionID = faction.Id
+		}
+
+		// Add faction to character
+		if err := AddFactionCharacter(factionID, int(characterID), tx); err != nil {
+			return nil, 0, fmt.Errorf("failed to add faction to character: %w", err)
+		}
+	}
+
+	return createdEntity, characterID, nil
+}
@@ -0,0 +1,169 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrTransferAlreadyPending = errors.New("character already has a pending transfer")
+var ErrTransferNotPending = errors.New("transfer is no longer pending")
+var ErrTransferOwnerChanged = errors.New("character changed owner since the transfer was offered")
+
+const characterTransferSelect = `
+	SELECT ct.id, ct.character_id, cb.name, ct.from_user_id, uf.username, ct.to_user_id, ut.username,
+		ct.initiated_by_user_id, ui.username, ct.is_reassignment, ct.status, ct.date_created, ct.date_resolved
+	FROM character_transfers ct
+	JOIN character_base cb ON ct.character_id = cb.id
+	LEFT JOIN users uf ON ct.from_user_id = uf.id
+	JOIN users ut ON ct.to_user_id = ut.id
+	JOIN users ui ON ct.initiated_by_user_id = ui.id`
+
+func scanCharacterTransfer(scanner interface{ Scan(...interface{}) error }) (*Entities.CharacterTransfer, error) {
+	var t Entities.CharacterTransfer
+	err := scanner.Scan(&t.Id, &t.CharacterId, &t.CharacterName, &t.FromUserId, &t.FromUsername, &t.ToUserId, &t.ToUsername,
+		&t.InitiatedByUserId, &t.InitiatedByUsername, &t.IsReassignment, &t.Status, &t.DateCreated, &t.DateResolved)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func queryCharacterTransfers(db DBExecutor, where string, args ...interface{}) ([]Entities.CharacterTransfer, error) {
+	rows, err := db.Query(characterTransferSelect+" "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []Entities.CharacterTransfer{}
+	for rows.Next() {
+		t, err := scanCharacterTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, *t)
+	}
+	return transfers, rows.Err()
+}
+
+// GetCharacterOwner returns the ID of the user who currently owns the character.
+func GetCharacterOwner(characterID int, db DBExecutor) (int, error) {
+	var userID sql.NullInt64
+	err := db.QueryRow("SELECT user_id FROM character_base WHERE id = ?", characterID).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return int(userID.Int64), nil
+}
+
+// GetCharacterProfileOwner returns the ID of the user who owns the character the profile belongs to.
+func GetCharacterProfileOwner(profileID int, db DBExecutor) (int, error) {
+	var userID sql.NullInt64
+	err := db.QueryRow("SELECT cb.user_id FROM character_profile_base cp JOIN character_base cb ON cp.character_id = cb.id WHERE cp.id = ?", profileID).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return int(userID.Int64), nil
+}
+
+func GetCharacterTransfer(id int, db DBExecutor) (*Entities.CharacterTransfer, error) {
+	return scanCharacterTransfer(db.QueryRow(characterTransferSelect+" WHERE ct.id = ?", id))
+}
+
+func GetCharacterTransferHistory(characterID int, db DBExecutor) ([]Entities.CharacterTransfer, error) {
+	return queryCharacterTransfers(db, "WHERE ct.character_id = ? ORDER BY ct.date_created DESC, ct.id DESC", characterID)
+}
+
+func GetPendingTransfersForUser(userID int, db DBExecutor) ([]Entities.CharacterTransfer, error) {
+	return queryCharacterTransfers(db, "WHERE ct.status = ? AND (ct.to_user_id = ? OR ct.from_user_id = ?) ORDER BY ct.date_created DESC",
+		Entities.PendingTransfer, userID, userID)
+}
+
+// CreateCharacterTransfer opens a pending transfer of the character to another user.
+// Only one transfer per character can be pending at a time.
+func CreateCharacterTransfer(characterID int, toUserID int, initiatedBy int, isReassignment bool, db *sql.DB) (*Entities.CharacterTransfer, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var fromUserID sql.NullInt64
+	err = tx.QueryRow("SELECT user_id FROM character_base WHERE id = ? FOR UPDATE", characterID).Scan(&fromUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending int
+	err = tx.QueryRow("SELECT COUNT(*) FROM character_transfers WHERE character_id = ? AND status = ?", characterID, Entities.PendingTransfer).Scan(&pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check pending transfers: %w", err)
+	}
+	if pending > 0 {
+		return nil, ErrTransferAlreadyPending
+	}
+
+	res, err := tx.Exec("INSERT INTO character_transfers (character_id, from_user_id, to_user_id, initiated_by_user_id, is_reassignment, status, date_created) VALUES (?, ?, ?, ?, ?, ?, NOW())",
+		characterID, fromUserID, toUserID, initiatedBy, isReassignment, Entities.PendingTransfer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert transfer: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return GetCharacterTransfer(int(id), db)
+}
+
+// ResolveCharacterTransfer closes a pending transfer with the given status.
+// Accepting a transfer moves the character, and with it its profiles, to the recipient, but only
+// while the user who offered it still owns the character.
+func ResolveCharacterTransfer(id int, status Entities.CharacterTransferStatus, db *sql.DB) (*Entities.CharacterTransfer, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var characterID, toUserID int
+	var fromUserID sql.NullInt64
+	var currentStatus Entities.CharacterTransferStatus
+	err = tx.QueryRow("SELECT character_id, from_user_id, to_user_id, status FROM character_transfers WHERE id = ? FOR UPDATE", id).Scan(&characterID, &fromUserID, &toUserID, &currentStatus)
+	if err != nil {
+		return nil, err
+	}
+	if currentStatus != Entities.PendingTransfer {
+		return nil, ErrTransferNotPending
+	}
+
+	if status == Entities.AcceptedTransfer {
+		res, err := tx.Exec("UPDATE character_base SET user_id = ? WHERE id = ? AND user_id <=> ?", toUserID, characterID, fromUserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update character owner: %w", err)
+		}
+		moved, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to update character owner: %w", err)
+		}
+		if moved == 0 {
+			return nil, ErrTransferOwnerChanged
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE character_transfers SET status = ?, date_resolved = NOW() WHERE id = ?", status, id); err != nil {
+		return nil, fmt.Errorf("failed to update transfer: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return GetCharacterTransfer(id, db)
+}
@@ -0,0 +1,291 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrNotParticipant = errors.New("user is not a participant of this conversation")
+var ErrUnknownParticipant = errors.New("no user with this ID")
+
+// Number of messages shown on one conversation page
+const MessagesPerPage = 30
+
+const privateMessageSelect = `
+	SELECT m.id, m.conversation_id, m.author_user_id, u.username, u.avatar,
+		m.character_profile_id, cp.character_id, cb.name, cp.avatar, m.content, m.date_created
+	FROM messages m
+	JOIN users u ON m.author_user_id = u.id
+	LEFT JOIN character_profile_base cp ON m.character_profile_id = cp.id
+	LEFT JOIN character_base cb ON cp.character_id = cb.id`
+
+func scanPrivateMessage(scanner interface{ Scan(...interface{}) error }) (*Entities.PrivateMessage, error) {
+	var m Entities.PrivateMessage
+	err := scanner.Scan(&m.Id, &m.ConversationId, &m.AuthorUserId, &m.AuthorUsername, &m.AuthorAvatar,
+		&m.CharacterProfileId, &m.CharacterId, &m.CharacterName, &m.CharacterAvatar, &m.Content, &m.DateCreated)
+	if err != nil {
+		return nil, err
+	}
+	m.ContentHtml = Entities.ParseBBCode(m.Content)
+	return &m, nil
+}
+
+// CreateConversation opens a conversation between the creator and the given users.
+func CreateConversation(creatorID int, title string, participantIDs []int, db DBExecutor) (int, error) {
+	res, err := db.Exec("INSERT INTO conversations (title, created_by_user_id, date_created) VALUES (?, ?, NOW())", title, creatorID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert conversation: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get conversation ID: %w", err)
+	}
+
+	if err := AddConversationParticipants(int(id), append([]int{creatorID}, participantIDs...), db); err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// AddConversationParticipants adds users to the conversation. Users who already take part, or
+// who left it, are skipped: nobody else can pull a user back into a conversation they left.
+// It returns ErrUnknownParticipant if any of the IDs isn't a user.
+func AddConversationParticipants(conversationID int, userIDs []int, db DBExecutor) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT id FROM users WHERE id IN (?"+strings.Repeat(",?", len(userIDs)-1)+")", args...)
+	if err != nil {
+		return fmt.Errorf("failed to check participants: %w", err)
+	}
+	known := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to check participants: %w", err)
+		}
+		known[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check participants: %w", err)
+	}
+	for _, userID := range userIDs {
+		if !known[userID] {
+			return fmt.Errorf("%w: %d", ErrUnknownParticipant, userID)
+		}
+	}
+
+	for _, userID := range userIDs {
+		_, err := db.Exec(`INSERT IGNORE INTO conversation_participants (conversation_id, user_id, last_read_message_id, is_muted, has_left, date_joined)
+			VALUES (?, ?, 0, FALSE, FALSE, NOW())`, conversationID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to add participant %d: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// RequireConversationParticipant returns ErrNotParticipant unless the user is an active participant.
+func RequireConversationParticipant(conversationID int, userID int, db DBExecutor) error {
+	var hasLeft bool
+	err := db.QueryRow("SELECT has_left FROM conversation_participants WHERE conversation_id = ? AND user_id = ?", conversationID, userID).Scan(&hasLeft)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotParticipant
+		}
+		return err
+	}
+	if hasLeft {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+func CreatePrivateMessage(conversationID int, authorID int, content string, characterProfileID *int, db DBExecutor) (*Entities.PrivateMessage, error) {
+	res, err := db.Exec("INSERT INTO messages (conversation_id, author_user_id, character_profile_id, content, date_created) VALUES (?, ?, ?, ?, NOW())",
+		conversationID, authorID, characterProfileID, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert message: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message ID: %w", err)
+	}
+
+	if _, err := db.Exec("UPDATE conversations SET date_last_message = NOW() WHERE id = ?", conversationID); err != nil {
+		return nil, fmt.Errorf("failed to update conversation: %w", err)
+	}
+
+	// The author has obviously read everything up to their own message
+	if _, err := db.Exec("UPDATE conversation_participants SET last_read_message_id = ?, date_last_read = NOW() WHERE conversation_id = ? AND user_id = ?",
+		id, conversationID, authorID); err != nil {
+		return nil, fmt.Errorf("failed to update read marker: %w", err)
+	}
+
+	return scanPrivateMessage(db.QueryRow(privateMessageSelect+" WHERE m.id = ?", id))
+}
+
+func GetConversationMessages(conversationID int, page int, db DBExecutor) ([]Entities.PrivateMessage, error) {
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * MessagesPerPage
+
+	rows, err := db.Query(privateMessageSelect+" WHERE m.conversation_id = ? ORDER BY m.id ASC LIMIT ? OFFSET ?",
+		conversationID, MessagesPerPage, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Entities.PrivateMessage{}
+	for rows.Next() {
+		m, err := scanPrivateMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	return messages, rows.Err()
+}
+
+func GetConversationParticipants(conversationID int, db DBExecutor) ([]Entities.ConversationParticipant, error) {
+	rows, err := db.Query(`
+		SELECT cp.user_id, u.username, u.avatar, cp.last_read_message_id, cp.date_last_read, cp.has_left
+		FROM conversation_participants cp
+		JOIN users u ON cp.user_id = u.id
+		WHERE cp.conversation_id = ?
+		ORDER BY cp.date_joined`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []Entities.ConversationParticipant{}
+	for rows.Next() {
+		var p Entities.ConversationParticipant
+		if err := rows.Scan(&p.UserId, &p.Username, &p.Avatar, &p.LastReadMessageId, &p.DateLastRead, &p.HasLeft); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
+
+const conversationSelect = `
+	SELECT c.id, c.title, c.created_by_user_id, c.date_created, c.date_last_message, cp.is_muted, cp.last_read_message_id,
+		(SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id AND m.id > cp.last_read_message_id AND m.author_user_id != cp.user_id)
+	FROM conversations c
+	JOIN conversation_participants cp ON cp.conversation_id = c.id AND cp.user_id = ?`
+
+func scanConversation(scanner interface{ Scan(...interface{}) error }) (*Entities.Conversation, error) {
+	var conv Entities.Conversation
+	err := scanner.Scan(&conv.Id, &conv.Title, &conv.CreatedByUserId, &conv.DateCreated, &conv.DateLastMessage, &conv.IsMuted, &conv.LastReadMessageId, &conv.UnreadCount)
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// GetConversation returns the conversation as seen by the given participant, including read receipts.
+func GetConversation(conversationID int, userID int, db DBExecutor) (*Entities.Conversation, error) {
+	conv, err := scanConversation(db.QueryRow(conversationSelect+" WHERE c.id = ?", userID, conversationID))
+	if err != nil {
+		return nil, err
+	}
+	conv.Participants, err = GetConversationParticipants(conversationID, db)
+	if err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+func GetUserConversations(userID int, page int, db DBExecutor) ([]Entities.Conversation, error) {
+	limit := 20
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	rows, err := db.Query(conversationSelect+" WHERE cp.has_left = FALSE ORDER BY COALESCE(c.date_last_message, c.date_created) DESC LIMIT ? OFFSET ?",
+		userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []Entities.Conversation{}
+	for rows.Next() {
+		conv, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, *conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range conversations {
+		conversations[i].Participants, err = GetConversationParticipants(conversations[i].Id, db)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return conversations, nil
+}
+
+// MarkConversationRead moves the participant's read marker forward and reports whether it moved.
+func MarkConversationRead(conversationID int, userID int, lastMessageID int, db DBExecutor) (bool, error) {
+	res, err := db.Exec("UPDATE conversation_participants SET last_read_message_id = ?, date_last_read = NOW() WHERE conversation_id = ? AND user_id = ? AND last_read_message_id < ?",
+		lastMessageID, conversationID, userID, lastMessageID)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := res.RowsAffected()
+	return affected > 0, nil
+}
+
+func LeaveConversation(conversationID int, userID int, db DBExecutor) error {
+	_, err := db.Exec("UPDATE conversation_participants SET has_left = TRUE WHERE conversation_id = ? AND user_id = ?", conversationID, userID)
+	return err
+}
+
+func SetConversationMuted(conversationID int, userID int, muted bool, db DBExecutor) error {
+	_, err := db.Exec("UPDATE conversation_participants SET is_muted = ? WHERE conversation_id = ? AND user_id = ?", muted, conversationID, userID)
+	return err
+}
+
+// GetConversationReceivers returns the active participants other than the given user.
+// Muted participants are skipped unless includeMuted is set.
+func GetConversationReceivers(conversationID int, exceptUserID int, includeMuted bool, db DBExecutor) ([]int, error) {
+	query := "SELECT user_id FROM conversation_participants WHERE conversation_id = ? AND user_id != ? AND has_left = FALSE"
+	if !includeMuted {
+		query += " AND is_muted = FALSE"
+	}
+	rows, err := db.Query(query, conversationID, exceptUserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
@@ -31,12 +31,41 @@ func IdentifyBaseEntity(className string) (interface{}, error) {
 		entity = &Entities.CharacterProfile{}
 	case "episode":
 		entity = &Entities.Episode{}
+	case "wanted_character":
+		entity = &Entities.WantedCharacter{}
+	case "user":
+		entity = &Entities.UserEntity{}
 	default:
 		return nil, fmt.Errorf("unknown entity class: %s", className)
 	}
 	return entity, nil
 }
 
+// Base tables that don't follow the <class>_base naming. Reads of users go through a subquery
+// aliased user_base with only public columns, so password and email never end up among the custom fields.
+var (
+	baseTableReadSources = map[string]string{
+		"user": "(SELECT id, username, avatar, date_registered FROM users WHERE id != 0) AS user_base",
+	}
+	baseTableNames = map[string]string{
+		"user": "users",
+	}
+)
+
+func baseTableReadSource(className string) string {
+	if source, ok := baseTableReadSources[className]; ok {
+		return source
+	}
+	return className + "_base"
+}
+
+func baseTableName(className string) string {
+	if name, ok := baseTableNames[className]; ok {
+		return name
+	}
+	return className + "_base"
+}
+
 func ToSnakeCase(str string) string {
 	var res strings.Builder
 	for i, r := range str {
@@ -50,15 +79,7 @@ func ToSnakeCase(str string) string {
 	return res.String()
 }
 
-func GetEntity(id int64, className string, db DBExecutor) (interface{}, error) {
-	// Basic validation
-	for _, r := range className {
-		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
-			return nil, fmt.Errorf("invalid class name")
-		}
-	}
-
-	// Fetch Config
+func getFieldConfig(className string, db DBExecutor) ([]Entities.CustomFieldConfig, error) {
 	var configBytes []byte
 	err := db.QueryRow(fmt.Sprintf("SELECT config FROM custom_field_config WHERE entity_type = '%s'", className)).Scan(&configBytes)
 	if err != nil {
@@ -74,9 +95,26 @@ func GetEntity(id int64, className string, db DBExecutor) (interface{}, error) {
 			return nil, err
 		}
 	}
+	return config, nil
+}
+
+// GetEntity loads an entity with the custom fields access allows to see. Pass nil access for internal reads.
+func GetEntity(id int64, className string, access *FieldAccess, db DBExecutor) (interface{}, error) {
+	// Basic validation
+	for _, r := range className {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return nil, fmt.Errorf("invalid class name")
+		}
+	}
+
+	// Fetch Config
+	config, err := getFieldConfig(className, db)
+	if err != nil {
+		return nil, err
+	}
 
 	// 1. Fetch data as map
-	query := fmt.Sprintf("SELECT * FROM %s_base LEFT JOIN %s_flattened ON %s_base.id = %s_flattened.entity_id WHERE %s_base.id = ?", className, className, className, className, className)
+	query := fmt.Sprintf("SELECT * FROM %s LEFT JOIN %s_flattened ON %s_base.id = %s_flattened.entity_id WHERE %s_base.id = ?", baseTableReadSource(className), className, className, className, className)
 
 	rows, err := db.Query(query, id)
 	if err != nil {
@@ -123,14 +161,14 @@ func GetEntity(id int64, className string, db DBExecutor) (interface{}, error) {
 	}
 
 	// 3. Fill struct
-	if err := fillEntity(entity, data, config); err != nil {
+	if err := fillEntity(entity, data, config, access, className, int(id), db); err != nil {
 		return nil, err
 	}
 
 	return entity, nil
 }
 
-func fillEntity(entity interface{}, data map[string]interface{}, config []Entities.CustomFieldConfig) error {
+func fillEntity(entity interface{}, data map[string]interface{}, config []Entities.CustomFieldConfig, access *FieldAccess, className string, id int, db DBExecutor) error {
 	v := reflect.ValueOf(entity).Elem()
 	t := v.Type()
 
@@ -165,15 +203,7 @@ func fillEntity(entity interface{}, data map[string]interface{}, config []Entiti
 
 		for key, val := range data {
 			if !usedKeys[key] && key != "entity_id" { // Ignore entity_id as it's duplicate of id
-				cfValue := Entities.CustomFieldValue{Content: val}
-				if conf, ok := configMap[key]; ok {
-					if conf.FieldType == "text" {
-						if s, ok := val.(string); ok {
-							cfValue.ContentHtml = Entities.ParseBBCode(s)
-						}
-					}
-				}
-				cfMap[key] = cfValue
+				cfMap[key] = Entities.CustomFieldValue{Content: val}
 			}
 		}
 
@@ -187,6 +217,23 @@ func fillEntity(entity interface{}, data map[string]interface{}, config []Entiti
 		if cfConfigField.IsValid() && cfConfigField.CanSet() {
 			cfConfigField.Set(reflect.ValueOf(config))
 		}
+
+		if access != nil {
+			cfField.Addr().Interface().(*Entities.CustomFieldEntity).FilterFields(access.CanView)
+		}
+
+		// Only the fields left after filtering are rendered
+		htmlBatch := NewFieldHtmlBatch(className)
+		for key, value := range cfMap {
+			if conf, ok := configMap[key]; ok && conf.FieldType == "text" {
+				if s, ok := value.Content.(string); ok {
+					htmlBatch.AddField(id, key, s, cfMap)
+				}
+			}
+		}
+		if err := htmlBatch.Resolve(db); err != nil {
+			return fmt.Errorf("failed to render text fields: %w", err)
+		}
 	}
 
 	return nil
@@ -255,7 +302,10 @@ func getColumnTypes(className string, db DBExecutor) (map[string]string, error)
 	return colTypeMap, nil
 }
 
-func CreateEntity(className string, entity interface{}, db DBExecutor) (interface{}, int64, error) {
+// CreateEntity inserts an entity and its custom fields and returns it as access sees it. Custom
+// fields access can't edit are rejected with ErrFieldNotEditable before anything is written. Pass
+// nil access for internal inserts.
+func CreateEntity(className string, entity interface{}, access *FieldAccess, db DBExecutor) (interface{}, int64, error) {
 	// Basic validation
 	for _, r := range className {
 		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
@@ -278,6 +328,14 @@ func CreateEntity(className string, entity interface{}, db DBExecutor) (interfac
 		}
 	}
 
+	if cf := v.FieldByName("CustomFields"); cf.IsValid() && cf.Kind() == reflect.Struct {
+		if fields, ok := cf.FieldByName("CustomFields").Interface().(map[string]Entities.CustomFieldValue); ok {
+			if err := CheckEditableFields(className, fields, access, db); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
 	// 1. Insert into the base table
 	var cols []string
 	var vals []interface{}
@@ -304,7 +362,7 @@ func CreateEntity(className string, entity interface{}, db DBExecutor) (interfac
 
 	var id int64
 	if len(cols) > 0 {
-		query := fmt.Sprintf("INSERT INTO %s_base (%s) VALUES (%s)", className, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", baseTableName(className), strings.Join(cols, ", "), strings.Join(placeholders, ", "))
 		res, err := db.Exec(query, vals...)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to insert base entity: %w", err)
@@ -403,11 +461,23 @@ func CreateEntity(className string, entity interface{}, db DBExecutor) (interfac
 		}
 	}
 
-	createdEntity, err := GetEntity(id, className, db)
+	createdEntity, err := GetEntity(id, className, access, db)
 	return createdEntity, id, err
 }
 
-func PatchEntity(id int64, className string, updates map[string]interface{}, db DBExecutor) (interface{}, error) {
+// customFieldUpdates returns the custom field values of a patch, sent as {"custom_fields": {"custom_fields": {...}}}.
+func customFieldUpdates(updates map[string]interface{}) map[string]interface{} {
+	if cfEntityMap, ok := updates["custom_fields"].(map[string]interface{}); ok {
+		if fMap, ok := cfEntityMap["custom_fields"].(map[string]interface{}); ok {
+			return fMap
+		}
+	}
+	return nil
+}
+
+// PatchEntity updates base and custom fields. Custom fields access can't edit are rejected with
+// ErrFieldNotEditable before anything is written. Pass nil access for internal updates.
+func PatchEntity(id int64, className string, updates map[string]interface{}, access *FieldAccess, db DBExecutor) (interface{}, error) {
 	// Basic validation
 	for _, r := range className {
 		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
@@ -432,7 +502,12 @@ func PatchEntity(id int64, className string, updates map[string]interface{}, db
 		}
 	}
 
-	// 2. Prepare base update
+	// 2. Check custom fields against the field ACLs before writing anything
+	if err := CheckEditableFields(className, customFieldUpdates(updates), access, db); err != nil {
+		return nil, err
+	}
+
+	// 3. Prepare base update
 	var baseUpdates []string
 	var baseArgs []interface{}
 
@@ -445,24 +520,16 @@ func PatchEntity(id int64, className string, updates map[string]interface{}, db
 	}
 
 	if len(baseUpdates) > 0 {
-		query := fmt.Sprintf("UPDATE %s_base SET %s WHERE id = ?", className, strings.Join(baseUpdates, ", "))
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE id = ?", baseTableName(className), strings.Join(baseUpdates, ", "))
 		baseArgs = append(baseArgs, id)
 		if _, err := db.Exec(query, baseArgs...); err != nil {
 			return nil, fmt.Errorf("failed to update base entity: %w", err)
 		}
 	}
 
-	// 3. Update custom fields
-	if cfVal, ok := updates["custom_fields"]; ok {
-		var fieldsMap map[string]interface{}
-
-		if cfEntityMap, ok := cfVal.(map[string]interface{}); ok {
-			if fVal, ok := cfEntityMap["custom_fields"]; ok {
-				if fMap, ok := fVal.(map[string]interface{}); ok {
-					fieldsMap = fMap
-				}
-			}
-		}
+	// 4. Update custom fields
+	if _, ok := updates["custom_fields"]; ok {
+		fieldsMap := customFieldUpdates(updates)
 
 		if len(fieldsMap) > 0 {
 			colTypeMap, err := getColumnTypes(className, db)
@@ -549,5 +616,5 @@ func PatchEntity(id int64, className string, updates map[string]interface{}, db
 		}
 	}
 
-	return GetEntity(id, className, db)
+	return GetEntity(id, className, access, db)
 }
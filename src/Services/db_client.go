@@ -2,18 +2,18 @@ package Services
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"time"
 
 	"cuento-backend/config"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 var DB *sql.DB
 
-func InitDB() {
-	cfg := config.LoadDBConfig()
+func InitDB(cfg *config.DBConfig) {
 	dsn := cfg.DSN()
 
 	var err error
@@ -38,3 +38,9 @@ func InitDB() {
 
 	log.Println("Successfully connected to the database")
 }
+
+// isDuplicateKey reports whether err is MySQL refusing a row that breaks a unique key.
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
@@ -0,0 +1,208 @@
+package Services
+
+import (
+	"crypto/rand"
+	"cuento-backend/src/Entities"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRollsPerPost = 20
+	maxDicePerRoll  = 100
+	maxDieSides     = 1000
+	maxRollModifier = 10000
+)
+
+var (
+	ErrInvalidRoll  = errors.New("invalid dice roll, use notation like 2d6+3")
+	ErrTooManyRolls = fmt.Errorf("a post can't have more than %d dice rolls", maxRollsPerPost)
+	ErrRollInEdit   = errors.New("dice can only be rolled in a new post")
+	ErrRollRemoved  = errors.New("dice rolls can't be removed from a post")
+)
+
+var (
+	rollTagPattern  = regexp.MustCompile(`(?i)\[roll\]([^\[]*)\[/roll\]`)
+	diceTagPattern  = regexp.MustCompile(`(?i)\[dice=(\d+)\]`)
+	notationPattern = regexp.MustCompile(`^(\d{0,3})[dD](\d{1,4})(?:\s*([+-])\s*(\d{1,5}))?$`)
+)
+
+type diceExpression struct {
+	count    int
+	sides    int
+	modifier int
+}
+
+func (e diceExpression) String() string {
+	notation := fmt.Sprintf("%dd%d", e.count, e.sides)
+	if e.modifier > 0 {
+		notation += fmt.Sprintf("+%d", e.modifier)
+	} else if e.modifier < 0 {
+		notation += fmt.Sprintf("-%d", -e.modifier)
+	}
+	return notation
+}
+
+// parseDiceNotation reads NdS, NdS+M or NdS-M. A missing N means one die.
+func parseDiceNotation(notation string) (diceExpression, error) {
+	match := notationPattern.FindStringSubmatch(strings.TrimSpace(notation))
+	if match == nil {
+		return diceExpression{}, fmt.Errorf("%w: %q", ErrInvalidRoll, notation)
+	}
+	expr := diceExpression{count: 1}
+	if match[1] != "" {
+		expr.count, _ = strconv.Atoi(match[1])
+	}
+	expr.sides, _ = strconv.Atoi(match[2])
+	if match[4] != "" {
+		expr.modifier, _ = strconv.Atoi(match[4])
+		if match[3] == "-" {
+			expr.modifier = -expr.modifier
+		}
+	}
+	if expr.count < 1 || expr.count > maxDicePerRoll || expr.sides < 2 || expr.sides > maxDieSides || expr.modifier > maxRollModifier || expr.modifier < -maxRollModifier {
+		return diceExpression{}, fmt.Errorf("%w: %q (up to %d dice with 2 to %d sides)", ErrInvalidRoll, notation, maxDicePerRoll, maxDieSides)
+	}
+	return expr, nil
+}
+
+// ValidateRolls checks the [roll] tags of a post before anything is written.
+func ValidateRolls(content string) error {
+	matches := rollTagPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) > maxRollsPerPost {
+		return ErrTooManyRolls
+	}
+	for _, match := range matches {
+		if _, err := parseDiceNotation(match[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollDice rolls every [roll] tag of a new post, stores the results and replaces each tag in the
+// post with [dice=id][/dice]. Every roll gets its own random seed, which is stored and logged with
+// the results.
+func RollDice(postID int64, content string, db DBExecutor) error {
+	if err := ValidateRolls(content); err != nil {
+		return err
+	}
+	if !rollTagPattern.MatchString(content) {
+		return nil
+	}
+
+	var rollErr error
+	rolled := rollTagPattern.ReplaceAllStringFunc(content, func(tag string) string {
+		if rollErr != nil {
+			return tag
+		}
+		expr, _ := parseDiceNotation(rollTagPattern.FindStringSubmatch(tag)[1])
+		var seedBytes [8]byte
+		if _, err := rand.Read(seedBytes[:]); err != nil {
+			rollErr = err
+			return tag
+		}
+		seed := binary.BigEndian.Uint64(seedBytes[:])
+
+		results, total := rollWithSeed(expr, seed, postID)
+		resultsJSON, _ := json.Marshal(results)
+		res, err := db.Exec("INSERT INTO post_dice_rolls (post_id, notation, results, modifier, total, seed, date_created) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			postID, expr.String(), resultsJSON, expr.modifier, total, seed, time.Now())
+		if err != nil {
+			rollErr = err
+			return tag
+		}
+		rollID, err := res.LastInsertId()
+		if err != nil {
+			rollErr = err
+			return tag
+		}
+		log.Printf("Dice roll %d for post %d: %s seed=%d results=%v total=%d", rollID, postID, expr, seed, results, total)
+		return fmt.Sprintf("[dice=%d][/dice]", rollID)
+	})
+	if rollErr != nil {
+		return fmt.Errorf("failed to roll dice: %w", rollErr)
+	}
+	_, err := db.Exec("UPDATE posts SET content = ? WHERE id = ?", rolled, postID)
+	return err
+}
+
+// rollWithSeed is deterministic, so a stored roll can be checked by rolling it again.
+func rollWithSeed(expr diceExpression, seed uint64, postID int64) ([]int, int) {
+	rng := mathrand.New(mathrand.NewPCG(seed, uint64(postID)))
+	results := make([]int, expr.count)
+	total := expr.modifier
+	for i := range results {
+		results[i] = rng.IntN(expr.sides) + 1
+		total += results[i]
+	}
+	return results, total
+}
+
+// CheckRollsKept refuses edits that add [roll] tags or drop a roll the post already has, so a
+// result can't be replaced by rolling again. In a transaction it locks the post, so concurrent
+// edits are checked one after the other.
+func CheckRollsKept(postID int, content string, db DBExecutor) error {
+	if rollTagPattern.MatchString(content) {
+		return ErrRollInEdit
+	}
+	var id int
+	if err := db.QueryRow("SELECT id FROM posts WHERE id = ? FOR UPDATE", postID).Scan(&id); err != nil {
+		return err
+	}
+	rolls, err := GetPostRolls([]int{postID}, db)
+	if err != nil {
+		return err
+	}
+	kept := make(map[int]bool)
+	for _, match := range diceTagPattern.FindAllStringSubmatch(content, -1) {
+		if id, err := strconv.Atoi(match[1]); err == nil {
+			kept[id] = true
+		}
+	}
+	for _, roll := range rolls[postID] {
+		if !kept[roll.Id] {
+			return ErrRollRemoved
+		}
+	}
+	return nil
+}
+
+// GetPostRolls returns the dice rolls of the given posts keyed by post ID.
+func GetPostRolls(postIDs []int, db DBExecutor) (map[int][]Entities.DiceRoll, error) {
+	result := make(map[int][]Entities.DiceRoll)
+	if len(postIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT id, post_id, notation, results, modifier, total, seed, date_created FROM post_dice_rolls WHERE post_id IN (?"+strings.Repeat(",?", len(postIDs)-1)+") ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var roll Entities.DiceRoll
+		var resultsJSON []byte
+		if err := rows.Scan(&roll.Id, &roll.PostId, &roll.Notation, &resultsJSON, &roll.Modifier, &roll.Total, &roll.Seed, &roll.DateCreated); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(resultsJSON, &roll.Results); err != nil {
+			return nil, err
+		}
+		result[roll.PostId] = append(result[roll.PostId], roll)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,214 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	maxDraftContent = 65535 // what posts.content holds
+	maxDraftData    = 65535
+)
+
+var (
+	ErrInvalidDraftTarget = errors.New("drafts are for a topic (post), a subforum (topic, episode) or a new character (0)")
+	ErrDraftForbidden     = errors.New("you can't write there")
+	ErrDraftTooLarge      = errors.New("draft is too large")
+	ErrInvalidDraftData   = errors.New("draft data must be JSON")
+	ErrDraftConflict      = errors.New("draft was changed in another tab")
+)
+
+// draftPermissions is the subforum permission needed to keep a draft for each target type.
+var draftPermissions = map[string]string{
+	Entities.DraftPost:    "subforum_post",
+	Entities.DraftTopic:   "subforum_create_general_topic",
+	Entities.DraftEpisode: "subforum_create_episode_topic",
+}
+
+const draftSelect = "SELECT id, user_id, target_type, target_id, content, data, revision, published, date_updated FROM drafts"
+
+func scanDraft(row interface{ Scan(...interface{}) error }) (*Entities.Draft, error) {
+	var draft Entities.Draft
+	var data []byte
+	if err := row.Scan(&draft.Id, &draft.UserId, &draft.TargetType, &draft.TargetId, &draft.Content, &data, &draft.Revision, &draft.Published, &draft.DateUpdated); err != nil {
+		return nil, err
+	}
+	draft.Data = json.RawMessage(data)
+	return &draft, nil
+}
+
+// CheckDraftTarget makes sure the target exists and the user could publish there.
+func CheckDraftTarget(userID int, targetType string, targetID int, db DBExecutor) error {
+	if targetType == Entities.DraftCharacter {
+		if targetID != 0 {
+			return ErrInvalidDraftTarget
+		}
+		return nil
+	}
+	permission, ok := draftPermissions[targetType]
+	if !ok || targetID <= 0 {
+		return ErrInvalidDraftTarget
+	}
+
+	subforumID := targetID
+	if targetType == Entities.DraftPost {
+		var err error
+		if subforumID, err = GetTopicSubforum(targetID, db); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidDraftTarget
+			}
+			return err
+		}
+	}
+	allowed, err := HasSubforumPermission(userID, permission, subforumID, db)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrDraftForbidden
+	}
+	return nil
+}
+
+// GetDraft also returns the empty draft left by publishing, whose revision the next save must be based on.
+func GetDraft(userID int, targetType string, targetID int, db DBExecutor) (*Entities.Draft, error) {
+	return scanDraft(db.QueryRow(draftSelect+" WHERE user_id = ? AND target_type = ? AND target_id = ?", userID, targetType, targetID))
+}
+
+// GetDrafts lists a user's unpublished drafts, most recently saved first.
+func GetDrafts(userID int, db DBExecutor) ([]Entities.Draft, error) {
+	rows, err := db.Query(draftSelect+" WHERE user_id = ? AND published = 0 ORDER BY date_updated DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drafts := []Entities.Draft{}
+	for rows.Next() {
+		draft, err := scanDraft(rows)
+		if err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, *draft)
+	}
+	return drafts, rows.Err()
+}
+
+// SaveDraft stores a draft if baseRevision is the revision the client last saw, 0 for a new
+// draft. Otherwise it returns ErrDraftConflict with the stored draft, which is marked published if
+// it was published meanwhile, or nil if it was discarded, for the client to merge or overwrite
+// with the new revision.
+func SaveDraft(userID int, targetType string, targetID int, content string, data json.RawMessage, baseRevision int, db DBExecutor) (*Entities.Draft, error) {
+	if len(data) == 0 || string(data) == "null" {
+		data = json.RawMessage("{}")
+	}
+	if len(content) > maxDraftContent || len(data) > maxDraftData {
+		return nil, ErrDraftTooLarge
+	}
+	if !json.Valid(data) {
+		return nil, ErrInvalidDraftData
+	}
+
+	var affected int64
+	if baseRevision == 0 {
+		// Only creates: an existing draft means another tab got there first
+		_, err := db.Exec("INSERT INTO drafts (user_id, target_type, target_id, content, data, revision, date_updated) VALUES (?, ?, ?, ?, ?, 1, NOW())",
+			userID, targetType, targetID, content, string(data))
+		if err != nil && !isDuplicateKey(err) {
+			return nil, err
+		}
+		if err == nil {
+			affected = 1
+		}
+	} else {
+		res, err := db.Exec("UPDATE drafts SET content = ?, data = ?, revision = revision + 1, published = 0, date_updated = NOW() WHERE user_id = ? AND target_type = ? AND target_id = ? AND revision = ?",
+			content, string(data), userID, targetType, targetID, baseRevision)
+		if err != nil {
+			return nil, err
+		}
+		if affected, err = res.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+
+	draft, err := GetDraft(userID, targetType, targetID, db)
+	if err == sql.ErrNoRows {
+		draft, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return draft, ErrDraftConflict
+	}
+	return draft, nil
+}
+
+// PublishDraftSaved tells all of the user's tabs about a new revision.
+func PublishDraftSaved(db *sql.DB, tabID string, draft *Entities.Draft) {
+	Events.Publish(db, Events.DraftChanged, Events.DraftChangedEvent{
+		Type:       "draft_saved",
+		TabId:      tabID,
+		UserID:     draft.UserId,
+		TargetType: draft.TargetType,
+		TargetId:   draft.TargetId,
+		Draft:      draft,
+	})
+}
+
+// DiscardDraft deletes a draft the user gave up and tells the user's tabs.
+func DiscardDraft(userID int, targetType string, targetID int, tabID string, db *sql.DB) error {
+	if _, err := db.Exec("DELETE FROM drafts WHERE user_id = ? AND target_type = ? AND target_id = ?", userID, targetType, targetID); err != nil {
+		return err
+	}
+	Events.Publish(db, Events.DraftChanged, Events.DraftChangedEvent{
+		Type:       "draft_deleted",
+		TabId:      tabID,
+		UserID:     userID,
+		TargetType: targetType,
+		TargetId:   targetID,
+	})
+	return nil
+}
+
+// MarkDraftPublished empties the draft of something that was just published and tells the user's
+// tabs. The row stays with a new revision, so an autosave sent before publishing, even one
+// creating the draft, conflicts instead of bringing the text back.
+func MarkDraftPublished(userID int, targetType string, targetID int, db *sql.DB) error {
+	if _, err := db.Exec(`
+		INSERT INTO drafts (user_id, target_type, target_id, content, data, revision, published, date_updated)
+		VALUES (?, ?, ?, '', '{}', 1, 1, NOW())
+		ON DUPLICATE KEY UPDATE content = '', data = '{}', revision = revision + 1, published = 1, date_updated = NOW()`,
+		userID, targetType, targetID); err != nil {
+		return err
+	}
+	draft, err := GetDraft(userID, targetType, targetID, db)
+	if err != nil {
+		return err
+	}
+	Events.Publish(db, Events.DraftChanged, Events.DraftChangedEvent{
+		Type:       "draft_deleted",
+		UserID:     userID,
+		TargetType: targetType,
+		TargetId:   targetID,
+		Draft:      draft,
+	})
+	return nil
+}
+
+// CleanupExpiredDrafts removes drafts that haven't been saved for draft_expiry_days.
+func CleanupExpiredDrafts(db *sql.DB) (int, error) {
+	days, err := GetGlobalSettingInt("draft_expiry_days", 30, db)
+	if err != nil {
+		return 0, err
+	}
+	res, err := db.Exec("DELETE FROM drafts WHERE date_updated < NOW() - INTERVAL ? DAY", days)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := res.RowsAffected()
+	return int(removed), err
+}
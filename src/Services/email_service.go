@@ -0,0 +1,201 @@
+package Services
+
+import (
+	"cuento-backend/config"
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"cuento-backend/src/Mail"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Emails fall back to this mode for users who never changed their preferences
+const DefaultEmailMode = Entities.EmailModeDaily
+
+// Maximum number of notifications listed in a single digest
+const digestNotificationLimit = 50
+
+var Mailer *Mail.Mailer
+
+func InitMailer(cfg *config.MailConfig) {
+	transport, err := Mail.NewTransport(cfg)
+	if err != nil {
+		log.Fatalf("Error configuring mail transport: %v", err)
+	}
+	Mailer = Mail.NewMailer(transport, cfg.BaseURL)
+}
+
+type mailRecipient struct {
+	UserID   int
+	Username string
+	Email    string
+	Language string
+}
+
+func getMailRecipient(userID int, db DBExecutor) (*mailRecipient, error) {
+	var r mailRecipient
+	var email, language sql.NullString
+	err := db.QueryRow("SELECT id, username, email, interface_language FROM users WHERE id = ?", userID).
+		Scan(&r.UserID, &r.Username, &email, &language)
+	if err != nil {
+		return nil, err
+	}
+	r.Email = email.String
+	r.Language = language.String
+	return &r, nil
+}
+
+func GetEmailPreferences(userID int, db DBExecutor) (*Entities.EmailPreferences, error) {
+	prefs := Entities.EmailPreferences{UserId: userID, Mode: DefaultEmailMode}
+	err := db.QueryRow("SELECT email_mode, date_last_digest FROM user_email_preferences WHERE user_id = ?", userID).
+		Scan(&prefs.Mode, &prefs.DateLastDigest)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+func SetEmailMode(userID int, mode Entities.EmailMode, db DBExecutor) error {
+	_, err := db.Exec(`INSERT INTO user_email_preferences (user_id, email_mode) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE email_mode = VALUES(email_mode)`, userID, mode)
+	return err
+}
+
+// SendInstantNotificationEmail mails a single notification to users who asked for instant emails
+// and are not connected right now. Delivered notifications are not repeated in the digest.
+func SendInstantNotificationEmail(event Events.NotificationEvent, connected bool, db DBExecutor) error {
+	if Mailer == nil || event.Id == 0 || connected {
+		return nil
+	}
+
+	prefs, err := GetEmailPreferences(event.UserID, db)
+	if err != nil {
+		return err
+	}
+	if prefs.Mode != Entities.EmailModeInstant {
+		return nil
+	}
+
+	recipient, err := getMailRecipient(event.UserID, db)
+	if err != nil {
+		return err
+	}
+	if recipient.Email == "" {
+		return nil
+	}
+
+	err = Mailer.Send(recipient.Email, recipient.Language, "notification", map[string]interface{}{
+		"Username": recipient.Username,
+		"Message":  event.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE notifications SET date_emailed = NOW() WHERE id = ?", event.Id)
+	return err
+}
+
+// getDigestRecipients finds users on the daily digest who have unread, not yet emailed notifications
+// and haven't received a digest in the last day.
+func getDigestRecipients(now time.Time, db DBExecutor) ([]mailRecipient, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT u.id, u.username, u.email, u.interface_language
+		FROM notifications n
+		JOIN users u ON n.user_id = u.id
+		LEFT JOIN user_email_preferences p ON p.user_id = u.id
+		WHERE n.is_read = FALSE AND n.date_emailed IS NULL
+			AND u.email IS NOT NULL AND u.email != ''
+			AND COALESCE(p.email_mode, ?) = ?
+			AND (p.date_last_digest IS NULL OR p.date_last_digest <= ?)`,
+		DefaultEmailMode, Entities.EmailModeDaily, now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []mailRecipient
+	for rows.Next() {
+		var r mailRecipient
+		var language sql.NullString
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email, &language); err != nil {
+			return nil, err
+		}
+		r.Language = language.String
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+func sendDigest(recipient mailRecipient, db *sql.DB) error {
+	rows, err := db.Query(`
+		SELECT id, user_id, type, message, data, is_read, date_created, date_read
+		FROM notifications
+		WHERE user_id = ? AND is_read = FALSE AND date_emailed IS NULL
+		ORDER BY date_created ASC, id ASC
+		LIMIT ?`, recipient.UserID, digestNotificationLimit)
+	if err != nil {
+		return err
+	}
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		return err
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	err = Mailer.Send(recipient.Email, recipient.Language, "digest", map[string]interface{}{
+		"Username":      recipient.Username,
+		"Notifications": notifications,
+	})
+	if err != nil {
+		return err
+	}
+
+	lastID := notifications[len(notifications)-1].Id
+	if _, err := db.Exec("UPDATE notifications SET date_emailed = NOW() WHERE user_id = ? AND is_read = FALSE AND date_emailed IS NULL AND id <= ?",
+		recipient.UserID, lastID); err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO user_email_preferences (user_id, email_mode, date_last_digest) VALUES (?, ?, NOW())
+		ON DUPLICATE KEY UPDATE date_last_digest = NOW()`, recipient.UserID, DefaultEmailMode)
+	return err
+}
+
+// RunDigestBuilder sends one digest to every user who is due for one.
+// A failure for one user doesn't stop the others.
+func RunDigestBuilder(db *sql.DB) error {
+	if Mailer == nil {
+		return nil
+	}
+
+	recipients, err := getDigestRecipients(time.Now(), db)
+	if err != nil {
+		return fmt.Errorf("failed to find digest recipients: %w", err)
+	}
+
+	for _, recipient := range recipients {
+		if err := sendDigest(recipient, db); err != nil {
+			fmt.Printf("Error sending digest to user %d: %v\n", recipient.UserID, err)
+		}
+	}
+	return nil
+}
+
+// StartDigestScheduler runs the digest builder in the background for the lifetime of the process.
+func StartDigestScheduler(db *sql.DB) {
+	for {
+		if err := RunDigestBuilder(db); err != nil {
+			fmt.Printf("Error running digest builder: %v\n", err)
+		}
+
+		interval, err := GetGlobalSettingInt("email_digest_interval_minutes", 60, db)
+		if err != nil || interval <= 0 {
+			interval = 60
+		}
+		time.Sleep(time.Duration(interval) * time.Minute)
+	}
+}
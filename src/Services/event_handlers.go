@@ -1,6 +1,7 @@
 package Services
 
 import (
+	"cuento-backend/src/Entities"
 	"cuento-backend/src/Events"
 	"cuento-backend/src/Websockets"
 	"database/sql"
@@ -41,13 +42,27 @@ func RegisterEventHandlers(db *sql.DB) {
 		}
 	})
 
-	// Subscriber 3: Send Live Notifications
+	// Subscriber 3: Store Notifications and Send Them Live or by Email
 	Events.Subscribe(Events.NotificationCreated, func(db *sql.DB, data Events.EventData) {
 		event, ok := data.(Events.NotificationEvent)
 		if !ok {
 			return
 		}
+
+		// Persist first so offline users and full send buffers don't lose the notification
+		id, err := CreateNotification(event, db)
+		if err != nil {
+			fmt.Printf("Error storing notification: %v\n", err)
+		} else {
+			event.Id = id
+		}
+		connected := Websockets.MainHub.IsConnected(event.UserID)
 		Websockets.MainHub.SendNotification(event.UserID, event)
+
+		// Users who are away and asked for instant emails get one right away
+		if err := SendInstantNotificationEmail(event, connected, db); err != nil {
+			fmt.Printf("Error sending notification email: %v\n", err)
+		}
 	})
 
 	// Subscriber 4: Notify Topic Viewers
@@ -121,8 +136,8 @@ func RegisterEventHandlers(db *sql.DB) {
 		}
 
 		// 2. Update Topic Stats
-		_, err = db.Exec("UPDATE topics SET post_number = post_number + 1, date_last_post = NOW(), last_post_author_user_id = ? WHERE id = ?",
-			event.Post.AuthorUserId, event.TopicID)
+		_, err = db.Exec("UPDATE topics SET post_number = post_number + 1, date_last_post = NOW(), last_post_id = ?, last_post_author_user_id = ? WHERE id = ?",
+			event.Post.Id, event.Post.AuthorUserId, event.TopicID)
 		if err != nil {
 			fmt.Printf("Error updating topic stats: %v\n", err)
 		}
@@ -149,4 +164,186 @@ func RegisterEventHandlers(db *sql.DB) {
 			fmt.Printf("Error updating subforum stats: %v\n", err)
 		}
 	})
+
+	// Subscriber 7: Auto-subscribe Post Authors to the Topic
+	Events.Subscribe(Events.PostCreated, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.PostCreatedEvent)
+		if !ok {
+			return
+		}
+
+		if err := Subscribe(event.Post.AuthorUserId, Entities.TopicSubscription, int(event.TopicID), db); err != nil {
+			fmt.Printf("Error subscribing post author: %v\n", err)
+		}
+	})
+
+	// Subscriber 8: Notify Topic and Subforum Subscribers
+	Events.Subscribe(Events.PostCreated, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.PostCreatedEvent)
+		if !ok {
+			return
+		}
+
+		subscribers, err := GetTopicSubscribers(event.TopicID, event.SubforumID, db)
+		if err != nil {
+			fmt.Printf("Error fetching topic subscribers: %v\n", err)
+			return
+		}
+		if len(subscribers) == 0 {
+			return
+		}
+
+		// Users reading the topic already get the post through the "new_post" push
+		viewing := make(map[int]bool)
+		for _, u := range ActivityStorage.GetUsersOnPage("topic", strconv.FormatInt(event.TopicID, 10)) {
+			viewing[u.UserID] = true
+		}
+
+		var topicName string
+		_ = db.QueryRow("SELECT name FROM topics WHERE id = ?", event.TopicID).Scan(&topicName)
+
+		author := ""
+		if event.Post.CharacterProfile != nil {
+			author = event.Post.CharacterProfile.CharacterName
+		} else if event.Post.UserProfile != nil {
+			author = event.Post.UserProfile.UserName
+		}
+
+		for _, userID := range subscribers {
+			if userID == event.Post.AuthorUserId || viewing[userID] {
+				continue
+			}
+			// Access may have been lost since subscribing
+			allowed, err := HasSubforumPermission(userID, "subforum_read", event.SubforumID, db)
+			if err != nil {
+				fmt.Printf("Error checking subscriber %d's access: %v\n", userID, err)
+				continue
+			}
+			if !allowed {
+				continue
+			}
+			Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+				UserID:  userID,
+				Type:    "subscription",
+				Message: fmt.Sprintf("New post by %s in %s", author, topicName),
+				Data: map[string]interface{}{
+					"topic_id": event.TopicID,
+					"post_id":  event.Post.Id,
+				},
+			})
+		}
+	})
+
+	// Subscriber 9: Update Character Activity on Post Created
+	Events.Subscribe(Events.PostCreated, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.PostCreatedEvent)
+		if !ok {
+			return
+		}
+
+		if !event.Post.UseCharacterProfile || event.Post.CharacterProfile == nil {
+			return
+		}
+
+		_, err := db.Exec("UPDATE character_base SET total_posts = total_posts + 1, date_last_post = NOW() WHERE id = ?",
+			event.Post.CharacterProfile.CharacterId)
+		if err != nil {
+			fmt.Printf("Error updating character activity: %v\n", err)
+		}
+	})
+
+	// Subscriber 10: Deliver Private Messages Live
+	Events.Subscribe(Events.MessageCreated, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.MessageCreatedEvent)
+		if !ok {
+			return
+		}
+
+		for _, userID := range event.Receivers {
+			Websockets.MainHub.SendNotification(userID, map[string]interface{}{
+				"type": "private_message",
+				"data": event.Message,
+			})
+		}
+	})
+
+	// Subscriber 11: Send Read Receipts to Other Participants
+	Events.Subscribe(Events.ConversationRead, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.ConversationReadEvent)
+		if !ok {
+			return
+		}
+
+		for _, userID := range event.Receivers {
+			Websockets.MainHub.SendNotification(userID, map[string]interface{}{
+				"type": "conversation_read",
+				"data": event,
+			})
+		}
+	})
+
+	// Subscriber 12: Notify Authors of Quoted Posts
+	Events.Subscribe(Events.PostCreated, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.PostCreatedEvent)
+		if !ok || len(event.Post.QuotedPostIds) == 0 {
+			return
+		}
+
+		author := ""
+		if event.Post.CharacterProfile != nil {
+			author = event.Post.CharacterProfile.CharacterName
+		} else if event.Post.UserProfile != nil {
+			author = event.Post.UserProfile.UserName
+		}
+		notifyQuotedAuthors(event.Post.QuotedPostIds, event.Post.AuthorUserId, author, event.TopicID, event.SubforumID, int64(event.Post.Id), db)
+	})
+
+	// Subscriber 13: Keep a User's Tabs in Sync with Their Drafts
+	Events.Subscribe(Events.DraftChanged, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.DraftChangedEvent)
+		if !ok {
+			return
+		}
+
+		Websockets.MainHub.SendNotification(event.UserID, event)
+	})
+
+	// Subscriber 14: Notify Authors of Posts Quoted in an Opening Post
+	Events.Subscribe(Events.TopicCreated, func(db *sql.DB, data Events.EventData) {
+		event, ok := data.(Events.TopicCreatedEvent)
+		if !ok || len(event.QuotedPostIDs) == 0 {
+			return
+		}
+
+		notifyQuotedAuthors(event.QuotedPostIDs, event.UserID, event.Username, event.TopicID, event.SubforumID, event.PostID, db)
+	})
+}
+
+// notifyQuotedAuthors sends a quote notification to the authors of the quoted posts who can read the new post.
+func notifyQuotedAuthors(quotedPostIDs []int, authorUserID int, author string, topicID int64, subforumID int, postID int64, db *sql.DB) {
+	authors, err := GetQuotedAuthors(quotedPostIDs, db)
+	if err != nil {
+		fmt.Printf("Error getting quoted authors: %v\n", err)
+		return
+	}
+
+	for _, userID := range authors {
+		if userID == authorUserID {
+			continue
+		}
+		// Quoting a public post from a private topic mustn't point its author there
+		canRead, err := HasSubforumPermission(userID, "subforum_read", subforumID, db)
+		if err != nil || !canRead {
+			continue
+		}
+		Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+			UserID:  userID,
+			Type:    "quote",
+			Message: fmt.Sprintf("%s quoted your post", author),
+			Data: map[string]interface{}{
+				"topic_id": topicID,
+				"post_id":  postID,
+			},
+		})
+	}
 }
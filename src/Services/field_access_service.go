@@ -0,0 +1,127 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrFieldNotEditable = errors.New("custom field can't be changed by this user")
+
+// Moderation permission that lets a user act as the owner of any entity of a type
+var entityModerationPermissions = map[string]string{
+	"character":         "moderate_characters",
+	"character_profile": "moderate_characters",
+	"episode":           "moderate_episodes",
+}
+
+// Queries returning the user who owns an entity of each custom entity type
+var entityOwnerQueries = map[string]string{
+	"character":         "SELECT user_id FROM character_base WHERE id = ?",
+	"character_profile": "SELECT cb.user_id FROM character_profile_base cp JOIN character_base cb ON cp.character_id = cb.id WHERE cp.id = ?",
+	"episode":           "SELECT t.author_user_id FROM episode_base e JOIN topics t ON e.topic_id = t.id WHERE e.id = ?",
+	"wanted_character":  "SELECT author_user_id FROM wanted_character_base WHERE id = ?",
+	"user":              "SELECT id FROM users WHERE id = ?",
+}
+
+// FieldAccess describes how a viewer relates to one entity, which decides the custom fields
+// they can see and change. A nil *FieldAccess is used for internal reads and allows everything.
+type FieldAccess struct {
+	ViewerID    int
+	IsOwner     bool
+	IsModerator bool // holds the moderation permission for the entity type
+	IsStaff     bool
+}
+
+// ActsAsOwner is true for the owner and for moderators, who can do whatever the owner can.
+func (a *FieldAccess) ActsAsOwner() bool {
+	return a.IsOwner || a.IsModerator
+}
+
+func (a *FieldAccess) CanView(field Entities.CustomFieldConfig) bool {
+	if a == nil || a.IsStaff {
+		return true
+	}
+	switch field.Visibility {
+	case Entities.FieldVisibilityStaff:
+		return false
+	case Entities.FieldVisibilityOwner:
+		return a.ActsAsOwner()
+	case Entities.FieldVisibilityMembers:
+		return a.ViewerID != 0
+	default:
+		return true
+	}
+}
+
+func (a *FieldAccess) CanEdit(field Entities.CustomFieldConfig) bool {
+	if a == nil || a.IsStaff {
+		return true
+	}
+	if field.EditableBy == Entities.FieldEditorStaff {
+		return false
+	}
+	return a.ActsAsOwner() && a.CanView(field)
+}
+
+// GetFieldAccess works out the access viewerID has to an entity and its custom fields.
+// It returns sql.ErrNoRows if the entity doesn't exist.
+func GetFieldAccess(className string, id int64, viewerID int, db DBExecutor) (*FieldAccess, error) {
+	access := &FieldAccess{ViewerID: viewerID}
+	if viewerID == 0 {
+		return access, nil
+	}
+
+	var err error
+	if access.IsStaff, err = IsStaff(viewerID, db); err != nil {
+		return nil, err
+	}
+
+	if query, ok := entityOwnerQueries[className]; ok {
+		var ownerID sql.NullInt64
+		if err := db.QueryRow(query, id).Scan(&ownerID); err != nil {
+			return nil, err
+		}
+		access.IsOwner = ownerID.Valid && int(ownerID.Int64) == viewerID
+	}
+	if permission, ok := entityModerationPermissions[className]; ok {
+		if access.IsModerator, err = HasModerationPermission(viewerID, permission, db); err != nil {
+			return nil, err
+		}
+	}
+	return access, nil
+}
+
+// GetCreatorFieldAccess is the access userID has to an entity they are creating, which they will own.
+func GetCreatorFieldAccess(className string, userID int, db DBExecutor) (*FieldAccess, error) {
+	access := &FieldAccess{ViewerID: userID, IsOwner: true}
+	var err error
+	if access.IsStaff, err = IsStaff(userID, db); err != nil {
+		return nil, err
+	}
+	if permission, ok := entityModerationPermissions[className]; ok {
+		if access.IsModerator, err = HasModerationPermission(userID, permission, db); err != nil {
+			return nil, err
+		}
+	}
+	return access, nil
+}
+
+// CheckEditableFields returns ErrFieldNotEditable for the first submitted custom field access
+// can't edit. A nil access allows everything.
+func CheckEditableFields[V any](className string, fields map[string]V, access *FieldAccess, db DBExecutor) error {
+	if len(fields) == 0 || access == nil {
+		return nil
+	}
+	config, err := getFieldConfig(className, db)
+	if err != nil {
+		return err
+	}
+	for _, field := range config {
+		if _, ok := fields[field.MachineFieldName]; ok && !access.CanEdit(field) {
+			return fmt.Errorf("%w: %s", ErrFieldNotEditable, field.MachineFieldName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type InactivitySettings struct {
+	Enabled               bool `json:"enabled"`
+	CheckIntervalMinutes  int  `json:"check_interval_minutes"`
+	CharacterWarningDays  int  `json:"character_warning_days"`
+	CharacterInactiveDays int  `json:"character_inactive_days"`
+	EpisodeWarningDays    int  `json:"episode_warning_days"`
+	EpisodeOnHoldDays     int  `json:"episode_on_hold_days"`
+}
+
+type InactivityActionType string
+
+const (
+	InactivityWarn         InactivityActionType = "warn"
+	InactivityStatusChange InactivityActionType = "status_change"
+)
+
+type InactivityAction struct {
+	Action       InactivityActionType `json:"action"`
+	EntityType   string               `json:"entity_type"`
+	EntityId     int                  `json:"entity_id"`
+	Name         string               `json:"name"`
+	OwnerUserId  int                  `json:"owner_user_id"`
+	LastActivity time.Time            `json:"last_activity"`
+	DaysInactive int                  `json:"days_inactive"`
+	OldStatus    int                  `json:"old_status"`
+	NewStatus    int                  `json:"new_status"`
+}
+
+type InactivityReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Settings    InactivitySettings `json:"settings"`
+	Actions     []InactivityAction `json:"actions"`
+}
+
+type StatusChangeLogEntry struct {
+	Id          int       `json:"id"`
+	EntityType  string    `json:"entity_type"`
+	EntityId    int       `json:"entity_id"`
+	OldStatus   int       `json:"old_status"`
+	NewStatus   int       `json:"new_status"`
+	Reason      string    `json:"reason"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// LoadInactivitySettings reads the inactivity thresholds from global_settings.
+// A threshold of 0 disables the corresponding check.
+func LoadInactivitySettings(db DBExecutor) (InactivitySettings, error) {
+	settings := InactivitySettings{}
+	var err error
+
+	if settings.Enabled, err = GetGlobalSettingBool("inactivity_enabled", false, db); err != nil {
+		return settings, err
+	}
+	if settings.CheckIntervalMinutes, err = GetGlobalSettingInt("inactivity_check_interval_minutes", 60, db); err != nil {
+		return settings, err
+	}
+	if settings.CharacterWarningDays, err = GetGlobalSettingInt("inactivity_character_warning_days", 21, db); err != nil {
+		return settings, err
+	}
+	if settings.CharacterInactiveDays, err = GetGlobalSettingInt("inactivity_character_inactive_days", 30, db); err != nil {
+		return settings, err
+	}
+	if settings.EpisodeWarningDays, err = GetGlobalSettingInt("inactivity_episode_warning_days", 45, db); err != nil {
+		return settings, err
+	}
+	if settings.EpisodeOnHoldDays, err = GetGlobalSettingInt("inactivity_episode_on_hold_days", 60, db); err != nil {
+		return settings, err
+	}
+
+	if settings.CheckIntervalMinutes < 1 {
+		settings.CheckIntervalMinutes = 60
+	}
+	return settings, nil
+}
+
+// BuildInactivityReport computes the warnings and status changes the scheduler would
+// perform right now without applying any of them.
+func BuildInactivityReport(db *sql.DB) (*InactivityReport, error) {
+	settings, err := LoadInactivitySettings(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inactivity settings: %w", err)
+	}
+
+	now := time.Now()
+	report := &InactivityReport{
+		GeneratedAt: now,
+		Settings:    settings,
+		Actions:     []InactivityAction{},
+	}
+
+	// 1. Characters with no posts for too long
+	if settings.CharacterInactiveDays > 0 {
+		query := `
+			SELECT c.id, c.name, c.user_id, c.character_status,
+				COALESCE(c.date_last_post, t.date_created) AS last_activity,
+				w.date_warned
+			FROM character_base c
+			LEFT JOIN topics t ON c.topic_id = t.id
+			LEFT JOIN inactivity_warnings w ON w.entity_type = 'character' AND w.entity_id = c.id
+			WHERE c.character_status = ?`
+		rows, err := db.Query(query, Entities.ActiveCharacter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get characters: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var action InactivityAction
+			var userID sql.NullInt64
+			var lastActivity, dateWarned sql.NullTime
+			if err := rows.Scan(&action.EntityId, &action.Name, &userID, &action.OldStatus, &lastActivity, &dateWarned); err != nil {
+				return nil, fmt.Errorf("failed to scan character: %w", err)
+			}
+			if !lastActivity.Valid {
+				continue
+			}
+			action.EntityType = "character"
+			action.OwnerUserId = int(userID.Int64)
+			action.LastActivity = lastActivity.Time
+			action.NewStatus = int(Entities.InactiveCharacter)
+
+			if decideInactivityAction(&action, dateWarned, settings.CharacterWarningDays, settings.CharacterInactiveDays, now) {
+				report.Actions = append(report.Actions, action)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Episodes whose topic has had no posts for too long
+	if settings.EpisodeOnHoldDays > 0 {
+		query := `
+			SELECT e.id, e.name, t.author_user_id, t.status,
+				COALESCE(t.date_last_post, t.date_created) AS last_activity,
+				w.date_warned
+			FROM episode_base e
+			JOIN topics t ON e.topic_id = t.id
+			LEFT JOIN inactivity_warnings w ON w.entity_type = 'episode' AND w.entity_id = e.id
+			WHERE t.status = ?`
+		rows, err := db.Query(query, Entities.ActiveTopic)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get episodes: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var action InactivityAction
+			var lastActivity, dateWarned sql.NullTime
+			if err := rows.Scan(&action.EntityId, &action.Name, &action.OwnerUserId, &action.OldStatus, &lastActivity, &dateWarned); err != nil {
+				return nil, fmt.Errorf("failed to scan episode: %w", err)
+			}
+			if !lastActivity.Valid {
+				continue
+			}
+			action.EntityType = "episode"
+			action.LastActivity = lastActivity.Time
+			action.NewStatus = int(Entities.OnHoldTopic)
+
+			if decideInactivityAction(&action, dateWarned, settings.EpisodeWarningDays, settings.EpisodeOnHoldDays, now) {
+				report.Actions = append(report.Actions, action)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// decideInactivityAction fills in the action type and reports whether anything should happen.
+// An owner is always warned before a status change, and the change only happens once the
+// warning is older than the grace period between the two thresholds.
+func decideInactivityAction(action *InactivityAction, dateWarned sql.NullTime, warningDays int, changeDays int, now time.Time) bool {
+	action.DaysInactive = int(now.Sub(action.LastActivity).Hours() / 24)
+
+	if warningDays <= 0 || warningDays > changeDays {
+		warningDays = changeDays
+	}
+	graceDays := changeDays - warningDays
+
+	// A warning only counts if it was sent after the last activity
+	warned := dateWarned.Valid && !dateWarned.Time.Before(action.LastActivity)
+
+	if action.DaysInactive >= warningDays && !warned {
+		action.Action = InactivityWarn
+		return true
+	}
+
+	if action.DaysInactive >= changeDays && warned && now.Sub(dateWarned.Time) >= time.Duration(graceDays)*24*time.Hour {
+		action.Action = InactivityStatusChange
+		return true
+	}
+
+	return false
+}
+
+// ApplyInactivityReport sends the warnings and performs the status changes listed in the report.
+func ApplyInactivityReport(report *InactivityReport, db *sql.DB) error {
+	for _, action := range report.Actions {
+		switch action.Action {
+		case InactivityWarn:
+			if err := warnInactiveOwner(action, db); err != nil {
+				return err
+			}
+		case InactivityStatusChange:
+			if err := applyInactivityStatusChange(action, db); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func warnInactiveOwner(action InactivityAction, db *sql.DB) error {
+	_, err := db.Exec("INSERT INTO inactivity_warnings (entity_type, entity_id, date_warned) VALUES (?, ?, NOW()) ON DUPLICATE KEY UPDATE date_warned = NOW()",
+		action.EntityType, action.EntityId)
+	if err != nil {
+		return fmt.Errorf("failed to record inactivity warning for %s %d: %w", action.EntityType, action.EntityId, err)
+	}
+
+	if action.OwnerUserId == 0 {
+		return nil
+	}
+
+	var message string
+	if action.EntityType == "character" {
+		message = fmt.Sprintf("Your character %s has not posted for %d days and will be marked inactive soon", action.Name, action.DaysInactive)
+	} else {
+		message = fmt.Sprintf("Your episode %s has had no posts for %d days and will be put on hold soon", action.Name, action.DaysInactive)
+	}
+
+	Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+		UserID:  action.OwnerUserId,
+		Type:    "inactivity_warning",
+		Message: message,
+		Data: map[string]interface{}{
+			"entity_type": action.EntityType,
+			"entity_id":   action.EntityId,
+		},
+	})
+	return nil
+}
+
+func applyInactivityStatusChange(action InactivityAction, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	if action.EntityType == "character" {
+		res, err = tx.Exec("UPDATE character_base SET character_status = ? WHERE id = ? AND character_status = ?",
+			action.NewStatus, action.EntityId, action.OldStatus)
+	} else {
+		res, err = tx.Exec("UPDATE topics t JOIN episode_base e ON e.topic_id = t.id SET t.status = ? WHERE e.id = ? AND t.status = ?",
+			action.NewStatus, action.EntityId, action.OldStatus)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update %s %d status: %w", action.EntityType, action.EntityId, err)
+	}
+
+	// Someone changed the status in the meantime, nothing to record
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil
+	}
+
+	reason := fmt.Sprintf("No activity for %d days", action.DaysInactive)
+	_, err = tx.Exec("INSERT INTO status_change_log (entity_type, entity_id, old_status, new_status, reason, date_created) VALUES (?, ?, ?, ?, ?, NOW())",
+		action.EntityType, action.EntityId, action.OldStatus, action.NewStatus, reason)
+	if err != nil {
+		return fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM inactivity_warnings WHERE entity_type = ? AND entity_id = ?", action.EntityType, action.EntityId); err != nil {
+		return fmt.Errorf("failed to clear inactivity warning: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if action.OwnerUserId == 0 {
+		return nil
+	}
+
+	var message string
+	if action.EntityType == "character" {
+		message = fmt.Sprintf("Your character %s has been marked inactive", action.Name)
+	} else {
+		message = fmt.Sprintf("Your episode %s has been put on hold", action.Name)
+	}
+
+	Events.Publish(db, Events.NotificationCreated, Events.NotificationEvent{
+		UserID:  action.OwnerUserId,
+		Type:    "inactivity_status_change",
+		Message: message,
+		Data: map[string]interface{}{
+			"entity_type": action.EntityType,
+			"entity_id":   action.EntityId,
+			"new_status":  action.NewStatus,
+		},
+	})
+	return nil
+}
+
+func GetStatusChangeLog(page int, db *sql.DB) ([]StatusChangeLogEntry, error) {
+	limit := 50
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	rows, err := db.Query("SELECT id, entity_type, entity_id, old_status, new_status, COALESCE(reason, ''), date_created FROM status_change_log ORDER BY date_created DESC, id DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []StatusChangeLogEntry{}
+	for rows.Next() {
+		var entry StatusChangeLogEntry
+		if err := rows.Scan(&entry.Id, &entry.EntityType, &entry.EntityId, &entry.OldStatus, &entry.NewStatus, &entry.Reason, &entry.DateCreated); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// RunInactivityCheck builds the report and applies it if the scheduler is enabled.
+func RunInactivityCheck(db *sql.DB) error {
+	report, err := BuildInactivityReport(db)
+	if err != nil {
+		return err
+	}
+	if !report.Settings.Enabled {
+		return nil
+	}
+	return ApplyInactivityReport(report, db)
+}
+
+// StartInactivityScheduler runs the inactivity check in the background for the lifetime of the process.
+// The interval is re-read from the settings after every run so it can be changed without a restart.
+func StartInactivityScheduler(db *sql.DB) {
+	for {
+		if err := RunInactivityCheck(db); err != nil {
+			fmt.Printf("Error running inactivity check: %v\n", err)
+		}
+
+		interval := 60
+		if settings, err := LoadInactivitySettings(db); err == nil {
+			interval = settings.CheckIntervalMinutes
+		}
+		time.Sleep(time.Duration(interval) * time.Minute)
+	}
+}
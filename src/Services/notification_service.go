@@ -0,0 +1,94 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Events"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// CreateNotification stores the notification in the user's inbox and returns its ID.
+func CreateNotification(event Events.NotificationEvent, db DBExecutor) (int64, error) {
+	var data interface{}
+	if event.Data != nil {
+		encoded, err := json.Marshal(event.Data)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode notification data: %w", err)
+		}
+		data = string(encoded)
+	}
+
+	res, err := db.Exec("INSERT INTO notifications (user_id, type, message, data, is_read, date_created) VALUES (?, ?, ?, ?, FALSE, NOW())",
+		event.UserID, event.Type, event.Message, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert notification: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+func GetNotifications(userID int, page int, unreadOnly bool, db DBExecutor) ([]Entities.Notification, error) {
+	limit := 30
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	query := "SELECT id, user_id, type, message, data, is_read, date_created, date_read FROM notifications WHERE user_id = ?"
+	if unreadOnly {
+		query += " AND is_read = FALSE"
+	}
+	query += " ORDER BY date_created DESC, id DESC LIMIT ? OFFSET ?"
+
+	rows, err := db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotifications(rows)
+}
+
+func scanNotifications(rows *sql.Rows) ([]Entities.Notification, error) {
+	defer rows.Close()
+
+	notifications := []Entities.Notification{}
+	for rows.Next() {
+		var n Entities.Notification
+		var data []byte
+		if err := rows.Scan(&n.Id, &n.UserId, &n.Type, &n.Message, &data, &n.IsRead, &n.DateCreated, &n.DateRead); err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			n.Data = json.RawMessage(data)
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func GetUnreadNotificationCount(userID int, db DBExecutor) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = FALSE", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marks a single notification of the user as read.
+// It returns sql.ErrNoRows if the notification does not belong to the user.
+func MarkNotificationRead(userID int, id int64, db DBExecutor) error {
+	var owner int
+	if err := db.QueryRow("SELECT user_id FROM notifications WHERE id = ?", id).Scan(&owner); err != nil {
+		return err
+	}
+	if owner != userID {
+		return sql.ErrNoRows
+	}
+	_, err := db.Exec("UPDATE notifications SET is_read = TRUE, date_read = NOW() WHERE id = ? AND is_read = FALSE", id)
+	return err
+}
+
+func MarkAllNotificationsRead(userID int, db DBExecutor) (int64, error) {
+	res, err := db.Exec("UPDATE notifications SET is_read = TRUE, date_read = NOW() WHERE user_id = ? AND is_read = FALSE", userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
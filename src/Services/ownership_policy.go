@@ -0,0 +1,82 @@
+package Services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PolicyViolation explains which ownership rule refused a change.
+type PolicyViolation struct {
+	Rule string
+}
+
+func (e *PolicyViolation) Error() string {
+	return e.Rule
+}
+
+var entityHumanNames = map[string]string{
+	"character":         "character",
+	"character_profile": "character profile",
+	"episode":           "episode",
+}
+
+// Fields that can be sent to the patch endpoint of each entity type
+var patchableEntityFields = map[string][]string{
+	"character":         {"name", "avatar", "character_status", "custom_fields"},
+	"character_profile": {"avatar", "custom_fields"},
+	"episode":           {"name", "custom_fields"},
+}
+
+// Fields that even the owner can't change without the moderation permission
+var moderatedEntityFields = map[string][]string{
+	"character": {"character_status"},
+}
+
+// AuthorizeEntityMutation lets the owner of an entity, or a holder of the moderation permission
+// for its type, change it.
+func AuthorizeEntityMutation(className string, access *FieldAccess) error {
+	if access.ActsAsOwner() {
+		return nil
+	}
+	return &PolicyViolation{Rule: fmt.Sprintf("Only the owner of this %s or a role with the %s permission can change it",
+		entityHumanNames[className], entityModerationPermissions[className])}
+}
+
+// AuthorizeEntityPatch applies AuthorizeEntityMutation and then checks every field of the update:
+// unknown fields are refused and moderated ones need the moderation permission.
+func AuthorizeEntityPatch(className string, updates map[string]interface{}, access *FieldAccess) error {
+	if err := AuthorizeEntityMutation(className, access); err != nil {
+		return err
+	}
+
+	patchable := make(map[string]bool)
+	for _, field := range patchableEntityFields[className] {
+		patchable[field] = true
+	}
+	moderated := make(map[string]bool)
+	for _, field := range moderatedEntityFields[className] {
+		moderated[field] = true
+	}
+
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !patchable[key] {
+			if className == "character" && key == "user_id" {
+				return &PolicyViolation{Rule: "A character's owner can only be changed with a character transfer"}
+			}
+			return &PolicyViolation{Rule: fmt.Sprintf("Field %s can't be changed on %s, allowed fields are %s",
+				key, entityHumanNames[className], strings.Join(patchableEntityFields[className], ", "))}
+		}
+		if moderated[key] && !access.IsModerator {
+			return &PolicyViolation{Rule: fmt.Sprintf("Only a role with the %s permission can change %s",
+				entityModerationPermissions[className], key)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizeEntityPatch(t *testing.T) {
+	owner := &FieldAccess{ViewerID: 1, IsOwner: true}
+	moderator := &FieldAccess{ViewerID: 2, IsModerator: true}
+	stranger := &FieldAccess{ViewerID: 3}
+
+	tests := []struct {
+		name      string
+		className string
+		updates   map[string]interface{}
+		access    *FieldAccess
+		rule      string // empty when the patch is allowed
+	}{
+		{"owner renames character", "character", map[string]interface{}{"name": "Ann"}, owner, ""},
+		{"owner edits profile", "character_profile", map[string]interface{}{"avatar": "a.png", "custom_fields": map[string]interface{}{}}, owner, ""},
+		{"owner renames episode", "episode", map[string]interface{}{"name": "Prologue"}, owner, ""},
+		{"character moderator renames character", "character", map[string]interface{}{"name": "Ann"}, moderator, ""},
+		{"character moderator edits profile", "character_profile", map[string]interface{}{"avatar": "a.png"}, moderator, ""},
+		{"episode moderator renames episode", "episode", map[string]interface{}{"name": "Prologue"}, moderator, ""},
+		{"moderator changes status", "character", map[string]interface{}{"character_status": 1}, moderator, ""},
+		{
+			"stranger renames character", "character", map[string]interface{}{"name": "Ann"}, stranger,
+			"Only the owner of this character or a role with the moderate_characters permission can change it",
+		},
+		{
+			"stranger edits profile", "character_profile", map[string]interface{}{"avatar": "a.png"}, stranger,
+			"Only the owner of this character profile or a role with the moderate_characters permission can change it",
+		},
+		{
+			"stranger renames episode", "episode", map[string]interface{}{"name": "Prologue"}, stranger,
+			"Only the owner of this episode or a role with the moderate_episodes permission can change it",
+		},
+		{
+			"owner changes status", "character", map[string]interface{}{"character_status": 1}, owner,
+			"Only a role with the moderate_characters permission can change character_status",
+		},
+		{
+			"owner changes owner", "character", map[string]interface{}{"user_id": 5}, owner,
+			"A character's owner can only be changed with a character transfer",
+		},
+		{
+			"moderator changes owner", "character", map[string]interface{}{"user_id": 5}, moderator,
+			"A character's owner can only be changed with a character transfer",
+		},
+		{
+			"owner sets unknown field", "episode", map[string]interface{}{"topic_id": 7}, owner,
+			"Field topic_id can't be changed on episode, allowed fields are name, custom_fields",
+		},
+		{
+			"profile status is not patchable", "character_profile", map[string]interface{}{"character_status": 1}, moderator,
+			"Field character_status can't be changed on character profile, allowed fields are avatar, custom_fields",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AuthorizeEntityPatch(tt.className, tt.updates, tt.access)
+			if tt.rule == "" {
+				if err != nil {
+					t.Fatalf("expected patch to be allowed, got %v", err)
+				}
+				return
+			}
+			var violation *PolicyViolation
+			if !errors.As(err, &violation) {
+				t.Fatalf("expected a PolicyViolation, got %v", err)
+			}
+			if violation.Rule != tt.rule {
+				t.Errorf("rule = %q, want %q", violation.Rule, tt.rule)
+			}
+		})
+	}
+}
+
+func TestFieldAccess(t *testing.T) {
+	public := Entities.CustomFieldConfig{MachineFieldName: "bio"}
+	members := Entities.CustomFieldConfig{MachineFieldName: "age", Visibility: Entities.FieldVisibilityMembers}
+	ownerOnly := Entities.CustomFieldConfig{MachineFieldName: "secret", Visibility: Entities.FieldVisibilityOwner}
+	staffOnly := Entities.CustomFieldConfig{MachineFieldName: "gm_notes", Visibility: Entities.FieldVisibilityStaff}
+	staffEdited := Entities.CustomFieldConfig{MachineFieldName: "level", EditableBy: Entities.FieldEditorStaff}
+
+	guest := &FieldAccess{}
+	member := &FieldAccess{ViewerID: 3}
+	owner := &FieldAccess{ViewerID: 1, IsOwner: true}
+	moderator := &FieldAccess{ViewerID: 2, IsModerator: true}
+	staff := &FieldAccess{ViewerID: 4, IsStaff: true}
+	var internal *FieldAccess
+
+	tests := []struct {
+		name    string
+		access  *FieldAccess
+		field   Entities.CustomFieldConfig
+		canView bool
+		canEdit bool
+	}{
+		{"guest public", guest, public, true, false},
+		{"guest members", guest, members, false, false},
+		{"member members", member, members, true, false},
+		{"member owner only", member, ownerOnly, false, false},
+		{"member staff edited", member, staffEdited, true, false},
+		{"owner public", owner, public, true, true},
+		{"owner owner only", owner, ownerOnly, true, true},
+		{"owner staff only", owner, staffOnly, false, false},
+		{"owner staff edited", owner, staffEdited, true, false},
+		{"moderator owner only", moderator, ownerOnly, true, true},
+		{"moderator staff only", moderator, staffOnly, false, false},
+		{"moderator staff edited", moderator, staffEdited, true, false},
+		{"staff staff only", staff, staffOnly, true, true},
+		{"staff staff edited", staff, staffEdited, true, true},
+		{"internal read", internal, staffOnly, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.access.CanView(tt.field); got != tt.canView {
+				t.Errorf("CanView = %v, want %v", got, tt.canView)
+			}
+			if got := tt.access.CanEdit(tt.field); got != tt.canEdit {
+				t.Errorf("CanEdit = %v, want %v", got, tt.canEdit)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"cuento-backend/src/Router"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,8 +13,9 @@ import (
 type PermissionType int
 
 const (
-	EndpointPermission PermissionType = 0
-	SubforumPermission PermissionType = 1
+	EndpointPermission   PermissionType = 0
+	SubforumPermission   PermissionType = 1
+	ModerationPermission PermissionType = 2
 )
 
 var SubforumPermissions = map[string]string{
@@ -28,6 +30,16 @@ var SubforumPermissions = map[string]string{
 	"subforum_edit_own_post":          "Edit own post",
 }
 
+// Holding any of these permissions makes an account staff: they are asked for 2FA when
+// require_staff_2fa is set and can see staff-only custom fields
+var StaffPermissions = []string{"/permission-matrix/update", "/template/:type/update", "/bbcode/config/update"}
+
+// Moderation permissions let a role change characters, profiles and episodes it doesn't own
+var ModerationPermissions = map[string]string{
+	"moderate_characters": "Edit any character and character profile, change character status",
+	"moderate_episodes":   "Edit any episode",
+}
+
 type PermissionMatrixObject struct {
 	Roles           map[int]string          `json:"roles"`
 	Permissions     map[string]string       `json:"permissions"`
@@ -192,6 +204,66 @@ func GetSubforumPermissionMatrix(db *sql.DB) (PermissionMatrixObject, error) {
 	}, nil
 }
 
+func GetModerationPermissionMatrix(db *sql.DB) (PermissionMatrixObject, error) {
+	// 1. Fetch all roles
+	roleRows, err := db.Query("SELECT id, name FROM roles")
+	if err != nil {
+		return PermissionMatrixObject{}, err
+	}
+	defer roleRows.Close()
+
+	roleMap := make(map[int]string)
+	for roleRows.Next() {
+		var role Entities.Role
+		if err := roleRows.Scan(&role.Id, &role.Name); err != nil {
+			return PermissionMatrixObject{}, err
+		}
+		roleMap[role.Id] = role.Name
+	}
+
+	// 2. Fetch all existing moderation role-permission relationships
+	permRows, err := db.Query("SELECT role_id, permission FROM role_permission WHERE type = 2")
+	if err != nil {
+		return PermissionMatrixObject{}, err
+	}
+	defer permRows.Close()
+
+	existingPerms := make(map[string]map[int]bool) // permission -> roleID -> true
+	for permRows.Next() {
+		var roleID int
+		var permission string
+		if err := permRows.Scan(&roleID, &permission); err != nil {
+			continue
+		}
+		if _, ok := existingPerms[permission]; !ok {
+			existingPerms[permission] = make(map[int]bool)
+		}
+		existingPerms[permission][roleID] = true
+	}
+
+	// 3. Build the matrix in a stable order
+	permissionOrder := make([]string, 0, len(ModerationPermissions))
+	for permission := range ModerationPermissions {
+		permissionOrder = append(permissionOrder, permission)
+	}
+	sort.Strings(permissionOrder)
+
+	permissionMatrix := make(map[string]map[int]bool)
+	for _, permission := range permissionOrder {
+		permissionMatrix[permission] = make(map[int]bool)
+		for roleID := range roleMap {
+			permissionMatrix[permission][roleID] = existingPerms[permission][roleID]
+		}
+	}
+
+	return PermissionMatrixObject{
+		Roles:           roleMap,
+		Permissions:     ModerationPermissions,
+		Matrix:          permissionMatrix,
+		PermissionOrder: permissionOrder,
+	}, nil
+}
+
 func UpdatePermissionMatrix(permissions []string, db *sql.DB) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -259,3 +331,67 @@ func UpdatePermissionMatrix(permissions []string, db *sql.DB) error {
 
 	return nil
 }
+
+// IsStaff reports whether one of the user's roles holds a staff permission.
+func IsStaff(userID int, db DBExecutor) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+
+	args := []interface{}{userID}
+	placeholders := make([]string, len(StaffPermissions))
+	for i, permission := range StaffPermissions {
+		placeholders[i] = "?"
+		args = append(args, permission)
+	}
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM user_role ur
+		INNER JOIN role_permission rp ON ur.role_id = rp.role_id
+		WHERE rp.type = 0 AND ur.user_id = ? AND rp.permission IN (`+strings.Join(placeholders, ", ")+`)`, args...).Scan(&count)
+	return count > 0, err
+}
+
+// HasModerationPermission reports whether one of the user's roles holds the given moderation permission.
+func HasModerationPermission(userID int, permission string, db DBExecutor) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM user_role ur
+		INNER JOIN role_permission rp ON ur.role_id = rp.role_id
+		WHERE rp.type = 2 AND ur.user_id = ? AND rp.permission = ?`, userID, permission).Scan(&count)
+	return count > 0, err
+}
+
+// HasSubforumPermission checks a subforum permission such as subforum_post in one subforum.
+// Visitors without roles are checked against the Guest role, like in the subforum view.
+func HasSubforumPermission(userID int, permission string, subforumID int, db DBExecutor) (bool, error) {
+	perm := fmt.Sprintf("%s:%d", permission, subforumID)
+	var roleCount int
+	if userID > 0 {
+		if err := db.QueryRow("SELECT COUNT(*) FROM user_role WHERE user_id = ?", userID).Scan(&roleCount); err != nil {
+			return false, err
+		}
+	}
+
+	var count int
+	var err error
+	if roleCount > 0 {
+		err = db.QueryRow(`
+			SELECT COUNT(*)
+			FROM user_role ur
+			INNER JOIN role_permission rp ON ur.role_id = rp.role_id
+			WHERE rp.type = 1 AND ur.user_id = ? AND rp.permission = ?`, userID, perm).Scan(&count)
+	} else {
+		err = db.QueryRow(`
+			SELECT COUNT(*)
+			FROM roles r
+			INNER JOIN role_permission rp ON r.id = rp.role_id
+			WHERE rp.type = 1 AND r.name = 'Guest' AND rp.permission = ?`, perm).Scan(&count)
+	}
+	return count > 0, err
+}
@@ -0,0 +1,295 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrQuotedPostNotFound = errors.New("quoted post not found")
+
+var (
+	quoteBoundaryPattern = regexp.MustCompile(`(?i)\[(/?)quote(=[^\]]*)?\]`)
+	diceBlockPattern     = regexp.MustCompile(`(?i)\[dice=(\d+)\]\s*\[/dice\]`)
+	attachmentTagPattern = regexp.MustCompile(`(?i)\[attachment\][^\[]*\[/attachment\]`)
+)
+
+const quoteBlockFormat = "[quote=%d]\n%s\n[/quote]\n"
+
+type quotablePost struct {
+	id      int
+	content string
+}
+
+// readablePosts loads the posts among postIDs that the user can read. Others are left out, so
+// quoting can't reveal posts from subforums the user has no access to.
+func readablePosts(postIDs []int, userID int, db DBExecutor) (map[int]quotablePost, error) {
+	result := make(map[int]quotablePost)
+	if len(postIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT p.id, p.content, t.subforum_id
+		FROM posts p
+		JOIN topics t ON p.topic_id = t.id
+		WHERE p.id IN (?`+strings.Repeat(",?", len(postIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	postSubforums := make(map[int]int)
+	for rows.Next() {
+		var post quotablePost
+		var subforumID int
+		if err := rows.Scan(&post.id, &post.content, &subforumID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result[post.id] = post
+		postSubforums[post.id] = subforumID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	readable := make(map[int]bool)
+	for id, subforumID := range postSubforums {
+		allowed, checked := readable[subforumID]
+		if !checked {
+			if allowed, err = HasSubforumPermission(userID, "subforum_read", subforumID, db); err != nil {
+				return nil, err
+			}
+			readable[subforumID] = allowed
+		}
+		if !allowed {
+			delete(result, id)
+		}
+	}
+	return result, nil
+}
+
+// quoteIDs lists the posts referenced by [quote=post_id] tags, each once, in order.
+func quoteIDs(content string) []int {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, match := range quoteTagPattern.FindAllStringSubmatch(content, -1) {
+		if id, err := strconv.Atoi(match[1]); err == nil && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// ExpandQuotes puts a [quote=post_id] block with the text of each quoted post at the top of a new
+// post, unless the content quotes it already. The quoted text loses its own quotes, and its dice
+// and attachments, which only resolve in their own post, become plain text.
+func ExpandQuotes(content string, quotedPostIDs []int, userID int, db DBExecutor) (string, error) {
+	present := make(map[int]bool)
+	for _, id := range quoteIDs(content) {
+		present[id] = true
+	}
+	var missing []int
+	for _, id := range quotedPostIDs {
+		if !present[id] {
+			present[id] = true
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return content, nil
+	}
+
+	posts, err := readablePosts(missing, userID, db)
+	if err != nil {
+		return "", err
+	}
+	rolls, err := GetPostRolls(missing, db)
+	if err != nil {
+		return "", err
+	}
+
+	var expanded strings.Builder
+	for _, id := range missing {
+		post, ok := posts[id]
+		if !ok {
+			return "", fmt.Errorf("%w: %d", ErrQuotedPostNotFound, id)
+		}
+		fmt.Fprintf(&expanded, quoteBlockFormat, id, quoteBody(post.content, rolls[id]))
+	}
+	return expanded.String() + content, nil
+}
+
+// quoteBody is the text of a quoted post without nested quotes and references to its rolls and files.
+func quoteBody(content string, rolls []Entities.DiceRoll) string {
+	var body strings.Builder
+	depth, last := 0, 0
+	for _, loc := range quoteBoundaryPattern.FindAllStringSubmatchIndex(content, -1) {
+		closing := loc[3] > loc[2]
+		if depth == 0 {
+			body.WriteString(content[last:loc[0]])
+		}
+		if closing {
+			if depth > 0 {
+				depth--
+			}
+		} else {
+			depth++
+		}
+		last = loc[1]
+	}
+	if depth == 0 {
+		body.WriteString(content[last:])
+	}
+
+	rollText := make(map[string]string)
+	for _, roll := range rolls {
+		rollText[strconv.Itoa(roll.Id)] = fmt.Sprintf("%s = %d", roll.Notation, roll.Total)
+	}
+	text := diceBlockPattern.ReplaceAllStringFunc(body.String(), func(tag string) string {
+		return rollText[diceBlockPattern.FindStringSubmatch(tag)[1]]
+	})
+	text = attachmentTagPattern.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}
+
+// SaveQuoteReferences records which posts a post quotes, for reply lookups and notifications.
+// Only posts the user can read count. It returns the IDs recorded.
+func SaveQuoteReferences(postID int64, userID int, content string, db DBExecutor) ([]int, error) {
+	var ids []int
+	for _, id := range quoteIDs(content) {
+		if int64(id) != postID {
+			ids = append(ids, id)
+		}
+	}
+	posts, err := readablePosts(ids, userID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec("DELETE FROM post_quotes WHERE post_id = ?", postID); err != nil {
+		return nil, err
+	}
+	recorded := []int{}
+	for _, id := range ids {
+		if _, ok := posts[id]; !ok {
+			continue
+		}
+		if _, err := db.Exec("INSERT INTO post_quotes (post_id, quoted_post_id) VALUES (?, ?)", postID, id); err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, id)
+	}
+	return recorded, nil
+}
+
+// GetQuotedPostIds returns the posts each of the given posts quotes, keyed by post ID.
+func GetQuotedPostIds(postIDs []int, db DBExecutor) (map[int][]int, error) {
+	result := make(map[int][]int)
+	if len(postIDs) == 0 {
+		return result, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT post_id, quoted_post_id FROM post_quotes WHERE post_id IN (?"+strings.Repeat(",?", len(postIDs)-1)+") ORDER BY quoted_post_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID, quotedID int
+		if err := rows.Scan(&postID, &quotedID); err != nil {
+			return nil, err
+		}
+		result[postID] = append(result[postID], quotedID)
+	}
+	return result, rows.Err()
+}
+
+// GetQuotedAuthors returns the distinct authors of the given posts.
+func GetQuotedAuthors(postIDs []int, db DBExecutor) ([]int, error) {
+	if len(postIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT DISTINCT author_user_id FROM posts WHERE id IN (?"+strings.Repeat(",?", len(postIDs)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authors []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		authors = append(authors, id)
+	}
+	return authors, rows.Err()
+}
+
+// GetPostReplies lists the posts quoting a post, oldest first, leaving out those the viewer can't read.
+func GetPostReplies(postID int, viewerID int, db DBExecutor) ([]Entities.PostReply, error) {
+	rows, err := db.Query(`
+		SELECT p.id, p.topic_id, t.name, t.subforum_id, p.author_user_id,
+			IF(p.use_character_profile AND cb.name IS NOT NULL, cb.name, u.username), p.date_created
+		FROM post_quotes q
+		JOIN posts p ON q.post_id = p.id
+		JOIN topics t ON p.topic_id = t.id
+		JOIN users u ON p.author_user_id = u.id
+		LEFT JOIN character_profile_base cp ON p.character_profile_id = cp.id
+		LEFT JOIN character_base cb ON cp.character_id = cb.id
+		WHERE q.quoted_post_id = ?
+		ORDER BY p.id`, postID)
+	if err != nil {
+		return nil, err
+	}
+	var replies []Entities.PostReply
+	var subforums []int
+	for rows.Next() {
+		var reply Entities.PostReply
+		var subforumID int
+		if err := rows.Scan(&reply.PostId, &reply.TopicId, &reply.TopicName, &subforumID, &reply.AuthorUserId, &reply.AuthorName, &reply.DateCreated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		replies = append(replies, reply)
+		subforums = append(subforums, subforumID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	readable := make(map[int]bool)
+	visible := []Entities.PostReply{}
+	for i, reply := range replies {
+		allowed, checked := readable[subforums[i]]
+		if !checked {
+			if allowed, err = HasSubforumPermission(viewerID, "subforum_read", subforums[i], db); err != nil {
+				return nil, err
+			}
+			readable[subforums[i]] = allowed
+		}
+		if allowed {
+			visible = append(visible, reply)
+		}
+	}
+	return visible, nil
+}
@@ -1,10 +1,14 @@
 package Services
 
 import (
+	"crypto/sha256"
+	"cuento-backend/src/BBCode"
 	"cuento-backend/src/Entities"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -38,7 +42,7 @@ func GetPostById(id int, db *sql.DB) (*Entities.Post, error) {
 	// 2. Construct the main query
 	query := fmt.Sprintf(`
 		SELECT
-			p.id, p.author_user_id, p.date_created, p.content, p.use_character_profile,
+			p.id, p.author_user_id, p.date_created, p.content, p.content_html, p.content_html_version, p.content_html_quotes, p.use_character_profile,
 			u.username, u.avatar,
 			cp.id as character_profile_id, cp.character_id, cb.name as character_name, cp.avatar as character_avatar
 			%s
@@ -91,7 +95,15 @@ func GetPostById(id int, db *sql.DB) (*Entities.Post, error) {
 	}
 	if val, ok := rowMap["content"]; ok {
 		post.Content = val.(string)
-		post.ContentHtml = Entities.ParseBBCode(post.Content)
+	}
+	if val, ok := rowMap["content_html"]; ok {
+		post.ContentHtml = val.(string)
+	}
+	if val, ok := rowMap["content_html_version"]; ok {
+		post.ContentHtmlVersion = val.(string)
+	}
+	if val, ok := rowMap["content_html_quotes"]; ok {
+		post.ContentHtmlQuotes = val.(string)
 	}
 	if val, ok := rowMap["use_character_profile"]; ok {
 		post.UseCharacterProfile, _ = strconv.ParseBool(val.(string))
@@ -116,17 +128,23 @@ func GetPostById(id int, db *sql.DB) (*Entities.Post, error) {
 		customFields := make(map[string]Entities.CustomFieldValue)
 		for _, field := range customConfig {
 			if val, ok := rowMap[field.MachineFieldName]; ok {
-				cfValue := Entities.CustomFieldValue{Content: val}
-				if field.FieldType == "text" {
-					if s, ok := val.(string); ok {
-						cfValue.ContentHtml = Entities.ParseBBCode(s)
-					}
-				}
-				customFields[field.MachineFieldName] = cfValue
+				customFields[field.MachineFieldName] = Entities.CustomFieldValue{Content: val}
 			}
 		}
 		charProfile.CustomFields.CustomFields = customFields
 		charProfile.CustomFields.FieldConfig = customConfig
+		// The post is broadcast to everyone watching the topic, so only public fields go with it
+		guest := &FieldAccess{}
+		charProfile.CustomFields.FilterFields(guest.CanView)
+		profileHtml := NewFieldHtmlBatch("character_profile")
+		for _, field := range charProfile.CustomFields.FieldConfig {
+			if text, ok := customFields[field.MachineFieldName].Content.(string); ok && field.FieldType == "text" {
+				profileHtml.AddField(charProfile.Id, field.MachineFieldName, text, customFields)
+			}
+		}
+		if err := profileHtml.Resolve(db); err != nil {
+			return nil, fmt.Errorf("failed to render character profile: %w", err)
+		}
 		post.CharacterProfile = &charProfile
 	} else {
 		var userProfile Entities.UserProfile
@@ -140,5 +158,191 @@ func GetPostById(id int, db *sql.DB) (*Entities.Post, error) {
 		post.UserProfile = &userProfile
 	}
 
-	return &post, nil
+	posts := []Entities.Post{post}
+	if err := RenderPosts(posts, db); err != nil {
+		return nil, fmt.Errorf("failed to render post: %w", err)
+	}
+
+	return &posts[0], nil
+}
+
+// GetPostAuthor returns the author and topic of a post.
+func GetPostAuthor(postID int, db DBExecutor) (authorID int, topicID int, err error) {
+	err = db.QueryRow("SELECT author_user_id, topic_id FROM posts WHERE id = ?", postID).Scan(&authorID, &topicID)
+	return authorID, topicID, err
+}
+
+// UpdatePostContent replaces a post's text. The stored HTML is dropped and rendered again on the
+// next read.
+func UpdatePostContent(postID int, content string, db DBExecutor) error {
+	_, err := db.Exec("UPDATE posts SET content = ?, content_html = NULL, content_html_version = NULL, content_html_quotes = NULL WHERE id = ?", content, postID)
+	return err
+}
+
+var quoteTagPattern = regexp.MustCompile(`(?i)\[quote=(\d+)\]`)
+
+// RenderPosts fills in the posts' attachments, dice rolls and quoted posts and makes sure their
+// HTML is current. HTML stored with the post is used while both the renderer version and the quote
+// attributions it was rendered with match, so renaming a quoted character or user, or deleting or
+// moving a quoted post, invalidates it without bookkeeping. Other posts are rendered again, with
+// their inline attachments, rolls and the authors of the quotes recorded for them, and stored.
+func RenderPosts(posts []Entities.Post, db DBExecutor) error {
+	version := BBCode.Default.Version()
+	postIDs := make([]int, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.Id
+	}
+
+	attachments, err := GetPostAttachments(postIDs, db)
+	if err != nil {
+		return err
+	}
+	rolls, err := GetPostRolls(postIDs, db)
+	if err != nil {
+		return err
+	}
+	quotedIDsByPost, err := GetQuotedPostIds(postIDs, db)
+	if err != nil {
+		return err
+	}
+	// Authors are only looked up for the quotes recorded with each post, which its author could
+	// read when writing it. A [quote=id] tag naming any other post renders without attribution.
+	var quotedIDs []int
+	for _, post := range posts {
+		quotedIDs = append(quotedIDs, quotedIDsByPost[post.Id]...)
+	}
+	quotes, err := GetQuotedPosts(quotedIDs, db)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Attachments = []Entities.PostAttachment{}
+		if postAttachments, ok := attachments[posts[i].Id]; ok {
+			posts[i].Attachments = postAttachments
+		}
+		posts[i].QuotedPostIds = []int{}
+		if ids, ok := quotedIDsByPost[posts[i].Id]; ok {
+			posts[i].QuotedPostIds = ids
+		}
+		posts[i].Rolls = []Entities.DiceRoll{}
+		if postRolls, ok := rolls[posts[i].Id]; ok {
+			posts[i].Rolls = postRolls
+		}
+
+		ctx := &BBCode.Context{Quotes: map[int]BBCode.QuotedPost{}, Attachments: map[int]BBCode.Attachment{}}
+		for _, id := range posts[i].QuotedPostIds {
+			if quoted, ok := quotes[id]; ok {
+				ctx.Quotes[id] = quoted
+			}
+		}
+		quotesHash := hashQuoteAttributions(posts[i].QuotedPostIds, ctx.Quotes)
+		if posts[i].ContentHtmlVersion == version && posts[i].ContentHtmlQuotes == quotesHash {
+			continue
+		}
+
+		for _, attachment := range posts[i].Attachments {
+			ctx.Attachments[attachment.Id] = BBCode.Attachment{FileName: attachment.FileName, Url: attachment.Url, ThumbnailUrl: attachment.ThumbnailUrl}
+		}
+		// Only the post's own rolls resolve, so a [dice] tag can't show another post's result
+		ctx.Rolls = map[int]BBCode.Roll{}
+		for _, roll := range posts[i].Rolls {
+			ctx.Rolls[roll.Id] = BBCode.Roll{Notation: roll.Notation, Results: roll.Results, Modifier: roll.Modifier, Total: roll.Total}
+		}
+		posts[i].ContentHtml = BBCode.Default.Render(posts[i].Content, ctx)
+		posts[i].ContentHtmlVersion = version
+		posts[i].ContentHtmlQuotes = quotesHash
+
+		// An edit that landed meanwhile has already cleared the version, leave its HTML to the next read
+		if _, err := db.Exec("UPDATE posts SET content_html = ?, content_html_version = ?, content_html_quotes = ? WHERE id = ? AND content = ?",
+			posts[i].ContentHtml, version, quotesHash, posts[i].Id, posts[i].Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashQuoteAttributions sums up what a post's quotes render as, empty for a post without quotes.
+func hashQuoteAttributions(quotedIDs []int, quotes map[int]BBCode.QuotedPost) string {
+	if len(quotedIDs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, id := range quotedIDs {
+		if quoted, ok := quotes[id]; ok {
+			fmt.Fprintf(&b, "%d:%d:%s\n", id, quoted.TopicId, quoted.AuthorName)
+		} else {
+			fmt.Fprintf(&b, "%d:-\n", id)
+		}
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// RenderStoredPosts brings the stored HTML of the given posts up to date.
+func RenderStoredPosts(postIDs []int, db DBExecutor) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT id, content, content_html_version, content_html_quotes FROM posts WHERE id IN (?"+strings.Repeat(",?", len(postIDs)-1)+")", args...)
+	if err != nil {
+		return err
+	}
+	var posts []Entities.Post
+	for rows.Next() {
+		var post Entities.Post
+		var version, quotes sql.NullString
+		if err := rows.Scan(&post.Id, &post.Content, &version, &quotes); err != nil {
+			rows.Close()
+			return err
+		}
+		post.ContentHtmlVersion = version.String
+		post.ContentHtmlQuotes = quotes.String
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return RenderPosts(posts, db)
+}
+
+// GetQuotedPosts looks up who wrote the quoted posts: the character for in-character posts,
+// the account otherwise. Posts that don't exist are left out. It doesn't check read permissions,
+// so only pass IDs taken from post_quotes.
+func GetQuotedPosts(postIDs []int, db DBExecutor) (map[int]BBCode.QuotedPost, error) {
+	quotes := make(map[int]BBCode.QuotedPost)
+	if len(postIDs) == 0 {
+		return quotes, nil
+	}
+
+	args := make([]interface{}, len(postIDs))
+	for i, id := range postIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT p.id, p.topic_id, IF(p.use_character_profile AND cb.name IS NOT NULL, cb.name, u.username)
+		FROM posts p
+		JOIN users u ON p.author_user_id = u.id
+		LEFT JOIN character_profile_base cp ON p.character_profile_id = cp.id
+		LEFT JOIN character_base cb ON cp.character_id = cb.id
+		WHERE p.id IN (?`+strings.Repeat(",?", len(postIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var quoted BBCode.QuotedPost
+		if err := rows.Scan(&id, &quoted.TopicId, &quoted.AuthorName); err != nil {
+			return nil, err
+		}
+		quotes[id] = quoted
+	}
+	return quotes, rows.Err()
 }
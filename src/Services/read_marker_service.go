@@ -0,0 +1,146 @@
+package Services
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Unread tracking works on three levels so that marking a whole subforum or board as read is a
+// single row write instead of one row per topic:
+//   - topic_read_markers keep the last post a user has seen in a topic,
+//   - subforum_read_markers and users.date_marked_read record when everything older was marked read,
+//   - anything older than the unread window is always considered read.
+
+// GetUnreadBaseline returns the moment before which every post counts as read for the user.
+func GetUnreadBaseline(userID int, db DBExecutor) (time.Time, error) {
+	windowDays, err := GetGlobalSettingInt("unread_window_days", 30, db)
+	if err != nil {
+		return time.Time{}, err
+	}
+	baseline := time.Now().AddDate(0, 0, -windowDays)
+
+	var markedRead sql.NullTime
+	err = db.QueryRow("SELECT date_marked_read FROM users WHERE id = ?", userID).Scan(&markedRead)
+	if err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	if markedRead.Valid && markedRead.Time.After(baseline) {
+		baseline = markedRead.Time
+	}
+	return baseline, nil
+}
+
+// MarkTopicRead moves the user's read marker forward to the given post. Markers never move backwards,
+// so reading an older page of a topic keeps newer posts read.
+func MarkTopicRead(userID int, topicID int, lastPostID int, db DBExecutor) error {
+	_, err := db.Exec(`INSERT INTO topic_read_markers (user_id, topic_id, last_read_post_id, date_read) VALUES (?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE last_read_post_id = GREATEST(last_read_post_id, VALUES(last_read_post_id)), date_read = NOW()`,
+		userID, topicID, lastPostID)
+	return err
+}
+
+func MarkSubforumRead(userID int, subforumID int, db DBExecutor) error {
+	_, err := db.Exec("INSERT INTO subforum_read_markers (user_id, subforum_id, date_read) VALUES (?, ?, NOW()) ON DUPLICATE KEY UPDATE date_read = NOW()",
+		userID, subforumID)
+	return err
+}
+
+func MarkBoardRead(userID int, db DBExecutor) error {
+	_, err := db.Exec("UPDATE users SET date_marked_read = NOW() WHERE id = ?", userID)
+	return err
+}
+
+func TouchUserLastVisit(userID int, db DBExecutor) error {
+	_, err := db.Exec("UPDATE users SET date_last_visit = NOW() WHERE id = ?", userID)
+	return err
+}
+
+// GetUnreadSubforums returns the IDs of subforums that contain at least one unread topic.
+// Only topics with activity after the baseline are considered, which keeps the scan small.
+func GetUnreadSubforums(userID int, db DBExecutor) (map[int]bool, error) {
+	baseline, err := GetUnreadBaseline(userID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT t.subforum_id
+		FROM topics t
+		LEFT JOIN topic_read_markers trm ON trm.topic_id = t.id AND trm.user_id = ?
+		LEFT JOIN subforum_read_markers srm ON srm.subforum_id = t.subforum_id AND srm.user_id = ?
+		WHERE t.date_last_post > ?
+			AND t.last_post_id IS NOT NULL
+			AND t.last_post_id > COALESCE(trm.last_read_post_id, 0)
+			AND (srm.date_read IS NULL OR t.date_last_post > srm.date_read)`,
+		userID, userID, baseline)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	unread := make(map[int]bool)
+	for rows.Next() {
+		var subforumID int
+		if err := rows.Scan(&subforumID); err != nil {
+			return nil, err
+		}
+		unread[subforumID] = true
+	}
+	return unread, rows.Err()
+}
+
+// UnreadCutoff is where unread posts start in one topic: after the read marker and after since.
+type UnreadCutoff struct {
+	TopicID        int
+	LastReadPostID int
+	Since          time.Time
+}
+
+// FirstUnreadPost is the first unread post of a topic and the topic page it is on.
+type FirstUnreadPost struct {
+	PostID int
+	Page   int
+}
+
+// GetFirstUnreadPosts finds the first unread post of every given topic in one query, keyed by topic ID.
+// Topics without unread posts are left out. Post IDs grow with date_created, so the lowest unread ID is
+// the first unread post, and its position is the number of older posts in the topic.
+func GetFirstUnreadPosts(cutoffs []UnreadCutoff, perPage int, db DBExecutor) (map[int]FirstUnreadPost, error) {
+	result := make(map[int]FirstUnreadPost)
+	if len(cutoffs) == 0 {
+		return result, nil
+	}
+
+	selects := make([]string, len(cutoffs))
+	args := make([]interface{}, 0, len(cutoffs)*3)
+	for i, cutoff := range cutoffs {
+		selects[i] = "SELECT ? AS topic_id, ? AS last_read_post_id, ? AS since"
+		args = append(args, cutoff.TopicID, cutoff.LastReadPostID, cutoff.Since)
+	}
+
+	rows, err := db.Query(`
+		SELECT fu.topic_id, fu.post_id, COUNT(earlier.id)
+		FROM (
+			SELECT c.topic_id, MIN(p.id) AS post_id
+			FROM (`+strings.Join(selects, " UNION ALL ")+`) c
+			JOIN posts p ON p.topic_id = c.topic_id AND p.id > c.last_read_post_id AND p.date_created > c.since
+			GROUP BY c.topic_id
+		) fu
+		JOIN posts first ON first.id = fu.post_id
+		LEFT JOIN posts earlier ON earlier.topic_id = fu.topic_id AND earlier.date_created < first.date_created
+		GROUP BY fu.topic_id, fu.post_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var topicID, postID, position int
+		if err := rows.Scan(&topicID, &postID, &position); err != nil {
+			return nil, err
+		}
+		result[topicID] = FirstUnreadPost{PostID: postID, Page: position/perPage + 1}
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,242 @@
+package Services
+
+import (
+	"crypto/sha256"
+	"cuento-backend/src/BBCode"
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Rows handled per query by the background re-render
+const rerenderBatchSize = 200
+
+type fieldHtmlRequest struct {
+	entityID int
+	field    string
+	source   string
+	hash     string
+	set      func(html string)
+}
+
+// FieldHtmlBatch renders text custom fields through the custom_field_html cache. Add every field
+// of a page first, then Resolve once. Cached HTML is used while both the source text and the
+// renderer version match, so edits and tag set changes invalidate it without bookkeeping.
+type FieldHtmlBatch struct {
+	entityType string
+	requests   []fieldHtmlRequest
+}
+
+func NewFieldHtmlBatch(entityType string) *FieldHtmlBatch {
+	return &FieldHtmlBatch{entityType: entityType}
+}
+
+func (b *FieldHtmlBatch) Add(entityID int, field string, source string, set func(html string)) {
+	sum := sha256.Sum256([]byte(source))
+	b.requests = append(b.requests, fieldHtmlRequest{entityID: entityID, field: field, source: source, hash: hex.EncodeToString(sum[:]), set: set})
+}
+
+// AddField sets the HTML of a field in a custom field map. The map must not change until Resolve.
+func (b *FieldHtmlBatch) AddField(entityID int, field string, source string, fields map[string]Entities.CustomFieldValue) {
+	b.Add(entityID, field, source, func(html string) {
+		value := fields[field]
+		value.ContentHtml = html
+		fields[field] = value
+	})
+}
+
+func (b *FieldHtmlBatch) Resolve(db DBExecutor) error {
+	if len(b.requests) == 0 {
+		return nil
+	}
+	version := BBCode.Default.Version()
+
+	type cacheKey struct {
+		entityID int
+		field    string
+	}
+	type cachedHtml struct {
+		hash    string
+		version string
+		html    string
+	}
+	cached := make(map[cacheKey]cachedHtml)
+
+	seen := make(map[int]bool)
+	var args []interface{}
+	args = append(args, b.entityType)
+	for _, request := range b.requests {
+		if !seen[request.entityID] {
+			seen[request.entityID] = true
+			args = append(args, request.entityID)
+		}
+	}
+	rows, err := db.Query("SELECT entity_id, field_machine_name, source_hash, render_version, html FROM custom_field_html WHERE entity_type = ? AND entity_id IN (?"+strings.Repeat(",?", len(seen)-1)+")", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var key cacheKey
+		var entry cachedHtml
+		if err := rows.Scan(&key.entityID, &key.field, &entry.hash, &entry.version, &entry.html); err != nil {
+			rows.Close()
+			return err
+		}
+		cached[key] = entry
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, request := range b.requests {
+		entry, ok := cached[cacheKey{request.entityID, request.field}]
+		if ok && entry.hash == request.hash && entry.version == version {
+			request.set(entry.html)
+			continue
+		}
+		html := BBCode.Default.Render(request.source, nil)
+		request.set(html)
+		if _, err := db.Exec(`
+			INSERT INTO custom_field_html (entity_type, entity_id, field_machine_name, source_hash, render_version, html)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE source_hash = VALUES(source_hash), render_version = VALUES(render_version), html = VALUES(html)`,
+			b.entityType, request.entityID, request.field, request.hash, version, html); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RerenderStaleContent renders every post and text custom field whose stored HTML is older than the
+// current renderer, so pages are fast again right after an upgrade. Reads render stale HTML
+// lazily in the meantime.
+func RerenderStaleContent(db *sql.DB) error {
+	version := BBCode.Default.Version()
+
+	// Posts that fail to render keep their old version, so lastID moves the scan past them
+	lastID := 0
+	for {
+		var postIDs []int
+		rows, err := db.Query("SELECT id FROM posts WHERE id > ? AND (content_html_version IS NULL OR content_html_version != ?) ORDER BY id LIMIT ?", lastID, version, rerenderBatchSize)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			postIDs = append(postIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(postIDs) == 0 {
+			break
+		}
+		if err := RenderStoredPosts(postIDs, db); err != nil {
+			return err
+		}
+		lastID = postIDs[len(postIDs)-1]
+	}
+
+	entityTypes, err := textFieldEntityTypes(db)
+	if err != nil {
+		return err
+	}
+	for _, entityType := range entityTypes {
+		if err := rerenderTextFields(entityType, db); err != nil {
+			return fmt.Errorf("failed to re-render %s fields: %w", entityType, err)
+		}
+	}
+	return nil
+}
+
+// textFieldEntityTypes lists the entity types whose templates have text fields.
+func textFieldEntityTypes(db DBExecutor) ([]string, error) {
+	rows, err := db.Query("SELECT entity_type, config FROM custom_field_config")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entityTypes []string
+	for rows.Next() {
+		var entityType string
+		var configJSON []byte
+		if err := rows.Scan(&entityType, &configJSON); err != nil {
+			return nil, err
+		}
+		var config []Entities.CustomFieldConfig
+		if err := json.Unmarshal(configJSON, &config); err != nil {
+			return nil, err
+		}
+		for _, field := range config {
+			if field.FieldType == "text" {
+				entityTypes = append(entityTypes, entityType)
+				break
+			}
+		}
+	}
+	return entityTypes, rows.Err()
+}
+
+func rerenderTextFields(entityType string, db *sql.DB) error {
+	lastID := 0
+	for {
+		var entityIDs []interface{}
+		rows, err := db.Query(fmt.Sprintf("SELECT DISTINCT entity_id FROM %s_main WHERE field_type = 'text' AND entity_id > ? ORDER BY entity_id LIMIT ?", entityType), lastID, rerenderBatchSize)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := rows.Scan(&lastID); err != nil {
+				rows.Close()
+				return err
+			}
+			entityIDs = append(entityIDs, lastID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(entityIDs) == 0 {
+			return nil
+		}
+
+		rows, err = db.Query(fmt.Sprintf("SELECT entity_id, field_machine_name, value_text FROM %s_main WHERE field_type = 'text' AND value_text IS NOT NULL AND entity_id IN (?"+strings.Repeat(",?", len(entityIDs)-1)+")", entityType), entityIDs...)
+		if err != nil {
+			return err
+		}
+		batch := NewFieldHtmlBatch(entityType)
+		for rows.Next() {
+			var entityID int
+			var field, source string
+			if err := rows.Scan(&entityID, &field, &source); err != nil {
+				rows.Close()
+				return err
+			}
+			batch.Add(entityID, field, source, func(string) {})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := batch.Resolve(db); err != nil {
+			return err
+		}
+	}
+}
+
+// StartContentRerender re-renders stale HTML once in the background after startup.
+func StartContentRerender(db *sql.DB) {
+	if err := RerenderStaleContent(db); err != nil {
+		fmt.Printf("Error re-rendering stored HTML: %v\n", err)
+	}
+}
@@ -0,0 +1,214 @@
+package Services
+
+import (
+	"crypto/rand"
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid, expired or revoked")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// How long a session found active is trusted before access tokens of it are checked again. Revoking
+// through this process drops it at once; other instances notice within this time.
+const sessionCheckInterval = 30 * time.Second
+
+type activeSession struct {
+	userID  int
+	checked time.Time
+}
+
+// activeSessions caches sessions known to be active, so access tokens don't cost a query on every request.
+var activeSessions = struct {
+	sessions map[string]activeSession
+	mu       sync.Mutex
+}{sessions: make(map[string]activeSession)}
+
+// IsSessionActive reports whether the session still has a refresh token that wasn't revoked or
+// expired. Access tokens of sessions that aren't active are refused.
+func IsSessionActive(userID int, sessionID string, db DBExecutor) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+	activeSessions.mu.Lock()
+	cached, ok := activeSessions.sessions[sessionID]
+	activeSessions.mu.Unlock()
+	if ok && cached.userID == userID && time.Since(cached.checked) < sessionCheckInterval {
+		return true, nil
+	}
+
+	var exists int
+	err := db.QueryRow("SELECT 1 FROM refresh_tokens WHERE user_id = ? AND session_id = ? AND date_revoked IS NULL AND date_expires > ? LIMIT 1",
+		userID, sessionID, time.Now()).Scan(&exists)
+	if err == sql.ErrNoRows {
+		forgetSessions(func(id string, _ activeSession) bool { return id == sessionID })
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	activeSessions.mu.Lock()
+	defer activeSessions.mu.Unlock()
+	// Entries past the interval are useless, dropping them keeps ended sessions from piling up
+	for id, session := range activeSessions.sessions {
+		if time.Since(session.checked) >= sessionCheckInterval {
+			delete(activeSessions.sessions, id)
+		}
+	}
+	activeSessions.sessions[sessionID] = activeSession{userID: userID, checked: time.Now()}
+	return true, nil
+}
+
+// forgetSessions drops the cached sessions matching the filter, so they are checked on their next request.
+func forgetSessions(match func(sessionID string, session activeSession) bool) {
+	activeSessions.mu.Lock()
+	defer activeSessions.mu.Unlock()
+	for id, session := range activeSessions.sessions {
+		if match(id, session) {
+			delete(activeSessions.sessions, id)
+		}
+	}
+}
+
+// NewSessionID returns a random ID for a new refresh token family.
+func NewSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetSessionIdFromContext returns the session the current access token belongs to, or "" if unknown.
+func GetSessionIdFromContext(c *gin.Context) string {
+	if id, exists := c.Get("session_id"); exists {
+		if sessionID, ok := id.(string); ok {
+			return sessionID
+		}
+	}
+	return ""
+}
+
+// StoreRefreshToken saves the hash of a freshly issued refresh token.
+// sessionStarted is carried over on rotation so the session list shows when the user actually logged in.
+func StoreRefreshToken(userID int, sessionID string, token string, expires time.Time, sessionStarted time.Time, userAgent string, ipAddress string, db DBExecutor) error {
+	_, err := db.Exec(`INSERT INTO refresh_tokens (user_id, session_id, token_hash, user_agent, ip_address, date_session_started, date_created, date_expires)
+		VALUES (?, ?, ?, ?, ?, ?, NOW(), ?)`,
+		userID, sessionID, hashToken(token), userAgent, ipAddress, sessionStarted, expires)
+	if err != nil {
+		return fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return nil
+}
+
+type UsedRefreshToken struct {
+	UserID         int
+	SessionID      string
+	SessionStarted time.Time
+}
+
+// UseRefreshToken marks the token as spent so it can be rotated. Presenting a token that was already
+// spent means it was stolen or replayed, so the whole session is revoked and ErrRefreshTokenReused returned.
+func UseRefreshToken(token string, db DBExecutor) (*UsedRefreshToken, error) {
+	hash := hashToken(token)
+	res, err := db.Exec("UPDATE refresh_tokens SET date_used = NOW() WHERE token_hash = ? AND date_used IS NULL AND date_revoked IS NULL AND date_expires > ?",
+		hash, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var used UsedRefreshToken
+	var dateUsed, dateRevoked sql.NullTime
+	err = db.QueryRow("SELECT user_id, session_id, date_session_started, date_used, date_revoked FROM refresh_tokens WHERE token_hash = ?", hash).
+		Scan(&used.UserID, &used.SessionID, &used.SessionStarted, &dateUsed, &dateRevoked)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		if dateUsed.Valid && !dateRevoked.Valid {
+			if err := RevokeSession(used.UserID, used.SessionID, db); err != nil {
+				return nil, err
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrRefreshTokenInvalid
+	}
+	return &used, nil
+}
+
+// FindRefreshTokenSession returns the owner and session of a stored refresh token.
+func FindRefreshTokenSession(token string, db DBExecutor) (int, string, error) {
+	var userID int
+	var sessionID string
+	err := db.QueryRow("SELECT user_id, session_id FROM refresh_tokens WHERE token_hash = ?", hashToken(token)).Scan(&userID, &sessionID)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrRefreshTokenInvalid
+	}
+	return userID, sessionID, err
+}
+
+func RevokeSession(userID int, sessionID string, db DBExecutor) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET date_revoked = NOW() WHERE user_id = ? AND session_id = ? AND date_revoked IS NULL", userID, sessionID)
+	forgetSessions(func(id string, _ activeSession) bool { return id == sessionID })
+	return err
+}
+
+func RevokeAllUserSessions(userID int, db DBExecutor) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET date_revoked = NOW() WHERE user_id = ? AND date_revoked IS NULL", userID)
+	forgetSessions(func(_ string, session activeSession) bool { return session.userID == userID })
+	return err
+}
+
+// RevokeOtherSessions ends every session of the user except the given one.
+func RevokeOtherSessions(userID int, keepSessionID string, db DBExecutor) error {
+	_, err := db.Exec("UPDATE refresh_tokens SET date_revoked = NOW() WHERE user_id = ? AND session_id != ? AND date_revoked IS NULL", userID, keepSessionID)
+	ForgetOtherSessions(userID, keepSessionID)
+	return err
+}
+
+// ForgetOtherSessions drops the cached sessions of the user except the given one. Callers revoking
+// sessions in a transaction call it again after committing, like ResetPassword.
+func ForgetOtherSessions(userID int, keepSessionID string) {
+	forgetSessions(func(id string, session activeSession) bool { return session.userID == userID && id != keepSessionID })
+}
+
+// GetUserSessions lists the sessions that still hold a usable refresh token.
+func GetUserSessions(userID int, currentSessionID string, db DBExecutor) ([]Entities.Session, error) {
+	rows, err := db.Query(`
+		SELECT session_id, user_agent, ip_address, date_session_started, date_created, date_expires
+		FROM refresh_tokens
+		WHERE user_id = ? AND date_used IS NULL AND date_revoked IS NULL AND date_expires > ?
+		ORDER BY date_created DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Entities.Session{}
+	for rows.Next() {
+		var s Entities.Session
+		var userAgent, ipAddress sql.NullString
+		if err := rows.Scan(&s.Id, &userAgent, &ipAddress, &s.DateCreated, &s.DateLastUsed, &s.DateExpires); err != nil {
+			return nil, err
+		}
+		s.UserAgent = userAgent.String
+		s.IpAddress = ipAddress.String
+		s.IsCurrent = s.Id == currentSessionID
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,56 @@
+package Services
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+// GetGlobalSetting returns the value stored in global_settings for the given name,
+// or the fallback if the setting does not exist.
+func GetGlobalSetting(name string, fallback string, db DBExecutor) (string, error) {
+	var value sql.NullString
+	err := db.QueryRow("SELECT setting_value FROM global_settings WHERE setting_name = ?", name).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fallback, nil
+		}
+		return fallback, err
+	}
+	if !value.Valid {
+		return fallback, nil
+	}
+	return value.String, nil
+}
+
+// GetGlobalSettingInt is like GetGlobalSetting but parses the value as an integer.
+// Values that cannot be parsed fall back to the default.
+func GetGlobalSettingInt(name string, fallback int, db DBExecutor) (int, error) {
+	value, err := GetGlobalSetting(name, "", db)
+	if err != nil {
+		return fallback, err
+	}
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback, nil
+	}
+	return n, nil
+}
+
+// GetGlobalSettingBool is like GetGlobalSetting but parses the value as a boolean.
+func GetGlobalSettingBool(name string, fallback bool, db DBExecutor) (bool, error) {
+	value, err := GetGlobalSetting(name, "", db)
+	if err != nil {
+		return fallback, err
+	}
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback, nil
+	}
+	return b, nil
+}
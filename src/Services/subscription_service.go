@@ -0,0 +1,86 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"fmt"
+)
+
+func IsValidSubscriptionTarget(targetType string) bool {
+	return targetType == string(Entities.TopicSubscription) || targetType == string(Entities.SubforumSubscription)
+}
+
+// Subscribe adds a subscription; subscribing twice is a no-op.
+func Subscribe(userID int, targetType Entities.SubscriptionTarget, targetID int, db DBExecutor) error {
+	_, err := db.Exec("INSERT IGNORE INTO subscriptions (user_id, target_type, target_id, date_created) VALUES (?, ?, ?, NOW())",
+		userID, targetType, targetID)
+	return err
+}
+
+func Unsubscribe(userID int, targetType Entities.SubscriptionTarget, targetID int, db DBExecutor) error {
+	_, err := db.Exec("DELETE FROM subscriptions WHERE user_id = ? AND target_type = ? AND target_id = ?",
+		userID, targetType, targetID)
+	return err
+}
+
+func GetUserSubscriptions(userID int, db DBExecutor) ([]Entities.Subscription, error) {
+	rows, err := db.Query(`
+		SELECT s.target_type, s.target_id, COALESCE(t.name, sf.name, ''), s.date_created
+		FROM subscriptions s
+		LEFT JOIN topics t ON s.target_type = 'topic' AND s.target_id = t.id
+		LEFT JOIN subforums sf ON s.target_type = 'subforum' AND s.target_id = sf.id
+		WHERE s.user_id = ?
+		ORDER BY s.date_created DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []Entities.Subscription{}
+	for rows.Next() {
+		var s Entities.Subscription
+		if err := rows.Scan(&s.TargetType, &s.TargetId, &s.TargetName, &s.DateCreated); err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, rows.Err()
+}
+
+// GetTopicSubscribers returns the users subscribed to the topic directly or through its subforum.
+func GetTopicSubscribers(topicID int64, subforumID int, db DBExecutor) ([]int, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT user_id FROM subscriptions
+		WHERE (target_type = 'topic' AND target_id = ?) OR (target_type = 'subforum' AND target_id = ?)`,
+		topicID, subforumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// SubscribeEpisodeParticipants subscribes the owners of the given characters to the episode topic.
+func SubscribeEpisodeParticipants(topicID int64, characterIDs []int, db DBExecutor) error {
+	for _, characterID := range characterIDs {
+		ownerID, err := GetCharacterOwner(characterID, db)
+		if err != nil {
+			return fmt.Errorf("failed to get owner of character %d: %w", characterID, err)
+		}
+		if ownerID == 0 {
+			continue
+		}
+		if err := Subscribe(ownerID, Entities.TopicSubscription, int(topicID), db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package Services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // accepted steps before and after the current one
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorNotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+)
+
+type TwoFactorEnrolment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP returns the time step the code belongs to. Steps at or before lastUsedStep are
+// rejected so a code can't be replayed.
+func verifyTOTP(secretBase32 string, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secretBase32)
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// HasTwoFactor reports whether the user has a confirmed TOTP secret.
+func HasTwoFactor(userID int, db DBExecutor) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM user_totp WHERE user_id = ? AND date_confirmed IS NOT NULL", userID).Scan(&count)
+	return count > 0, err
+}
+
+// UserRequiresTwoFactor reports whether the board demands 2FA from this user because one of
+// their roles may rewrite permissions or templates.
+func UserRequiresTwoFactor(userID int, db DBExecutor) (bool, error) {
+	required, err := GetGlobalSettingBool("require_staff_2fa", false, db)
+	if err != nil || !required {
+		return false, err
+	}
+
+	return IsStaff(userID, db)
+}
+
+// How long TwoFactorSetupPending trusts what it found. Enabling or disabling 2FA drops the
+// user's entry at once; role and setting changes take effect within this time.
+const twoFactorCheckInterval = 30 * time.Second
+
+type twoFactorState struct {
+	pending bool
+	checked time.Time
+}
+
+// twoFactorStates caches TwoFactorSetupPending, which the permissions middleware asks on every request.
+var twoFactorStates = struct {
+	users map[int]twoFactorState
+	mu    sync.Mutex
+}{users: make(map[int]twoFactorState)}
+
+// TwoFactorSetupPending reports whether the user must enable 2FA before doing anything else.
+func TwoFactorSetupPending(userID int, db DBExecutor) (bool, error) {
+	twoFactorStates.mu.Lock()
+	state, ok := twoFactorStates.users[userID]
+	twoFactorStates.mu.Unlock()
+	if ok && time.Since(state.checked) < twoFactorCheckInterval {
+		return state.pending, nil
+	}
+
+	pending, err := UserRequiresTwoFactor(userID, db)
+	if err != nil {
+		return false, err
+	}
+	if pending {
+		enabled, err := HasTwoFactor(userID, db)
+		if err != nil {
+			return false, err
+		}
+		pending = !enabled
+	}
+
+	twoFactorStates.mu.Lock()
+	defer twoFactorStates.mu.Unlock()
+	for id, state := range twoFactorStates.users {
+		if time.Since(state.checked) >= twoFactorCheckInterval {
+			delete(twoFactorStates.users, id)
+		}
+	}
+	twoFactorStates.users[userID] = twoFactorState{pending: pending, checked: time.Now()}
+	return pending, nil
+}
+
+// ForgetTwoFactorState drops the cached 2FA requirement of the user. Callers changing 2FA in a
+// transaction call it again after committing, so a read during the transaction doesn't stick.
+func ForgetTwoFactorState(userID int) {
+	twoFactorStates.mu.Lock()
+	defer twoFactorStates.mu.Unlock()
+	delete(twoFactorStates.users, userID)
+}
+
+// EnrolTwoFactor creates a new unconfirmed secret, replacing any earlier unconfirmed one.
+func EnrolTwoFactor(userID int, db DBExecutor) (*TwoFactorEnrolment, error) {
+	enabled, err := HasTwoFactor(userID, db)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	_, err = db.Exec(`INSERT INTO user_totp (user_id, secret, date_created, last_used_step) VALUES (?, ?, NOW(), 0)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), date_created = NOW(), date_confirmed = NULL, last_used_step = 0`, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store secret: %w", err)
+	}
+
+	var username string
+	if err := db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		return nil, err
+	}
+	issuer, _ := GetGlobalSetting("site_name", "Cuento", db)
+
+	uri := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/" + issuer + ":" + username,
+		RawQuery: url.Values{
+			"secret":    {secret},
+			"issuer":    {issuer},
+			"algorithm": {"SHA1"},
+			"digits":    {fmt.Sprint(totpDigits)},
+			"period":    {fmt.Sprint(totpPeriod)},
+		}.Encode(),
+	}
+	return &TwoFactorEnrolment{Secret: secret, OtpauthURI: uri.String()}, nil
+}
+
+// checkTOTP verifies a code against the user's secret and remembers its step.
+func checkTOTP(userID int, code string, confirmed bool, db DBExecutor) error {
+	var secret string
+	var lastUsedStep int64
+	query := "SELECT secret, last_used_step FROM user_totp WHERE user_id = ? AND date_confirmed IS NOT NULL"
+	if !confirmed {
+		query = "SELECT secret, last_used_step FROM user_totp WHERE user_id = ? AND date_confirmed IS NULL"
+	}
+	if err := db.QueryRow(query, userID).Scan(&secret, &lastUsedStep); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTwoFactorNotEnrolled
+		}
+		return err
+	}
+
+	step, ok := verifyTOTP(secret, code, time.Now(), lastUsedStep)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	res, err := db.Exec("UPDATE user_totp SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?", step, userID, step)
+	if err != nil {
+		return err
+	}
+	// Another request used the same code in the meantime
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves their app produces valid codes
+// and returns a fresh set of recovery codes.
+func ConfirmTwoFactor(userID int, code string, db DBExecutor) ([]string, error) {
+	if err := checkTOTP(userID, code, false, db); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("UPDATE user_totp SET date_confirmed = NOW() WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	ForgetTwoFactorState(userID)
+	return RegenerateRecoveryCodes(userID, db)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the user. Only hashes are stored.
+func RegenerateRecoveryCodes(userID int, db DBExecutor) ([]string, error) {
+	if _, err := db.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(raw)
+		codes[i] = code[:5] + "-" + code[5:]
+		if _, err := db.Exec("INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactor accepts either a current TOTP code or an unused recovery code.
+func VerifyTwoFactor(userID int, code string, recoveryCode string, db DBExecutor) error {
+	if recoveryCode != "" {
+		res, err := db.Exec("UPDATE user_recovery_codes SET date_used = NOW() WHERE user_id = ? AND code_hash = ? AND date_used IS NULL",
+			userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+	return checkTOTP(userID, code, true, db)
+}
+
+func DisableTwoFactor(userID int, db DBExecutor) error {
+	if _, err := db.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM user_totp WHERE user_id = ?", userID)
+	ForgetTwoFactorState(userID)
+	return err
+}
+
+func CountUnusedRecoveryCodes(userID int, db DBExecutor) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND date_used IS NULL", userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,245 @@
+package Services
+
+import (
+	"crypto/sha256"
+	"cuento-backend/config"
+	"cuento-backend/src/Entities"
+	"cuento-backend/src/Uploads"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+var (
+	ErrExternalImage      = errors.New("images must be uploaded to the board first")
+	ErrUploadQuotaReached = errors.New("upload quota reached, delete some uploads first")
+)
+
+var (
+	UploadStorage Uploads.Storage
+	// Attachments live here, out of reach of the public upload URLs
+	PrivateStorage Uploads.Storage
+	uploadConfig   config.UploadConfig
+)
+
+func InitUploads(cfg *config.UploadConfig) {
+	storage, err := Uploads.NewStorage(cfg)
+	if err != nil {
+		log.Fatalf("Error configuring upload storage: %v", err)
+	}
+	UploadStorage = storage
+	if PrivateStorage, err = Uploads.NewPrivateStorage(cfg); err != nil {
+		log.Fatalf("Error configuring private upload storage: %v", err)
+	}
+	uploadConfig = *cfg
+}
+
+// UploadLimits are the configured limits for a single uploaded file.
+func UploadLimits() Uploads.Limits {
+	return Uploads.Limits{
+		MaxFileSize: uploadConfig.MaxFileSize,
+		MaxWidth:    uploadConfig.MaxWidth,
+		MaxHeight:   uploadConfig.MaxHeight,
+	}
+}
+
+// SaveImageUpload validates an image, stores its variants and records it. Avatars get every
+// configured square size, other images a thumbnail. Uploads past the user's quota are refused
+// with ErrUploadQuotaReached. Files live under a key made from the content
+// hash, so the same image always has the same URLs.
+func SaveImageUpload(userID int, kind Entities.UploadKind, originalName string, data []byte, db DBExecutor) (*Entities.Upload, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	// An image the user has uploaded before is stored once and counted once
+	var used int
+	var alreadyUploaded bool
+	err := db.QueryRow(`SELECT COALESCE(SUM(size_bytes), 0), COALESCE(MAX(content_hash = ?), 0)
+		FROM (SELECT content_hash, MAX(size_bytes) AS size_bytes FROM uploads WHERE user_id = ? GROUP BY content_hash) u`,
+		hash, userID).Scan(&used, &alreadyUploaded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check upload quota: %w", err)
+	}
+	if !alreadyUploaded && used+len(data) > uploadConfig.UserQuota {
+		return nil, ErrUploadQuotaReached
+	}
+
+	img, err := Uploads.DecodeImage(data, UploadLimits())
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []*Uploads.Variant
+	original, err := img.Original()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	variants = append(variants, original)
+
+	if kind == Entities.AvatarUpload {
+		for _, size := range uploadConfig.AvatarSizes {
+			avatar, err := img.Avatar(size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resize avatar: %w", err)
+			}
+			variants = append(variants, avatar)
+		}
+	} else {
+		thumb, err := img.Thumbnail(uploadConfig.ThumbnailSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create thumbnail: %w", err)
+		}
+		variants = append(variants, thumb)
+	}
+
+	baseKey := hash[:2] + "/" + hash
+
+	keys := make(map[string]string)
+	for _, variant := range variants {
+		key := fmt.Sprintf("%s/%s.%s", baseKey, variant.Name, variant.Ext)
+		if err := UploadStorage.Put(key, variant.Data); err != nil {
+			return nil, fmt.Errorf("failed to store %s: %w", variant.Name, err)
+		}
+		keys[variant.Name] = key
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(originalName) > 255 {
+		originalName = originalName[:255]
+	}
+	res, err := db.Exec("INSERT INTO uploads (user_id, kind, original_name, mime_type, size_bytes, content_hash, width, height, variants, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())",
+		userID, kind, originalName, img.MimeType, len(data), hash, img.Width, img.Height, string(keysJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record upload: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetUpload(int(id), db)
+}
+
+// DeleteUpload removes one of the user's uploads. Files are shared by every upload of the same
+// content, so only keys no remaining upload uses are deleted from the storage.
+// sql.ErrNoRows means the user has no such upload.
+func DeleteUpload(id int, userID int, db DBExecutor) error {
+	var hash string
+	var keysJSON []byte
+	if err := db.QueryRow("SELECT content_hash, variants FROM uploads WHERE id = ? AND user_id = ?", id, userID).Scan(&hash, &keysJSON); err != nil {
+		return err
+	}
+	keys := make(map[string]string)
+	if err := json.Unmarshal(keysJSON, &keys); err != nil {
+		return fmt.Errorf("failed to parse upload variants: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM uploads WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT variants FROM uploads WHERE content_hash = ?", hash)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	inUse := make(map[string]bool)
+	for rows.Next() {
+		var otherJSON []byte
+		if err := rows.Scan(&otherJSON); err != nil {
+			return err
+		}
+		other := make(map[string]string)
+		if err := json.Unmarshal(otherJSON, &other); err != nil {
+			return fmt.Errorf("failed to parse upload variants: %w", err)
+		}
+		for _, key := range other {
+			inUse[key] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The row is gone already, a file that can't be removed only costs disk space
+	for _, key := range keys {
+		if inUse[key] {
+			continue
+		}
+		if err := UploadStorage.Delete(key); err != nil {
+			fmt.Printf("Error deleting upload file %s: %v\n", key, err)
+		}
+	}
+	return nil
+}
+
+const uploadSelect = "SELECT id, user_id, kind, original_name, mime_type, size_bytes, width, height, variants, date_created FROM uploads"
+
+func scanUpload(row interface{ Scan(...interface{}) error }) (*Entities.Upload, error) {
+	var upload Entities.Upload
+	var keysJSON []byte
+	if err := row.Scan(&upload.Id, &upload.UserId, &upload.Kind, &upload.OriginalName, &upload.MimeType, &upload.SizeBytes,
+		&upload.Width, &upload.Height, &keysJSON, &upload.DateCreated); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]string)
+	if err := json.Unmarshal(keysJSON, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse upload variants: %w", err)
+	}
+	upload.Variants = make(map[string]string)
+	for name, key := range keys {
+		upload.Variants[name] = UploadStorage.URL(key)
+	}
+
+	upload.Url = upload.Variants["original"]
+	if upload.Kind == Entities.AvatarUpload && len(uploadConfig.AvatarSizes) > 0 {
+		if url, ok := upload.Variants[fmt.Sprintf("avatar_%d", uploadConfig.AvatarSizes[0])]; ok {
+			upload.Url = url
+		}
+	}
+	return &upload, nil
+}
+
+func GetUpload(id int, db DBExecutor) (*Entities.Upload, error) {
+	return scanUpload(db.QueryRow(uploadSelect+" WHERE id = ?", id))
+}
+
+func GetUserUploads(userID int, kind Entities.UploadKind, db DBExecutor) ([]Entities.Upload, error) {
+	rows, err := db.Query(uploadSelect+" WHERE user_id = ? AND kind = ? ORDER BY date_created DESC", userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []Entities.Upload{}
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *upload)
+	}
+	return uploads, rows.Err()
+}
+
+// CheckImageURL enforces the require_uploaded_images setting: when it is on, avatars and icons
+// must point at files served from the upload storage instead of hotlinking other sites.
+// Empty values are always allowed.
+func CheckImageURL(url string, db DBExecutor) error {
+	if url == "" {
+		return nil
+	}
+	required, err := GetGlobalSettingBool("require_uploaded_images", false, db)
+	if err != nil || !required {
+		return err
+	}
+	if !strings.HasPrefix(url, UploadStorage.URL("")) {
+		return ErrExternalImage
+	}
+	return nil
+}
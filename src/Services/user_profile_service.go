@@ -0,0 +1,220 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTimezone = errors.New("unknown timezone")
+	ErrInvalidLanguage = errors.New("language must be a code like \"en\" or \"es-ES\"")
+	ErrEmailTaken      = errors.New("email is already used by another account")
+)
+
+const EmailChangeTokenTTL = 48 * time.Hour
+
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})?$`)
+
+// GetPublicUser builds the public profile of a user as seen by viewerID. Only active characters
+// and the custom fields the viewer may see are listed.
+func GetPublicUser(userID int, viewerID int, db DBExecutor) (*Entities.PublicUser, error) {
+	var user Entities.PublicUser
+	err := db.QueryRow("SELECT id, username, avatar, date_registered, date_last_visit FROM users WHERE id = ? AND id != 0", userID).
+		Scan(&user.Id, &user.Username, &user.Avatar, &user.DateRegistered, &user.DateLastVisit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM posts WHERE author_user_id = ?", userID).Scan(&user.PostCount); err != nil {
+		return nil, err
+	}
+
+	user.Roles, err = GetUserRoles(userID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT id, name FROM character_base WHERE user_id = ? AND character_status = ? ORDER BY name", userID, Entities.ActiveCharacter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	user.Characters = []Entities.ShortCharacter{}
+	for rows.Next() {
+		var char Entities.ShortCharacter
+		if err := rows.Scan(&char.Id, &char.Name); err != nil {
+			return nil, err
+		}
+		user.Characters = append(user.Characters, char)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	user.CustomFields, err = GetUserFields(userID, viewerID, db)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserFields loads the custom fields of a user, leaving out the ones viewerID isn't allowed to see.
+func GetUserFields(userID int, viewerID int, db DBExecutor) (*Entities.CustomFieldEntity, error) {
+	access, err := GetFieldAccess("user", int64(userID), viewerID, db)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := GetEntity(int64(userID), "user", access, db)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.(*Entities.UserEntity).CustomFields, nil
+}
+
+// UpdateUserFields saves a user's own custom fields. Fields the user can't edit, such as
+// staff-only ones for a regular member, are rejected with ErrFieldNotEditable.
+func UpdateUserFields(userID int, values map[string]interface{}, db DBExecutor) (*Entities.CustomFieldEntity, error) {
+	access, err := GetFieldAccess("user", int64(userID), userID, db)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]interface{}{
+		"custom_fields": map[string]interface{}{"custom_fields": values},
+	}
+	entity, err := PatchEntity(int64(userID), "user", updates, access, db)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.(*Entities.UserEntity).CustomFields, nil
+}
+
+// UpdateUserSettings changes only the settings present in the request.
+func UpdateUserSettings(userID int, settings Entities.UserSettings, db DBExecutor) error {
+	var sets []string
+	var args []interface{}
+
+	if settings.Avatar != nil {
+		avatar := strings.TrimSpace(*settings.Avatar)
+		if err := CheckImageURL(avatar, db); err != nil {
+			return err
+		}
+		sets = append(sets, "avatar = ?")
+		if avatar == "" {
+			args = append(args, nil)
+		} else {
+			args = append(args, avatar)
+		}
+	}
+	if settings.InterfaceLanguage != nil {
+		if !languagePattern.MatchString(*settings.InterfaceLanguage) {
+			return ErrInvalidLanguage
+		}
+		sets = append(sets, "interface_language = ?")
+		args = append(args, *settings.InterfaceLanguage)
+	}
+	if settings.InterfaceTimezone != nil {
+		if _, err := time.LoadLocation(*settings.InterfaceTimezone); err != nil || *settings.InterfaceTimezone == "" {
+			return ErrInvalidTimezone
+		}
+		sets = append(sets, "interface_timezone = ?")
+		args = append(args, *settings.InterfaceTimezone)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+	args = append(args, userID)
+	_, err := db.Exec("UPDATE users SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...)
+	return err
+}
+
+// RequestEmailChange remembers the new address and sends a confirmation link to it.
+// The account keeps its old email until the link is opened.
+func RequestEmailChange(userID int, newEmail string, db DBExecutor) error {
+	newEmail = strings.TrimSpace(newEmail)
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? AND id != ?", newEmail, userID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailTaken
+	}
+
+	if _, err := db.Exec("UPDATE users SET pending_email = ? WHERE id = ?", newEmail, userID); err != nil {
+		return fmt.Errorf("failed to store new email: %w", err)
+	}
+
+	recipient, err := getMailRecipient(userID, db)
+	if err != nil {
+		return err
+	}
+	token, err := CreateBoundUserToken(userID, EmailChangeToken, EmailChangeTokenTTL, newEmail, db)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(newEmail, recipient.Language, "email_change", map[string]interface{}{
+		"Username": recipient.Username,
+		"Token":    token,
+	})
+}
+
+// ConfirmEmailChange swaps in the pending email. Opening the link proves the new address works,
+// so the token must have been sent to the address that is pending now. The token is only used up
+// together with the change, so a failure leaves it valid.
+func ConfirmEmailChange(token string, db *sql.DB) (int, error) {
+	userID, err := FindUserToken(token, EmailChangeToken, db)
+	if err != nil {
+		return 0, err
+	}
+
+	var pendingEmail sql.NullString
+	if err := db.QueryRow("SELECT pending_email FROM users WHERE id = ?", userID).Scan(&pendingEmail); err != nil {
+		return 0, err
+	}
+	if !pendingEmail.Valid {
+		return 0, ErrInvalidUserToken
+	}
+
+	// Someone may have registered with the address since the change was requested
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? AND id != ?", pendingEmail.String, userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, ErrEmailTaken
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := ConsumeBoundUserToken(token, EmailChangeToken, pendingEmail.String, tx); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec("UPDATE users SET email = pending_email, pending_email = NULL, email_verified = TRUE WHERE id = ? AND pending_email = ?", userID, pendingEmail.String)
+	if err != nil {
+		// Taken between the check and the update
+		if isDuplicateKey(err) {
+			return 0, ErrEmailTaken
+		}
+		return 0, err
+	}
+	// Another change was requested meanwhile
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return 0, ErrInvalidUserToken
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
+}
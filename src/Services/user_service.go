@@ -1,6 +1,8 @@
 package Services
 
 import (
+	"cuento-backend/src/Entities"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -15,3 +17,26 @@ func GetUserIdFromContext(c *gin.Context) int {
 	}
 	return userID
 }
+
+// GetUserRoles returns the roles assigned to the user through user_role.
+func GetUserRoles(userID int, db DBExecutor) ([]Entities.Role, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.name
+		FROM roles r
+		INNER JOIN user_role ur ON r.id = ur.role_id
+		WHERE ur.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Entities.Role{}
+	for rows.Next() {
+		var role Entities.Role
+		if err := rows.Scan(&role.Id, &role.Name); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
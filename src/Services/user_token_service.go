@@ -0,0 +1,254 @@
+package Services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type UserTokenPurpose string
+
+const (
+	EmailVerificationToken UserTokenPurpose = "email_verification"
+	PasswordResetToken     UserTokenPurpose = "password_reset"
+	EmailChangeToken       UserTokenPurpose = "email_change"
+	// Earned with the password by accounts with 2FA, traded for a session at POST /login/2fa
+	TwoFactorChallengeToken UserTokenPurpose = "2fa_challenge"
+)
+
+const (
+	EmailVerificationTokenTTL  = 48 * time.Hour
+	PasswordResetTokenTTL      = time.Hour
+	TwoFactorChallengeTokenTTL = 5 * time.Minute
+)
+
+// Wrong codes a 2FA challenge survives; after that the password has to be entered again
+const TwoFactorChallengeMaxFailures = 3
+
+var (
+	ErrInvalidUserToken  = errors.New("token is invalid, expired or already used")
+	ErrEmailNotVerified  = errors.New("email address is not verified")
+	ErrUserEmailNotFound = errors.New("no user with this email")
+)
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CreateUserToken issues a single-use token for the given purpose and returns it in plain form.
+// Only its hash is stored, and earlier unused tokens for the same purpose stop working.
+func CreateUserToken(userID int, purpose UserTokenPurpose, ttl time.Duration, db DBExecutor) (string, error) {
+	return CreateBoundUserToken(userID, purpose, ttl, "", db)
+}
+
+// CreateBoundUserToken is CreateUserToken for a token only good for one value, such as the address
+// an email change was requested for. ConsumeBoundUserToken checks the value.
+func CreateBoundUserToken(userID int, purpose UserTokenPurpose, ttl time.Duration, bound string, db DBExecutor) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	if _, err := db.Exec("UPDATE user_tokens SET date_used = NOW() WHERE user_id = ? AND purpose = ? AND date_used IS NULL", userID, purpose); err != nil {
+		return "", fmt.Errorf("failed to invalidate previous tokens: %w", err)
+	}
+
+	var boundHash sql.NullString
+	if bound != "" {
+		boundHash = sql.NullString{String: hashToken(bound), Valid: true}
+	}
+	_, err = db.Exec("INSERT INTO user_tokens (user_id, purpose, token_hash, bound_hash, date_created, date_expires) VALUES (?, ?, ?, ?, NOW(), ?)",
+		userID, purpose, hashToken(token), boundHash, time.Now().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+	return token, nil
+}
+
+// FindUserToken returns the user a valid token was issued to without using it up.
+func FindUserToken(token string, purpose UserTokenPurpose, db DBExecutor) (int, error) {
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM user_tokens WHERE token_hash = ? AND purpose = ? AND date_used IS NULL AND date_expires > ?",
+		hashToken(token), purpose, time.Now()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidUserToken
+	}
+	return userID, err
+}
+
+// ConsumeUserToken marks the token as used and returns the user it was issued to.
+func ConsumeUserToken(token string, purpose UserTokenPurpose, db DBExecutor) (int, error) {
+	hash := hashToken(token)
+	res, err := db.Exec("UPDATE user_tokens SET date_used = NOW() WHERE token_hash = ? AND purpose = ? AND date_used IS NULL AND date_expires > ?",
+		hash, purpose, time.Now())
+	return usedTokenOwner(res, err, hash, purpose, db)
+}
+
+// ConsumeBoundUserToken is ConsumeUserToken for tokens from CreateBoundUserToken. It returns
+// ErrInvalidUserToken, leaving the token unused, unless it was issued for this value.
+func ConsumeBoundUserToken(token string, purpose UserTokenPurpose, bound string, db DBExecutor) (int, error) {
+	hash := hashToken(token)
+	res, err := db.Exec("UPDATE user_tokens SET date_used = NOW() WHERE token_hash = ? AND purpose = ? AND bound_hash = ? AND date_used IS NULL AND date_expires > ?",
+		hash, purpose, hashToken(bound), time.Now())
+	return usedTokenOwner(res, err, hash, purpose, db)
+}
+
+// RecordUserTokenFailure counts a wrong code entered with the token and uses the token up
+// once maxFailures is reached.
+func RecordUserTokenFailure(token string, purpose UserTokenPurpose, maxFailures int, db DBExecutor) error {
+	_, err := db.Exec("UPDATE user_tokens SET failures = failures + 1, date_used = IF(failures >= ?, NOW(), date_used) WHERE token_hash = ? AND purpose = ? AND date_used IS NULL",
+		maxFailures, hashToken(token), purpose)
+	return err
+}
+
+// usedTokenOwner checks that a consuming UPDATE used the token up and returns its user.
+func usedTokenOwner(res sql.Result, err error, hash string, purpose UserTokenPurpose, db DBExecutor) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return 0, ErrInvalidUserToken
+	}
+
+	var userID int
+	if err := db.QueryRow("SELECT user_id FROM user_tokens WHERE token_hash = ? AND purpose = ?", hash, purpose).Scan(&userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// SendEmailVerification issues a verification token and mails the link to the user.
+func SendEmailVerification(userID int, db DBExecutor) error {
+	recipient, err := getMailRecipient(userID, db)
+	if err != nil {
+		return err
+	}
+	if recipient.Email == "" {
+		return ErrUserEmailNotFound
+	}
+
+	token, err := CreateUserToken(userID, EmailVerificationToken, EmailVerificationTokenTTL, db)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(recipient.Email, recipient.Language, "email_verification", map[string]interface{}{
+		"Username": recipient.Username,
+		"Token":    token,
+	})
+}
+
+func VerifyEmail(token string, db DBExecutor) (int, error) {
+	userID, err := ConsumeUserToken(token, EmailVerificationToken, db)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := db.Exec("UPDATE users SET email_verified = TRUE WHERE id = ?", userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// SendPasswordReset mails a reset link to the user with this email address.
+func SendPasswordReset(email string, db DBExecutor) error {
+	var userID int
+	if err := db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID); err != nil {
+		return ErrUserEmailNotFound
+	}
+	recipient, err := getMailRecipient(userID, db)
+	if err != nil {
+		return err
+	}
+
+	token, err := CreateUserToken(userID, PasswordResetToken, PasswordResetTokenTTL, db)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(recipient.Email, recipient.Language, "password_reset", map[string]interface{}{
+		"Username": recipient.Username,
+		"Token":    token,
+	})
+}
+
+// ResetPassword consumes the reset token, stores the new, already hashed, password and ends all sessions,
+// all in one transaction so a failure leaves the token usable and the old sessions untouched.
+// Following the link proves access to the mailbox, so the email counts as verified too.
+func ResetPassword(token string, hashedPassword string, db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID, err := ConsumeUserToken(token, PasswordResetToken, tx)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ?, email_verified = TRUE WHERE id = ?", hashedPassword, userID); err != nil {
+		return 0, err
+	}
+	// Whoever knew the old password may still be logged in somewhere
+	if err := RevokeAllUserSessions(userID, tx); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	// Requests checked while the transaction ran may have cached the sessions as active again
+	forgetSessions(func(_ string, session activeSession) bool { return session.userID == userID })
+	return userID, nil
+}
+
+// ChangePassword stores the new, already hashed, password and ends every other session of the user
+// in one transaction, so the password never changes while sessions opened with the old one live on.
+func ChangePassword(userID int, hashedPassword string, keepSessionID string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, userID); err != nil {
+		return err
+	}
+	if err := RevokeOtherSessions(userID, keepSessionID, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	// Requests checked while the transaction ran may have cached the sessions as active again
+	ForgetOtherSessions(userID, keepSessionID)
+	return nil
+}
+
+// RequireVerifiedEmail returns ErrEmailNotVerified when the board only lets verified users post
+// and this user hasn't verified their email yet.
+func RequireVerifiedEmail(userID int, db DBExecutor) error {
+	required, err := GetGlobalSettingBool("require_email_verification_to_post", false, db)
+	if err != nil || !required {
+		return err
+	}
+	var verified bool
+	if err := db.QueryRow("SELECT email_verified FROM users WHERE id = ?", userID).Scan(&verified); err != nil {
+		return err
+	}
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package Services
+
+import (
+	"cuento-backend/src/Entities"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrWantedNotOpen = errors.New("wanted character is not open for claims")
+var ErrClaimNotPending = errors.New("claim is no longer pending")
+
+type WantedFilter struct {
+	FactionIDs   []int                  `json:"faction_ids"`
+	Status       *Entities.WantedStatus `json:"status"`
+	AuthorUserID int                    `json:"author_user_id"`
+	Page         int                    `json:"page"`
+}
+
+type WantedListItem struct {
+	Id             int                   `json:"id"`
+	Name           string                `json:"name"`
+	Avatar         *string               `json:"avatar"`
+	WantedStatus   Entities.WantedStatus `json:"wanted_status"`
+	AuthorUserId   int                   `json:"author_user_id"`
+	AuthorUsername string                `json:"author_username"`
+	DateCreated    string                `json:"date_created"`
+	PendingClaims  int                   `json:"pending_claims"`
+}
+
+// GetWantedCharacter loads a wanted character with the custom fields viewerID may see.
+func GetWantedCharacter(id int, viewerID int, db DBExecutor) (*Entities.WantedCharacter, error) {
+	access, err := GetFieldAccess("wanted_character", int64(id), viewerID, db)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := GetEntity(int64(id), "wanted_character", access, db)
+	if err != nil {
+		return nil, err
+	}
+	wanted, ok := entity.(*Entities.WantedCharacter)
+	if !ok {
+		return nil, fmt.Errorf("failed to cast wanted character entity")
+	}
+
+	if err := db.QueryRow("SELECT username FROM users WHERE id = ?", wanted.AuthorUserId).Scan(&wanted.AuthorUsername); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	wanted.Factions, err = GetWantedFactions(id, db)
+	if err != nil {
+		return nil, err
+	}
+	return wanted, nil
+}
+
+func GetWantedFactions(wantedID int, db DBExecutor) ([]Entities.Faction, error) {
+	rows, err := db.Query(`
+		SELECT f.id, f.name, f.parent_id, f.level, f.description, f.icon, f.show_on_profile
+		FROM factions f
+		JOIN wanted_character_faction wf ON f.id = wf.faction_id
+		WHERE wf.wanted_character_id = ? ORDER BY f.level, f.name`, wantedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	factions := []Entities.Faction{}
+	for rows.Next() {
+		var f Entities.Faction
+		if err := rows.Scan(&f.Id, &f.Name, &f.ParentId, &f.Level, &f.Description, &f.Icon, &f.ShowOnProfile); err != nil {
+			return nil, err
+		}
+		factions = append(factions, f)
+	}
+	return factions, rows.Err()
+}
+
+// SetWantedFactions replaces the factions linked to a wanted character.
+func SetWantedFactions(wantedID int, factionIDs []int, db DBExecutor) error {
+	if _, err := db.Exec("DELETE FROM wanted_character_faction WHERE wanted_character_id = ?", wantedID); err != nil {
+		return err
+	}
+	for _, factionID := range factionIDs {
+		if _, err := db.Exec("INSERT INTO wanted_character_faction (wanted_character_id, faction_id) VALUES (?, ?)", wantedID, factionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ListWantedCharacters(filter WantedFilter, db DBExecutor) ([]WantedListItem, error) {
+	query := `SELECT w.id, w.name, w.avatar, w.wanted_status, w.author_user_id, u.username, w.date_created,
+			(SELECT COUNT(*) FROM wanted_character_claims wc WHERE wc.wanted_character_id = w.id AND wc.status = 0)
+		FROM wanted_character_base w
+		JOIN users u ON w.author_user_id = u.id
+		WHERE 1=1`
+	var args []interface{}
+
+	if filter.Status != nil {
+		query += " AND w.wanted_status = ?"
+		args = append(args, *filter.Status)
+	}
+
+	if filter.AuthorUserID > 0 {
+		query += " AND w.author_user_id = ?"
+		args = append(args, filter.AuthorUserID)
+	}
+
+	if len(filter.FactionIDs) > 0 {
+		placeholders := make([]string, len(filter.FactionIDs))
+		for i, id := range filter.FactionIDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		query += " AND EXISTS (SELECT 1 FROM wanted_character_faction wf WHERE wf.wanted_character_id = w.id AND wf.faction_id IN (" + strings.Join(placeholders, ",") + "))"
+	}
+
+	limit := 20
+	page := filter.Page
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	query += " ORDER BY w.date_created DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []WantedListItem{}
+	for rows.Next() {
+		var item WantedListItem
+		if err := rows.Scan(&item.Id, &item.Name, &item.Avatar, &item.WantedStatus, &item.AuthorUserId, &item.AuthorUsername, &item.DateCreated, &item.PendingClaims); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+const wantedClaimSelect = `
+	SELECT wc.id, wc.wanted_character_id, wc.user_id, u.username, wc.subforum_id, wc.avatar, wc.message,
+		wc.custom_fields, wc.status, wc.character_id, wc.date_created, wc.date_resolved
+	FROM wanted_character_claims wc
+	JOIN users u ON wc.user_id = u.id`
+
+func scanWantedClaim(scanner interface{ Scan(...interface{}) error }) (*Entities.WantedClaim, error) {
+	var claim Entities.WantedClaim
+	var customFields []byte
+	err := scanner.Scan(&claim.Id, &claim.WantedCharacterId, &claim.UserId, &claim.Username, &claim.SubforumId, &claim.Avatar, &claim.Message,
+		&customFields, &claim.Status, &claim.CharacterId, &claim.DateCreated, &claim.DateResolved)
+	if err != nil {
+		return nil, err
+	}
+	if len(customFields) > 0 {
+		if err := json.Unmarshal(customFields, &claim.CustomFields); err != nil {
+			return nil, fmt.Errorf("failed to parse claim custom fields: %w", err)
+		}
+	}
+	return &claim, nil
+}
+
+func GetWantedClaim(id int, db DBExecutor) (*Entities.WantedClaim, error) {
+	return scanWantedClaim(db.QueryRow(wantedClaimSelect+" WHERE wc.id = ?", id))
+}
+
+func GetWantedClaims(wantedID int, db DBExecutor) ([]Entities.WantedClaim, error) {
+	rows, err := db.Query(wantedClaimSelect+" WHERE wc.wanted_character_id = ? ORDER BY wc.date_created", wantedID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []Entities.WantedClaim{}
+	for rows.Next() {
+		claim, err := scanWantedClaim(rows)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, *claim)
+	}
+	return claims, rows.Err()
+}
+
+func CreateWantedClaim(claim Entities.WantedClaim, db *sql.DB) (*Entities.WantedClaim, error) {
+	var status Entities.WantedStatus
+	if err := db.QueryRow("SELECT wanted_status FROM wanted_character_base WHERE id = ?", claim.WantedCharacterId).Scan(&status); err != nil {
+		return nil, err
+	}
+	if status != Entities.OpenWanted {
+		return nil, ErrWantedNotOpen
+	}
+
+	// The fields become the claimant's character, so they are checked as if they created it
+	access, err := GetCreatorFieldAccess("character", claim.UserId, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckEditableFields("character", claim.CustomFields, access, db); err != nil {
+		return nil, err
+	}
+
+	customFields, err := json.Marshal(claim.CustomFields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode custom fields: %w", err)
+	}
+
+	res, err := db.Exec("INSERT INTO wanted_character_claims (wanted_character_id, user_id, subforum_id, avatar, message, custom_fields, status, date_created) VALUES (?, ?, ?, ?, ?, ?, ?, NOW())",
+		claim.WantedCharacterId, claim.UserId, claim.SubforumId, claim.Avatar, claim.Message, string(customFields), Entities.PendingClaim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert claim: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claim ID: %w", err)
+	}
+	return GetWantedClaim(int(id), db)
+}
+
+// AcceptWantedClaim turns the claim into a pending character owned by the claimant, using the same
+// path as a regular character creation, and closes the wanted character for further claims.
+// The other pending claims are declined; it returns their claimants to be told.
+func AcceptWantedClaim(claimID int, db *sql.DB) (*Entities.WantedClaim, interface{}, []int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	claim, err := scanWantedClaim(tx.QueryRow(wantedClaimSelect+" WHERE wc.id = ? FOR UPDATE", claimID))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if claim.Status != Entities.PendingClaim {
+		return nil, nil, nil, ErrClaimNotPending
+	}
+
+	var name string
+	var avatar *string
+	var status Entities.WantedStatus
+	err = tx.QueryRow("SELECT name, avatar, wanted_status FROM wanted_character_base WHERE id = ? FOR UPDATE", claim.WantedCharacterId).Scan(&name, &avatar, &status)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if status != Entities.OpenWanted {
+		return nil, nil, nil, ErrWantedNotOpen
+	}
+
+	factions, err := GetWantedFactions(claim.WantedCharacterId, tx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get wanted factions: %w", err)
+	}
+
+	if claim.Avatar != nil {
+		avatar = claim.Avatar
+	}
+
+	access, err := GetCreatorFieldAccess("character", claim.UserId, tx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	character, characterID, err := CreateCharacterWithSheet(NewCharacter{
+		UserID:       claim.UserId,
+		SubforumID:   claim.SubforumId,
+		Name:         name,
+		Avatar:       avatar,
+		Status:       Entities.PendingCharacter,
+		CustomFields: claim.CustomFields,
+		Factions:     factions,
+		Access:       access,
+	}, tx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE wanted_character_claims SET status = ?, character_id = ?, date_resolved = NOW() WHERE id = ?",
+		Entities.AcceptedClaim, characterID, claimID); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to update claim: %w", err)
+	}
+
+	// The accepted claimant already hears about the acceptance
+	rows, err := tx.Query("SELECT DISTINCT user_id FROM wanted_character_claims WHERE wanted_character_id = ? AND status = ? AND user_id != ? FOR UPDATE",
+		claim.WantedCharacterId, Entities.PendingClaim, claim.UserId)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get other claims: %w", err)
+	}
+	var declinedUserIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, nil, nil, fmt.Errorf("failed to get other claims: %w", err)
+		}
+		declinedUserIDs = append(declinedUserIDs, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get other claims: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE wanted_character_claims SET status = ?, date_resolved = NOW() WHERE wanted_character_id = ? AND status = ?",
+		Entities.DeclinedClaim, claim.WantedCharacterId, Entities.PendingClaim); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decline other claims: %w", err)
+	}
+
+	if _, err := tx.Exec("UPDATE wanted_character_base SET wanted_status = ? WHERE id = ?", Entities.ClaimedWanted, claim.WantedCharacterId); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to update wanted character: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	claim, err = GetWantedClaim(claimID, db)
+	return claim, character, declinedUserIDs, err
+}
+
+func DeclineWantedClaim(claimID int, db *sql.DB) (*Entities.WantedClaim, error) {
+	res, err := db.Exec("UPDATE wanted_character_claims SET status = ?, date_resolved = NOW() WHERE id = ? AND status = ?",
+		Entities.DeclinedClaim, claimID, Entities.PendingClaim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update claim: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil, ErrClaimNotPending
+	}
+	return GetWantedClaim(claimID, db)
+}
@@ -0,0 +1,34 @@
+package Uploads
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrUnsupportedAttachment = errors.New("only images, PDF and plain text files can be attached")
+
+// Types posts can carry, by sniffed MIME type, with the extension they are stored under
+var attachmentExtensions = map[string]string{
+	"image/jpeg":      "jpg",
+	"image/png":       "png",
+	"image/gif":       "gif",
+	"application/pdf": "pdf",
+	"text/plain":      "txt",
+}
+
+// DetectAttachmentType sniffs the MIME type from the content and returns it with the storage extension.
+func DetectAttachmentType(data []byte) (string, string, error) {
+	mimeType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	ext, ok := attachmentExtensions[mimeType]
+	if !ok {
+		return "", "", ErrUnsupportedAttachment
+	}
+	return mimeType, ext, nil
+}
+
+// IsImageType reports whether files of the MIME type go through the image pipeline.
+func IsImageType(mimeType string) bool {
+	_, ok := extensions[mimeType]
+	return ok
+}
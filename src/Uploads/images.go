@@ -0,0 +1,181 @@
+package Uploads
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images can be uploaded")
+	ErrFileTooLarge    = errors.New("file is too large")
+	ErrImageTooLarge   = errors.New("image dimensions are too large")
+)
+
+// Limits are checked before an image is fully decoded, so oversized images cost almost nothing.
+type Limits struct {
+	MaxFileSize int
+	MaxWidth    int
+	MaxHeight   int
+}
+
+// Image is a validated upload. Only the sniffed MIME type is trusted, never the client's.
+type Image struct {
+	MimeType string
+	Width    int
+	Height   int
+	img      image.Image
+	raw      []byte
+	rgba     *image.RGBA // img converted once, shared by every variant
+}
+
+// Variant is one encoded file produced from an image.
+type Variant struct {
+	Name   string
+	Ext    string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// DecodeImage sniffs the MIME type from the content and checks it against the limits.
+func DecodeImage(data []byte, limits Limits) (*Image, error) {
+	if len(data) > limits.MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	if _, ok := extensions[mimeType]; !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return nil, fmt.Errorf("%w: %dx%d, at most %dx%d is allowed", ErrImageTooLarge, config.Width, config.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	return &Image{MimeType: mimeType, Width: config.Width, Height: config.Height, img: img, raw: data}, nil
+}
+
+// Original re-encodes the image, which drops metadata such as GPS coordinates. GIFs are kept
+// as uploaded so animations survive; they carry no such metadata.
+func (i *Image) Original() (*Variant, error) {
+	if i.MimeType == "image/gif" {
+		return &Variant{Name: "original", Ext: "gif", Data: i.raw, Width: i.Width, Height: i.Height}, nil
+	}
+	return i.encode("original", i.pixels())
+}
+
+// Avatar crops the middle square of the image and scales it to size x size.
+func (i *Image) Avatar(size int) (*Variant, error) {
+	side := min(i.Width, i.Height)
+	src := i.pixels()
+	x0 := (i.Width - side) / 2
+	y0 := (i.Height - side) / 2
+	square := src.SubImage(image.Rect(x0, y0, x0+side, y0+side)).(*image.RGBA)
+	return i.encode(fmt.Sprintf("avatar_%d", size), resize(square, size, size))
+}
+
+// Thumbnail scales the image so its longest side is at most size, keeping the aspect ratio.
+// Smaller images are not enlarged.
+func (i *Image) Thumbnail(size int) (*Variant, error) {
+	w, h := i.Width, i.Height
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/i.Width)
+		} else {
+			w, h = max(1, w*size/i.Height), size
+		}
+	}
+	return i.encode("thumb", resize(i.pixels(), w, h))
+}
+
+// encode writes JPEG sources back as JPEG and everything else as PNG.
+func (i *Image) encode(name string, img *image.RGBA) (*Variant, error) {
+	var buf bytes.Buffer
+	ext := "png"
+	if i.MimeType == "image/jpeg" {
+		ext = "jpg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+	} else if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	return &Variant{Name: name, Ext: ext, Data: buf.Bytes(), Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// pixels returns the image as RGBA, converting it on first use. Variants only read it.
+func (i *Image) pixels() *image.RGBA {
+	if i.rgba == nil {
+		i.rgba = toRGBA(i.img)
+	}
+	return i.rgba
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// resize scales src to w x h. Each target pixel is the average of the source pixels it covers,
+// which gives clean downscaling without anything outside the standard library.
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(b.Min.X+x0, b.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					bl += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(bl / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
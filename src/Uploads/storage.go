@@ -0,0 +1,114 @@
+package Uploads
+
+import (
+	"cuento-backend/config"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage keeps uploaded files under slash-separated keys. A key is never reused for different
+// content, so the URL of a key never changes. Implementations must be safe for concurrent use.
+type Storage interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	URL(key string) string
+}
+
+// NewStorage builds the storage selected in the upload config.
+func NewStorage(cfg *config.UploadConfig) (Storage, error) {
+	switch cfg.Storage {
+	case "local", "":
+		return NewLocalStorage(cfg.Dir, cfg.PublicURL)
+	default:
+		return nil, fmt.Errorf("unknown upload storage %q", cfg.Storage)
+	}
+}
+
+// NewPrivateStorage builds the storage for files that are only handed out by the server, which is
+// never served directly. Its URLs mean nothing.
+func NewPrivateStorage(cfg *config.UploadConfig) (Storage, error) {
+	switch cfg.Storage {
+	case "local", "":
+		return NewLocalStorage(cfg.PrivateDir, "")
+	default:
+		return nil, fmt.Errorf("unknown upload storage %q", cfg.Storage)
+	}
+}
+
+// LocalStorage writes files below Dir. They are served by the web server under PublicURL.
+type LocalStorage struct {
+	Dir       string
+	PublicURL string
+}
+
+func NewLocalStorage(dir string, publicURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &LocalStorage{Dir: dir, PublicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := path.Clean("/" + key)[1:]
+	if clean == "" || clean != key {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(key string, data []byte) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a half-written file is never served
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *LocalStorage) Get(key string) ([]byte, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(target)
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) URL(key string) string {
+	return s.PublicURL + "/" + key
+}
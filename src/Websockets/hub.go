@@ -49,6 +49,19 @@ func (c *Client) writePump() {
 	}
 }
 
+// Reply sends a message to this connection only. Like SendNotification it drops the message
+// if the client is gone or its buffer is full.
+func (c *Client) Reply(message interface{}) {
+	defer func() {
+		// Send is closed once the client is unregistered
+		_ = recover()
+	}()
+	select {
+	case c.Send <- message:
+	default:
+	}
+}
+
 type Hub struct {
 	clients    map[int]map[*Client]bool
 	register   chan *Client
@@ -102,6 +115,13 @@ func (h *Hub) Unregister(client *Client) {
 	h.unregister <- client
 }
 
+// IsConnected reports whether the user has at least one open WebSocket connection.
+func (h *Hub) IsConnected(userID int) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
 func (h *Hub) SendNotification(userID int, message interface{}) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -121,7 +141,8 @@ func (h *Hub) SendNotification(userID int, message interface{}) {
 				case client.Send <- message:
 					// Message sent successfully.
 				default:
-					// Client's send buffer is full. Drop the message.
+					// Client's send buffer is full. Drop the message, persisted
+					// notifications can still be fetched from the inbox.
 				}
 			}()
 		}